@@ -0,0 +1,47 @@
+package auth
+
+import (
+	hex "encoding/hex"
+	strings "strings"
+	utils "vulnlabs-rest-api/utils"
+)
+
+const (
+	// APIKeyPrefix : Marks API keys, so they can be recognized (e.g. by secret scanners)
+	APIKeyPrefix = "vlk"
+
+	apiKeyIDLength     = 6
+	apiKeySecretLength = 32
+)
+
+// GenerateAPIKey : Generate an API key "vlk_<id>_<secret>", returning it & its public prefix "vlk_<id>"
+func GenerateAPIKey() (string, string, error) {
+
+	id, err := utils.GenerateCryptoRandomBytes(apiKeyIDLength)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := utils.GenerateCryptoRandomBytes(apiKeySecretLength)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix := APIKeyPrefix + "_" + hex.EncodeToString(id)
+
+	return prefix + "_" + hex.EncodeToString(secret), prefix, nil
+}
+
+// APIKeyPrefixOf : Public prefix of key, false if key is not shaped as an API key
+func APIKeyPrefixOf(key string) (string, bool) {
+
+	parts := strings.Split(key, "_")
+
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || len(parts[1]) != 2*apiKeyIDLength || len(parts[2]) != 2*apiKeySecretLength {
+		return "", false
+	}
+
+	return parts[0] + "_" + parts[1], true
+}
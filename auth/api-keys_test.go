@@ -0,0 +1,44 @@
+package auth
+
+import (
+	strings "strings"
+	testing "testing"
+)
+
+func TestAPIKeyPrefixOf(t *testing.T) {
+
+	key, prefix, err := GenerateAPIKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := strings.Repeat("a", 2*apiKeyIDLength)
+	secret := strings.Repeat("b", 2*apiKeySecretLength)
+
+	tests := []struct {
+		name   string
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"generated", key, prefix, true},
+		{"well formed", "vlk_" + id + "_" + secret, "vlk_" + id, true},
+		{"other prefix", "abc_" + id + "_" + secret, "", false},
+		{"short id", "vlk_" + id[1:] + "_" + secret, "", false},
+		{"short secret", "vlk_" + id + "_" + secret[1:], "", false},
+		{"missing secret", "vlk_" + id, "", false},
+		{"extra part", "vlk_" + id + "_" + secret + "_c", "", false},
+		{"session token", "dGhpcyBpcyBhIHNlc3Npb24gdG9rZW4", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, test := range tests {
+
+		prefix, ok := APIKeyPrefixOf(test.key)
+
+		if prefix != test.prefix || ok != test.ok {
+			t.Errorf("%s : got %q %t, want %q %t", test.name, prefix, ok, test.prefix, test.ok)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	subtle "crypto/subtle"
+	fmt "fmt"
+	models "vulnlabs-rest-api/models"
+	utils "vulnlabs-rest-api/utils"
+
+	argon2 "golang.org/x/crypto/argon2"
+)
+
+const (
+	DefaultArgon2idTime        = 3
+	DefaultArgon2idMemoryInKiB = 64 * 1024
+	DefaultArgon2idThreads     = 2
+	DefaultArgon2idSaltLength  = 16
+	DefaultArgon2idKeyLength   = 32
+)
+
+// argon2idHasher : Argon2id hasher producing $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type argon2idHasher struct {
+	config models.Argon2idConfig
+}
+
+func newArgon2idHasher(config models.Argon2idConfig) (*argon2idHasher, error) {
+
+	if config.Time == 0 {
+		config.Time = DefaultArgon2idTime
+	}
+
+	if config.MemoryInKiB == 0 {
+		config.MemoryInKiB = DefaultArgon2idMemoryInKiB
+	}
+
+	if config.Threads == 0 {
+		config.Threads = DefaultArgon2idThreads
+	}
+
+	if config.SaltLength == 0 {
+		config.SaltLength = DefaultArgon2idSaltLength
+	}
+
+	if config.KeyLength == 0 {
+		config.KeyLength = DefaultArgon2idKeyLength
+	}
+
+	return &argon2idHasher{config: config}, nil
+}
+
+func (hasher *argon2idHasher) Hash(password string) (string, error) {
+
+	salt, err := utils.GenerateCryptoRandomBytes(int(hasher.config.SaltLength))
+
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.config.Time, hasher.config.MemoryInKiB, hasher.config.Threads, hasher.config.KeyLength)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", hasher.config.MemoryInKiB, hasher.config.Time, hasher.config.Threads)
+
+	return encodePHC(AlgorithmArgon2id, argon2.Version, params, salt, key), nil
+}
+
+func (hasher *argon2idHasher) Verify(password string, hash string) (bool, error) {
+
+	config, phc, err := hasher.decode(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), phc.Salt, config.Time, config.MemoryInKiB, config.Threads, config.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, phc.Hash) == 1, nil
+}
+
+func (hasher *argon2idHasher) Identifies(hash string) bool {
+
+	phc, err := parsePHC(hash)
+	return err == nil && phc.ID == AlgorithmArgon2id
+}
+
+func (hasher *argon2idHasher) NeedsRehash(hash string) bool {
+
+	config, _, err := hasher.decode(hash)
+
+	if err != nil {
+		return true
+	}
+
+	return config.Time != hasher.config.Time ||
+		config.MemoryInKiB != hasher.config.MemoryInKiB ||
+		config.Threads != hasher.config.Threads ||
+		config.SaltLength != hasher.config.SaltLength ||
+		config.KeyLength != hasher.config.KeyLength
+}
+
+// decode : Extract Argon2id parameters from PHC string
+func (hasher *argon2idHasher) decode(hash string) (*models.Argon2idConfig, *phcHash, error) {
+
+	phc, err := parsePHC(hash)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if phc.ID != AlgorithmArgon2id || phc.Version != argon2.Version {
+		return nil, nil, errInvalidPHC
+	}
+
+	memory, err := phc.intParam("m")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	time, err := phc.intParam("t")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	threads, err := phc.intParam("p")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if memory <= 0 || time <= 0 || threads <= 0 || threads > 255 {
+		return nil, nil, errInvalidPHC
+	}
+
+	return &models.Argon2idConfig{
+		Time:        uint32(time),
+		MemoryInKiB: uint32(memory),
+		Threads:     uint8(threads),
+		SaltLength:  uint32(len(phc.Salt)),
+		KeyLength:   uint32(len(phc.Hash)),
+	}, phc, nil
+}
@@ -1,16 +1,113 @@
 package auth
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	fmt "fmt"
+	models "vulnlabs-rest-api/models"
 )
 
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmScrypt   = "scrypt"
+
+	DefaultAlgorithm = AlgorithmBcrypt
+)
+
+// Hasher : Password hashing algorithm
+type Hasher interface {
+	// Hash : Hash password with the hasher parameters
+	Hash(password string) (string, error)
+
+	// Verify : Check password against a hash produced by this algorithm (with any parameters)
+	Verify(password string, hash string) (bool, error)
+
+	// Identifies : Check wether the hash was produced by this algorithm
+	Identifies(hash string) bool
+
+	// NeedsRehash : Check wether the hash parameters differ from the hasher ones
+	NeedsRehash(hash string) bool
+}
+
+// NewHasher : Return the hasher described by config, applying defaults to unset parameters
+func NewHasher(config models.PasswordHashingConfig) (Hasher, error) {
+
+	switch config.Algorithm {
+	case "", AlgorithmBcrypt:
+		return newBcryptHasher(config.BcryptCost)
+	case AlgorithmArgon2id:
+		return newArgon2idHasher(config.Argon2id)
+	case AlgorithmScrypt:
+		return newScryptHasher(config.Scrypt)
+	}
+
+	return nil, fmt.Errorf("unknown password hashing algorithm %s", config.Algorithm)
+}
+
+// HashPassword : Hash password with the currently configured hasher
 func HashPassword(password string) (string, error) {
 
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	hasher, err := currentHasher()
+
+	if err != nil {
+		return "", err
+	}
+
+	return hasher.Hash(password)
 }
 
+// CheckPasswordHash : Check password against hash, whatever algorithm produced it
 func CheckPasswordHash(password string, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+
+	hasher := hasherFor(hash)
+
+	if hasher == nil {
+		return false
+	}
+
+	ok, err := hasher.Verify(password, hash)
+	return err == nil && ok
+}
+
+// NeedsRehash : Check wether hash was produced with another algorithm or other parameters than the configured ones
+func NeedsRehash(hash string) bool {
+
+	hasher, err := currentHasher()
+
+	if err != nil {
+		return false
+	}
+
+	if !hasher.Identifies(hash) {
+		return true
+	}
+
+	return hasher.NeedsRehash(hash)
+}
+
+// currentHasher : Hasher described by the global config
+func currentHasher() (Hasher, error) {
+
+	if models.GlobalConfig == nil {
+		return NewHasher(models.PasswordHashingConfig{})
+	}
+
+	return NewHasher(models.GlobalConfig.PasswordHashing)
+}
+
+// hasherFor : Hasher able to verify hash (parameters are read from the hash itself)
+func hasherFor(hash string) Hasher {
+
+	defaults := models.PasswordHashingConfig{}
+
+	for _, algorithm := range []string{AlgorithmBcrypt, AlgorithmArgon2id, AlgorithmScrypt} {
+
+		defaults.Algorithm = algorithm
+		hasher, err := NewHasher(defaults)
+
+		if err == nil && hasher.Identifies(hash) {
+			return hasher
+		}
+	}
+
+	return nil
 }
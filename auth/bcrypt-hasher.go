@@ -0,0 +1,167 @@
+package auth
+
+import (
+	base64 "encoding/base64"
+	fmt "fmt"
+	strings "strings"
+
+	bcrypt "golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultBcryptCost = 14
+
+	// bcryptPHCVersion : Minor version of the bcrypt modular crypt format ('b'), as in $2b$
+	bcryptPHCVersion = 98
+
+	bcryptSaltEncodedLength = 22
+)
+
+var (
+	// bcryptEncoding : Base64 alphabet of the bcrypt modular crypt format
+	bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+	bcryptLegacyPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+)
+
+// bcryptHasher : Bcrypt hasher producing $bcrypt$v=98$r=<cost>$<salt>$<hash>.
+// Legacy modular crypt format hashes ($2a$<cost>$...) are verified, and rehashed on login
+type bcryptHasher struct {
+	cost int
+}
+
+func newBcryptHasher(cost int) (*bcryptHasher, error) {
+
+	if cost == 0 {
+		cost = DefaultBcryptCost
+	}
+
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return &bcryptHasher{cost: cost}, nil
+}
+
+func (hasher *bcryptHasher) Hash(password string) (string, error) {
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return bcryptToPHC(string(bytes))
+}
+
+func (hasher *bcryptHasher) Verify(password string, hash string) (bool, error) {
+
+	modularCrypt, err := bcryptFromPHC(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(modularCrypt), []byte(password))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (hasher *bcryptHasher) Identifies(hash string) bool {
+
+	if isLegacyBcrypt(hash) {
+		return true
+	}
+
+	phc, err := parsePHC(hash)
+	return err == nil && phc.ID == AlgorithmBcrypt
+}
+
+// NeedsRehash : Legacy modular crypt format hashes are rehashed into PHC strings
+func (hasher *bcryptHasher) NeedsRehash(hash string) bool {
+
+	if isLegacyBcrypt(hash) {
+		return true
+	}
+
+	modularCrypt, err := bcryptFromPHC(hash)
+
+	if err != nil {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(modularCrypt))
+	return err != nil || cost != hasher.cost
+}
+
+// isLegacyBcrypt : Wether hash is in the bcrypt modular crypt format
+func isLegacyBcrypt(hash string) bool {
+
+	for _, prefix := range bcryptLegacyPrefixes {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bcryptToPHC : Convert a modular crypt format hash ($2b$<cost>$<salt><hash>) to a PHC string
+func bcryptToPHC(modularCrypt string) (string, error) {
+
+	fields := strings.Split(modularCrypt, "$")
+
+	if len(fields) != 4 || len(fields[3]) <= bcryptSaltEncodedLength {
+		return "", errInvalidPHC
+	}
+
+	cost, err := bcrypt.Cost([]byte(modularCrypt))
+
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := bcryptEncoding.DecodeString(fields[3][:bcryptSaltEncodedLength])
+
+	if err != nil {
+		return "", errInvalidPHC
+	}
+
+	hash, err := bcryptEncoding.DecodeString(fields[3][bcryptSaltEncodedLength:])
+
+	if err != nil {
+		return "", errInvalidPHC
+	}
+
+	return encodePHC(AlgorithmBcrypt, bcryptPHCVersion, fmt.Sprintf("r=%d", cost), salt, hash), nil
+}
+
+// bcryptFromPHC : Modular crypt format of hash, as understood by the bcrypt package. Legacy hashes are returned as is
+func bcryptFromPHC(hash string) (string, error) {
+
+	if isLegacyBcrypt(hash) {
+		return hash, nil
+	}
+
+	phc, err := parsePHC(hash)
+
+	if err != nil {
+		return "", err
+	}
+
+	if phc.ID != AlgorithmBcrypt || phc.Version != bcryptPHCVersion {
+		return "", errInvalidPHC
+	}
+
+	cost, err := phc.intParam("r")
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$2b$%02d$%s%s", cost, bcryptEncoding.EncodeToString(phc.Salt), bcryptEncoding.EncodeToString(phc.Hash)), nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	bufio "bufio"
+	sha1 "crypto/sha1"
+	hex "encoding/hex"
+	fmt "fmt"
+	os "os"
+	strings "strings"
+	sync "sync"
+)
+
+var (
+	// breachedPasswords : SHA-1 digests of breached passwords, loaded by LoadBreachedPasswords
+	breachedPasswords      = map[[sha1.Size]byte]struct{}{}
+	breachedPasswordsMutex sync.RWMutex
+)
+
+// LoadBreachedPasswords : Load the breached passwords hashes file, one SHA-1 hex hash per line
+// optionally followed by ":<count>" (Have I Been Pwned format). Replaces previously loaded hashes
+func LoadBreachedPasswords(path string) error {
+
+	hashes := map[[sha1.Size]byte]struct{}{}
+
+	if path != "" {
+
+		file, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		line := 0
+
+		for scanner.Scan() {
+
+			line++
+			hash := strings.TrimSpace(strings.SplitN(scanner.Text(), ":", 2)[0])
+
+			if hash == "" {
+				continue
+			}
+
+			var digest [sha1.Size]byte
+			decoded, err := hex.DecodeString(hash)
+
+			if err != nil || len(decoded) != sha1.Size {
+				return fmt.Errorf("invalid SHA-1 hash line %d of %s", line, path)
+			}
+
+			copy(digest[:], decoded)
+			hashes[digest] = struct{}{}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	breachedPasswordsMutex.Lock()
+	breachedPasswords = hashes
+	breachedPasswordsMutex.Unlock()
+
+	return nil
+}
+
+// IsBreachedPassword : Wether password is in the loaded breached passwords
+func IsBreachedPassword(password string) bool {
+
+	breachedPasswordsMutex.RLock()
+	defer breachedPasswordsMutex.RUnlock()
+
+	_, breached := breachedPasswords[sha1.Sum([]byte(password))]
+
+	return breached
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	hmac "crypto/hmac"
+	sha256 "crypto/sha256"
+	subtle "crypto/subtle"
+	hex "encoding/hex"
+)
+
+const (
+	csrfTokenLabel = "csrf"
+)
+
+// CSRFToken : CSRF token bound to the session. It is derived from the session token,
+// so it needs no storage and cannot be forged without knowing the session cookie
+func CSRFToken(sessionToken string) string {
+
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte(csrfTokenLabel))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCSRFToken : Check submitted CSRF token against the session one
+func CheckCSRFToken(sessionToken string, csrfToken string) bool {
+
+	return subtle.ConstantTimeCompare([]byte(CSRFToken(sessionToken)), []byte(csrfToken)) == 1
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	aes "crypto/aes"
+	cipher "crypto/cipher"
+	base64 "encoding/base64"
+	errors "errors"
+	ioutil "io/ioutil"
+	models "vulnlabs-rest-api/models"
+	utils "vulnlabs-rest-api/utils"
+)
+
+var (
+	errMissingEncryptionKey = errors.New("MFA encryption key is not configured")
+	errInvalidCiphertext    = errors.New("Invalid ciphertext")
+)
+
+// EncryptSecret : Encrypt secret with AES-256-GCM using the configured MFA encryption key
+// Output is base64(nonce | ciphertext)
+func EncryptSecret(plaintext string) (string, error) {
+
+	gcm, err := secretsCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := utils.GenerateCryptoRandomBytes(gcm.NonceSize())
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret : Decrypt secret encrypted with EncryptSecret
+func DecryptSecret(ciphertext string) (string, error) {
+
+	gcm, err := secretsCipher()
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errInvalidCiphertext
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return "", errInvalidCiphertext
+	}
+
+	return string(plaintext), nil
+}
+
+// secretsCipher : AES-GCM cipher built from the MFA encryption key in config
+func secretsCipher() (cipher.AEAD, error) {
+
+	if models.GlobalConfig == nil {
+		return nil, errMissingEncryptionKey
+	}
+
+	return NewSecretsCipher(models.GlobalConfig.MFA)
+}
+
+// NewSecretsCipher : AES-GCM cipher built from the 32 bytes key of config, read from its file if set
+func NewSecretsCipher(config models.MFAConfig) (cipher.AEAD, error) {
+
+	key, err := secretsKey(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != 32 {
+		return nil, errors.New("MFA encryption key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// secretsKey : Raw MFA encryption key, read from file or decoded from config
+func secretsKey(config models.MFAConfig) ([]byte, error) {
+
+	if config.EncryptionKeyFile != "" {
+		return ioutil.ReadFile(config.EncryptionKeyFile)
+	}
+
+	if config.EncryptionKey == "" {
+		return nil, errMissingEncryptionKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(config.EncryptionKey)
+
+	if err != nil {
+		return nil, errors.New("MFA encryption key must be base64 encoded")
+	}
+
+	return key, nil
+}
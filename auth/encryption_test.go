@@ -0,0 +1,49 @@
+package auth
+
+import (
+	base64 "encoding/base64"
+	ioutil "io/ioutil"
+	os "os"
+	filepath "path/filepath"
+	strings "strings"
+	testing "testing"
+	models "vulnlabs-rest-api/models"
+)
+
+func TestNewSecretsCipher(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "mfa-key")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	keyFile := filepath.Join(directory, "key")
+	shortKeyFile := filepath.Join(directory, "short-key")
+
+	ioutil.WriteFile(keyFile, []byte(strings.Repeat("k", 32)), 0600)
+	ioutil.WriteFile(shortKeyFile, []byte(strings.Repeat("k", 16)), 0600)
+
+	tests := []struct {
+		name   string
+		config models.MFAConfig
+		valid  bool
+	}{
+		{"32 bytes key", models.MFAConfig{EncryptionKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))}, true},
+		{"missing key", models.MFAConfig{}, false},
+		{"16 bytes key", models.MFAConfig{EncryptionKey: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 16)))}, false},
+		{"not base64", models.MFAConfig{EncryptionKey: strings.Repeat("!", 44)}, false},
+		{"32 bytes key file", models.MFAConfig{EncryptionKeyFile: keyFile}, true},
+		{"16 bytes key file", models.MFAConfig{EncryptionKeyFile: shortKeyFile}, false},
+		{"missing key file", models.MFAConfig{EncryptionKeyFile: filepath.Join(directory, "missing")}, false},
+	}
+
+	for _, test := range tests {
+
+		if _, err := NewSecretsCipher(test.config); (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
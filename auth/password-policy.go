@@ -0,0 +1,110 @@
+package auth
+
+import (
+	fmt "fmt"
+	strings "strings"
+	unicode "unicode"
+	utf8 "unicode/utf8"
+	models "vulnlabs-rest-api/models"
+	validation "vulnlabs-rest-api/validation"
+)
+
+// personalInfoMinLength : Shorter email parts & names are not looked for in passwords
+const personalInfoMinLength = 3
+
+// CheckPasswordPolicy : Check password against the configured policy. userInputs are the user email, names...
+// that the password must not contain. Failure is returned as validation.Errors on field
+func CheckPasswordPolicy(field string, password string, userInputs ...string) error {
+
+	config := models.GlobalConfig.PasswordPolicy
+	validationErrors := validation.Errors{}
+
+	if utf8.RuneCountInString(password) < config.Length() {
+		validationErrors.Add(field, "min", fmt.Sprintf("must be at least %d characters long", config.Length()))
+		return validationErrors
+	}
+
+	if characterClasses(password) < config.CharacterClasses() {
+		validationErrors.Add(field, "characterClasses", fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits & symbols", config.CharacterClasses()))
+		return validationErrors
+	}
+
+	if !config.AllowPersonalInfo && containsPersonalInfo(password, userInputs) {
+		validationErrors.Add(field, "personalInfo", "must not contain your email or name")
+		return validationErrors
+	}
+
+	if IsBreachedPassword(password) {
+		validationErrors.Add(field, "breached", "appears in a known data breach")
+		return validationErrors
+	}
+
+	if PasswordStrengthScore(password, userInputs...) < config.Score() {
+		validationErrors.Add(field, "strength", "is too easy to guess")
+		return validationErrors
+	}
+
+	return nil
+}
+
+// characterClasses : Number of character classes (lowercase, uppercase, digits, symbols) in password
+func characterClasses(password string) int {
+
+	var lower, upper, digit, symbol int
+
+	for _, char := range password {
+
+		switch {
+		case unicode.IsLower(char):
+			lower = 1
+		case unicode.IsUpper(char):
+			upper = 1
+		case unicode.IsDigit(char):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo : Wether password contains one of userInputs, or the local part of an email among them
+func containsPersonalInfo(password string, userInputs []string) bool {
+
+	password = strings.ToLower(password)
+
+	for _, input := range personalInfoTokens(userInputs) {
+
+		if strings.Contains(password, input) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// personalInfoTokens : Lowercased userInputs long enough to matter, emails being split in local part & domain name
+func personalInfoTokens(userInputs []string) []string {
+
+	tokens := []string{}
+
+	for _, input := range userInputs {
+
+		input = strings.ToLower(strings.TrimSpace(input))
+		candidates := []string{input}
+
+		if at := strings.LastIndex(input, "@"); at >= 0 {
+			candidates = append(candidates, input[:at], strings.Split(input[at+1:], ".")[0])
+		}
+
+		for _, candidate := range candidates {
+
+			if utf8.RuneCountInString(candidate) >= personalInfoMinLength {
+				tokens = append(tokens, candidate)
+			}
+		}
+	}
+
+	return tokens
+}
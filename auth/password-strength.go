@@ -0,0 +1,216 @@
+package auth
+
+import (
+	math "math"
+	regexp "regexp"
+	strings "strings"
+	unicode "unicode"
+)
+
+var (
+	// commonPasswordWords : Words & keyboard patterns attackers try first
+	commonPasswordWords = []string{
+		"password", "passw0rd", "qwerty", "azerty", "qwertz", "asdf", "zxcv", "letmein", "welcome",
+		"admin", "login", "master", "secret", "dragon", "monkey", "shadow", "sunshine", "princess",
+		"football", "baseball", "superman", "batman", "trustno1", "iloveyou", "hello", "freedom",
+		"whatever", "starwars", "pokemon", "love", "god",
+	}
+
+	// leetSubstitutions : Common character substitutions, undone before looking for words
+	leetSubstitutions = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+	// yearRegexp : Years from 1900 to 2099, guessed among yearBits
+	yearRegexp = regexp.MustCompile(`(19|20)[0-9]{2}`)
+	yearBits   = math.Log2(200)
+
+	// scoreThresholds : Minimum guesses (as bits) of scores 1 to 4, as in zxcvbn (10^3, 10^6, 10^8 & 10^10 guesses)
+	scoreThresholds = []float64{10, 20, 26.6, 33.2}
+)
+
+// PasswordStrengthScore : zxcvbn-like score from 0 (too guessable) to 4 (very unguessable),
+// estimating guesses an attacker would need knowing common words, patterns & userInputs
+func PasswordStrengthScore(password string, userInputs ...string) int {
+
+	bits := passwordGuessesBits(password, userInputs)
+	score := 0
+
+	for _, threshold := range scoreThresholds {
+
+		if bits >= threshold {
+			score++
+		}
+	}
+
+	return score
+}
+
+// passwordGuessesBits : log2 of the estimated guesses to find password.
+// Dictionary words & years cost a guess among their kind, repeats & sequences barely cost more than their first character,
+// other characters cost a guess among the character set used by the password
+func passwordGuessesBits(password string, userInputs []string) float64 {
+
+	chars := []rune(password)
+	lowered := []rune(strings.ToLower(password))
+	normalized := []rune(leetSubstitutions.Replace(string(lowered)))
+
+	// Substitutions are single characters, so positions are preserved
+	forms := [][]rune{lowered}
+
+	if len(normalized) == len(lowered) {
+		forms = append(forms, normalized)
+	}
+
+	dictionary := append(personalInfoTokens(userInputs), commonPasswordWords...)
+	dictionaryBits := math.Log2(float64(len(dictionary)))
+
+	matched := make([]bool, len(chars))
+	bits := 0.0
+
+	// Words, longest first, plain or with substitutions
+	for _, word := range sortedByLength(dictionary) {
+
+		wordRunes := []rune(word)
+
+		for start := 0; start+len(wordRunes) <= len(chars); start++ {
+
+			if anyMatched(matched[start:start+len(wordRunes)]) || !anyFormMatches(forms, start, word) {
+				continue
+			}
+
+			markMatched(matched, start, len(wordRunes))
+
+			// Word choice & its capitalization
+			bits += dictionaryBits + 1
+		}
+	}
+
+	// Years
+	for _, location := range yearRegexp.FindAllStringIndex(string(lowered), -1) {
+
+		start, length := len([]rune(string(lowered)[:location[0]])), 4
+
+		if !anyMatched(matched[start : start+length]) {
+			markMatched(matched, start, length)
+			bits += yearBits
+		}
+	}
+
+	charsetBits := math.Log2(float64(charsetSize(password)))
+
+	for i := 0; i < len(chars); {
+
+		if matched[i] {
+			i++
+			continue
+		}
+
+		// Repeated character (aaa) or sequence (abc, 321) : its first character, then about a bit per character
+		run := 1
+
+		if i+1 < len(chars) && !matched[i+1] {
+
+			step := chars[i+1] - chars[i]
+
+			if step >= -1 && step <= 1 {
+
+				for run = 2; i+run < len(chars) && !matched[i+run] && chars[i+run]-chars[i+run-1] == step; run++ {
+				}
+			}
+		}
+
+		if run < 3 {
+			run = 1
+		}
+
+		bits += charsetBits + float64(run-1)
+		i += run
+	}
+
+	return bits
+}
+
+// anyFormMatches : Wether word is found at start in any form of the password
+func anyFormMatches(forms [][]rune, start int, word string) bool {
+
+	for _, form := range forms {
+
+		end := start + len([]rune(word))
+
+		if end <= len(form) && string(form[start:end]) == word {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markMatched : Mark length positions from start as covered
+func markMatched(matched []bool, start int, length int) {
+
+	for i := start; i < start+length; i++ {
+		matched[i] = true
+	}
+}
+
+// charsetSize : Size of the character set an attacker must try to cover password characters
+func charsetSize(password string) int {
+
+	var lower, upper, digit, symbol, other bool
+
+	for _, char := range password {
+
+		switch {
+		case char >= 'a' && char <= 'z':
+			lower = true
+		case char >= 'A' && char <= 'Z':
+			upper = true
+		case char >= '0' && char <= '9':
+			digit = true
+		case char < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+
+		if class.present {
+			size += class.size
+		}
+	}
+
+	return size
+}
+
+// sortedByLength : Copy of words, longest first
+func sortedByLength(words []string) []string {
+
+	sorted := append([]string{}, words...)
+
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && len(sorted[j]) > len(sorted[j-1]); j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+
+	return sorted
+}
+
+// anyMatched : Wether any position is already covered by a word
+func anyMatched(positions []bool) bool {
+
+	for _, position := range positions {
+
+		if position {
+			return true
+		}
+	}
+
+	return false
+}
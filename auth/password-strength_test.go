@@ -0,0 +1,55 @@
+package auth
+
+import (
+	testing "testing"
+)
+
+func TestPasswordStrengthScore(t *testing.T) {
+
+	tests := []struct {
+		password   string
+		userInputs []string
+		min        int
+		max        int
+	}{
+		{"", nil, 0, 0},
+		{"password", nil, 0, 0},
+		{"P@ssw0rd", nil, 0, 1},
+		{"qwerty1234", nil, 0, 1},
+		{"aaaaaaaaaaaa", nil, 0, 1},
+		{"abcdefghijkl", nil, 0, 1},
+		{"dragon1987", nil, 0, 1},
+		{"johnsmith2019", []string{"john", "smith"}, 0, 1},
+		{"Tr0ub4dor&3", nil, 2, 4},
+		{"correct horse battery staple", nil, 4, 4},
+		{"x7$Kp2!qZm9#", nil, 4, 4},
+	}
+
+	for _, test := range tests {
+
+		score := PasswordStrengthScore(test.password, test.userInputs...)
+
+		if score < test.min || score > test.max {
+			t.Errorf("%q : got score %d, want %d to %d", test.password, score, test.min, test.max)
+		}
+	}
+}
+
+func TestPasswordStrengthScoreUserInputs(t *testing.T) {
+
+	tests := []struct {
+		password   string
+		userInputs []string
+	}{
+		{"johnsmith!", []string{"John", "Smith"}},
+		{"vulnlabstester", []string{"vulnlabs", "tester"}},
+		{"rosalind-Kx", []string{"rosalind"}},
+	}
+
+	for _, test := range tests {
+
+		if without, with := PasswordStrengthScore(test.password), PasswordStrengthScore(test.password, test.userInputs...); with >= without {
+			t.Errorf("%q : user inputs must lower the score, got %d without & %d with", test.password, without, with)
+		}
+	}
+}
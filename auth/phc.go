@@ -0,0 +1,110 @@
+package auth
+
+import (
+	base64 "encoding/base64"
+	errors "errors"
+	fmt "fmt"
+	strconv "strconv"
+	strings "strings"
+)
+
+// PHC string format : $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+// see https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+
+var (
+	phcEncoding = base64.RawStdEncoding
+
+	errInvalidPHC = errors.New("Invalid PHC formatted hash")
+)
+
+// phcHash : Decoded PHC string
+type phcHash struct {
+	ID      string
+	Version int
+	Params  map[string]string
+	Salt    []byte
+	Hash    []byte
+}
+
+// encodePHC : Encode hash in PHC string format. params must already be serialized (e.g. "m=65536,t=3,p=2")
+func encodePHC(id string, version int, params string, salt []byte, hash []byte) string {
+
+	fields := []string{"", id}
+
+	if version > 0 {
+		fields = append(fields, fmt.Sprintf("v=%d", version))
+	}
+
+	fields = append(fields, params, phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(hash))
+
+	return strings.Join(fields, "$")
+}
+
+// parsePHC : Decode PHC string. Salt & hash are mandatory
+func parsePHC(s string) (*phcHash, error) {
+
+	fields := strings.Split(s, "$")
+
+	// Leading "$" produces an empty first field
+	if len(fields) < 5 || fields[0] != "" {
+		return nil, errInvalidPHC
+	}
+
+	phc := &phcHash{
+		ID:     fields[1],
+		Params: map[string]string{},
+	}
+
+	fields = fields[2:]
+
+	if strings.HasPrefix(fields[0], "v=") {
+
+		version, err := strconv.Atoi(strings.TrimPrefix(fields[0], "v="))
+
+		if err != nil {
+			return nil, errInvalidPHC
+		}
+
+		phc.Version = version
+		fields = fields[1:]
+	}
+
+	if len(fields) != 3 {
+		return nil, errInvalidPHC
+	}
+
+	for _, param := range strings.Split(fields[0], ",") {
+
+		kv := strings.SplitN(param, "=", 2)
+
+		if len(kv) != 2 {
+			return nil, errInvalidPHC
+		}
+
+		phc.Params[kv[0]] = kv[1]
+	}
+
+	var err error
+
+	if phc.Salt, err = phcEncoding.DecodeString(fields[1]); err != nil {
+		return nil, errInvalidPHC
+	}
+
+	if phc.Hash, err = phcEncoding.DecodeString(fields[2]); err != nil {
+		return nil, errInvalidPHC
+	}
+
+	return phc, nil
+}
+
+// intParam : Read integer parameter from decoded PHC string
+func (phc *phcHash) intParam(name string) (int, error) {
+
+	value, ok := phc.Params[name]
+
+	if !ok {
+		return 0, fmt.Errorf("Missing PHC parameter %s", name)
+	}
+
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	strings "strings"
+	testing "testing"
+	models "vulnlabs-rest-api/models"
+
+	bcrypt "golang.org/x/crypto/bcrypt"
+)
+
+func TestParsePHC(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		phc     string
+		valid   bool
+		id      string
+		version int
+		params  map[string]string
+	}{
+		{"argon2id", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2g", true, "argon2id", 19, map[string]string{"m": "65536", "t": "3", "p": "2"}},
+		{"without version", "$scrypt$ln=15,r=8,p=1$c2FsdHNhbHQ$aGFzaGhhc2g", true, "scrypt", 0, map[string]string{"ln": "15", "r": "8", "p": "1"}},
+		{"missing leading dollar", "argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2g", false, "", 0, nil},
+		{"missing hash", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ", false, "", 0, nil},
+		{"extra field", "$argon2id$v=19$m=65536$t=3$c2FsdHNhbHQ$aGFzaGhhc2g", false, "", 0, nil},
+		{"invalid version", "$argon2id$v=x$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2g", false, "", 0, nil},
+		{"param without value", "$argon2id$v=19$m$c2FsdHNhbHQ$aGFzaGhhc2g", false, "", 0, nil},
+		{"padded salt", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ=$aGFzaGhhc2g", false, "", 0, nil},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false, "", 0, nil},
+	}
+
+	for _, test := range tests {
+
+		phc, err := parsePHC(test.phc)
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+			continue
+		}
+
+		if !test.valid {
+			continue
+		}
+
+		if phc.ID != test.id || phc.Version != test.version || string(phc.Salt) != "saltsalt" || string(phc.Hash) != "hashhash" {
+			t.Errorf("%s : got %+v", test.name, phc)
+		}
+
+		for name, value := range test.params {
+			if phc.Params[name] != value {
+				t.Errorf("%s : got param %s=%s, want %s", test.name, name, phc.Params[name], value)
+			}
+		}
+	}
+}
+
+func TestEncodePHCRoundTrip(t *testing.T) {
+
+	encoded := encodePHC(AlgorithmArgon2id, 19, "m=65536,t=3,p=2", []byte("saltsalt"), []byte("hashhash"))
+
+	if encoded != "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2g" {
+		t.Fatalf("got %s", encoded)
+	}
+
+	phc, err := parsePHC(encoded)
+
+	if err != nil || phc.ID != AlgorithmArgon2id || phc.Version != 19 {
+		t.Fatalf("got %+v, %v", phc, err)
+	}
+
+	memory, err := phc.intParam("m")
+
+	if err != nil || memory != 65536 {
+		t.Errorf("got m=%d, %v", memory, err)
+	}
+
+	if _, err := phc.intParam("x"); err == nil {
+		t.Error("missing param must fail")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+
+	fastArgon2id := models.Argon2idConfig{Time: 1, MemoryInKiB: 64, Threads: 1}
+	fastScrypt := models.ScryptConfig{N: 16, R: 1, P: 1}
+
+	hash := func(config models.PasswordHashingConfig) string {
+
+		hasher, err := NewHasher(config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hashed, err := hasher.Hash("correct horse battery staple")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return hashed
+	}
+
+	bcryptHash := hash(models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+	legacyBcryptHash := legacyBcrypt(t, "correct horse battery staple", 4)
+	argon2idHash := hash(models.PasswordHashingConfig{Algorithm: AlgorithmArgon2id, Argon2id: fastArgon2id})
+	scryptHash := hash(models.PasswordHashingConfig{Algorithm: AlgorithmScrypt, Scrypt: fastScrypt})
+
+	tests := []struct {
+		name   string
+		config models.PasswordHashingConfig
+		hash   string
+		rehash bool
+	}{
+		{"same bcrypt cost", models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4}, bcryptHash, false},
+		{"other bcrypt cost", models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 5}, bcryptHash, true},
+		{"legacy bcrypt format", models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4}, legacyBcryptHash, true},
+		{"bcrypt to argon2id", models.PasswordHashingConfig{Algorithm: AlgorithmArgon2id, Argon2id: fastArgon2id}, bcryptHash, true},
+		{"same argon2id params", models.PasswordHashingConfig{Algorithm: AlgorithmArgon2id, Argon2id: fastArgon2id}, argon2idHash, false},
+		{"other argon2id memory", models.PasswordHashingConfig{Algorithm: AlgorithmArgon2id, Argon2id: models.Argon2idConfig{Time: 1, MemoryInKiB: 128, Threads: 1}}, argon2idHash, true},
+		{"same scrypt params", models.PasswordHashingConfig{Algorithm: AlgorithmScrypt, Scrypt: fastScrypt}, scryptHash, false},
+		{"other scrypt N", models.PasswordHashingConfig{Algorithm: AlgorithmScrypt, Scrypt: models.ScryptConfig{N: 32, R: 1, P: 1}}, scryptHash, true},
+		{"scrypt to bcrypt", models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4}, scryptHash, true},
+	}
+
+	previous := models.GlobalConfig
+	defer func() { models.GlobalConfig = previous }()
+
+	for _, test := range tests {
+
+		models.GlobalConfig = &models.Config{PasswordHashing: test.config}
+
+		if rehash := NeedsRehash(test.hash); rehash != test.rehash {
+			t.Errorf("%s : got rehash %t, want %t", test.name, rehash, test.rehash)
+		}
+	}
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+
+	hasher, err := NewHasher(models.PasswordHashingConfig{Algorithm: AlgorithmArgon2id, Argon2id: models.Argon2idConfig{Time: 1, MemoryInKiB: 64, Threads: 1}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash("correct horse battery staple")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		hash     string
+		valid    bool
+	}{
+		{"correct horse battery staple", hash, true},
+		{"correct horse battery stapler", hash, false},
+		{"correct horse battery staple", "$argon2id$v=19$m=64,t=1,p=1$broken", false},
+		{"correct horse battery staple", "plaintext", false},
+	}
+
+	for _, test := range tests {
+		if valid := CheckPasswordHash(test.password, test.hash); valid != test.valid {
+			t.Errorf("%s against %s : got %t, want %t", test.password, test.hash, valid, test.valid)
+		}
+	}
+}
+
+// legacyBcrypt : Hash of password in the bcrypt modular crypt format, as stored before PHC strings
+func legacyBcrypt(t *testing.T, password string, cost int) string {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hash)
+}
+
+func TestBcryptHasher(t *testing.T) {
+
+	hasher, err := NewHasher(models.PasswordHashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash("correct horse battery staple")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$bcrypt$v=98$r=4$") {
+		t.Fatalf("got hash %s, want a PHC string", hash)
+	}
+
+	legacyHash := legacyBcrypt(t, "correct horse battery staple", 4)
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		valid    bool
+	}{
+		{"PHC hash", "correct horse battery staple", hash, true},
+		{"PHC hash, wrong password", "correct horse battery stapler", hash, false},
+		{"legacy hash", "correct horse battery staple", legacyHash, true},
+		{"legacy hash, wrong password", "correct horse battery stapler", legacyHash, false},
+		{"PHC hash of another version", "correct horse battery staple", strings.Replace(hash, "v=98", "v=97", 1), false},
+		{"truncated PHC hash", "correct horse battery staple", hash[:len(hash)-4], false},
+	}
+
+	for _, test := range tests {
+		if valid := CheckPasswordHash(test.password, test.hash); valid != test.valid {
+			t.Errorf("%s : got %t, want %t", test.name, valid, test.valid)
+		}
+	}
+}
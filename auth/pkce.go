@@ -0,0 +1,28 @@
+package auth
+
+import (
+	sha256 "crypto/sha256"
+	subtle "crypto/subtle"
+	base64 "encoding/base64"
+	regexp "regexp"
+)
+
+// pkceCodeVerifierPattern : 43 to 128 unreserved characters (RFC 7636 section 4.1)
+var pkceCodeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// PKCECodeChallenge : S256 code challenge of verifier
+func PKCECodeChallenge(verifier string) string {
+
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CheckPKCECodeVerifier : Check verifier against its S256 code challenge
+func CheckPKCECodeVerifier(verifier string, challenge string) bool {
+
+	if !pkceCodeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(PKCECodeChallenge(verifier)), []byte(challenge)) == 1
+}
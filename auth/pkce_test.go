@@ -0,0 +1,40 @@
+package auth
+
+import (
+	strings "strings"
+	testing "testing"
+)
+
+func TestCheckPKCECodeVerifier(t *testing.T) {
+
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if PKCECodeChallenge(verifier) != challenge {
+		t.Fatalf("got challenge %s, want %s", PKCECodeChallenge(verifier), challenge)
+	}
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		valid     bool
+	}{
+		{"rfc example", verifier, challenge, true},
+		{"other verifier", strings.Replace(verifier, "d", "e", 1), challenge, false},
+		{"verifier as challenge", verifier, verifier, false},
+		{"too short", verifier[:42], PKCECodeChallenge(verifier[:42]), false},
+		{"shortest", verifier[:43], PKCECodeChallenge(verifier[:43]), true},
+		{"longest", strings.Repeat("a", 128), PKCECodeChallenge(strings.Repeat("a", 128)), true},
+		{"too long", strings.Repeat("a", 129), PKCECodeChallenge(strings.Repeat("a", 129)), false},
+		{"reserved character", verifier[:42] + "/", PKCECodeChallenge(verifier[:42] + "/"), false},
+		{"empty", "", PKCECodeChallenge(""), false},
+	}
+
+	for _, test := range tests {
+		if valid := CheckPKCECodeVerifier(test.verifier, test.challenge); valid != test.valid {
+			t.Errorf("%s : got %t, want %t", test.name, valid, test.valid)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	sha256 "crypto/sha256"
+	hex "encoding/hex"
+	strings "strings"
+	utils "vulnlabs-rest-api/utils"
+)
+
+const (
+	// Recovery codes are 16 characters long (80 bits), displayed as 4 groups of 4
+	RecoveryCodeLength    = 16
+	RecoveryCodeGroupSize = 4
+
+	// Unambiguous alphabet (no 0/o, 1/l/i)
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// GenerateRecoveryCodes : Generate n random single-use recovery codes
+func GenerateRecoveryCodes(n int) ([]string, error) {
+
+	codes := make([]string, n)
+
+	for i := range codes {
+
+		randomBytes, err := utils.GenerateCryptoRandomBytes(RecoveryCodeLength)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var code strings.Builder
+
+		for j, b := range randomBytes {
+
+			if j > 0 && j%RecoveryCodeGroupSize == 0 {
+				code.WriteByte('-')
+			}
+
+			// Alphabet size is 31 so the modulo bias is negligible (256 % 31 = 8)
+			code.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+
+		codes[i] = code.String()
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode : Hash recovery code for storage.
+// Codes are random & long enough for a fast hash, which allows lookups by hash
+func HashRecoveryCode(code string) string {
+
+	normalized := strings.ToLower(code)
+	normalized = strings.Replace(normalized, "-", "", -1)
+	normalized = strings.Replace(normalized, " ", "", -1)
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
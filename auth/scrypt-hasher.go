@@ -0,0 +1,152 @@
+package auth
+
+import (
+	subtle "crypto/subtle"
+	errors "errors"
+	fmt "fmt"
+	bits "math/bits"
+	models "vulnlabs-rest-api/models"
+	utils "vulnlabs-rest-api/utils"
+
+	scrypt "golang.org/x/crypto/scrypt"
+)
+
+const (
+	DefaultScryptN          = 32768
+	DefaultScryptR          = 8
+	DefaultScryptP          = 1
+	DefaultScryptSaltLength = 16
+	DefaultScryptKeyLength  = 32
+)
+
+// scryptHasher : Scrypt hasher producing $scrypt$ln=<log2(N)>,r=<r>,p=<p>$<salt>$<hash>
+type scryptHasher struct {
+	config models.ScryptConfig
+}
+
+func newScryptHasher(config models.ScryptConfig) (*scryptHasher, error) {
+
+	if config.N == 0 {
+		config.N = DefaultScryptN
+	}
+
+	if config.R == 0 {
+		config.R = DefaultScryptR
+	}
+
+	if config.P == 0 {
+		config.P = DefaultScryptP
+	}
+
+	if config.SaltLength == 0 {
+		config.SaltLength = DefaultScryptSaltLength
+	}
+
+	if config.KeyLength == 0 {
+		config.KeyLength = DefaultScryptKeyLength
+	}
+
+	if config.N <= 1 || config.N&(config.N-1) != 0 {
+		return nil, errors.New("scrypt N must be a power of 2 greater than 1")
+	}
+
+	return &scryptHasher{config: config}, nil
+}
+
+func (hasher *scryptHasher) Hash(password string) (string, error) {
+
+	salt, err := utils.GenerateCryptoRandomBytes(hasher.config.SaltLength)
+
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, hasher.config.N, hasher.config.R, hasher.config.P, hasher.config.KeyLength)
+
+	if err != nil {
+		return "", err
+	}
+
+	logN := bits.TrailingZeros(uint(hasher.config.N))
+	params := fmt.Sprintf("ln=%d,r=%d,p=%d", logN, hasher.config.R, hasher.config.P)
+
+	return encodePHC(AlgorithmScrypt, 0, params, salt, key), nil
+}
+
+func (hasher *scryptHasher) Verify(password string, hash string) (bool, error) {
+
+	config, phc, err := hasher.decode(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	key, err := scrypt.Key([]byte(password), phc.Salt, config.N, config.R, config.P, config.KeyLength)
+
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, phc.Hash) == 1, nil
+}
+
+func (hasher *scryptHasher) Identifies(hash string) bool {
+
+	phc, err := parsePHC(hash)
+	return err == nil && phc.ID == AlgorithmScrypt
+}
+
+func (hasher *scryptHasher) NeedsRehash(hash string) bool {
+
+	config, _, err := hasher.decode(hash)
+
+	if err != nil {
+		return true
+	}
+
+	return *config != hasher.config
+}
+
+// decode : Extract scrypt parameters from PHC string
+func (hasher *scryptHasher) decode(hash string) (*models.ScryptConfig, *phcHash, error) {
+
+	phc, err := parsePHC(hash)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if phc.ID != AlgorithmScrypt {
+		return nil, nil, errInvalidPHC
+	}
+
+	logN, err := phc.intParam("ln")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := phc.intParam("r")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := phc.intParam("p")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if logN < 1 || logN > 30 || r <= 0 || p <= 0 {
+		return nil, nil, errInvalidPHC
+	}
+
+	return &models.ScryptConfig{
+		N:          1 << uint(logN),
+		R:          r,
+		P:          p,
+		SaltLength: len(phc.Salt),
+		KeyLength:  len(phc.Hash),
+	}, phc, nil
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	sha256 "crypto/sha256"
+	hex "encoding/hex"
+	strings "strings"
+	utils "vulnlabs-rest-api/utils"
+)
+
+// GenerateToken : Generate a random single-use token (password reset, email verification...)
+func GenerateToken() (string, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToUpper(hex.EncodeToString(randomBytes)), nil
+}
+
+// TokenDigest : Digest under which a random token is stored, so storage never holds usable tokens
+func TokenDigest(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
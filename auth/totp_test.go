@@ -0,0 +1,69 @@
+package auth
+
+import (
+	testing "testing"
+	time "time"
+)
+
+// rfc6238Secret : Base32 of the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPCode(t *testing.T) {
+
+	// Codes are the last 6 digits of the RFC 6238 appendix B SHA1 vectors
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     int64
+		valid  bool
+		step   int64
+	}{
+		{"rfc vector 59", rfc6238Secret, "287082", 59, true, 1},
+		{"rfc vector 1111111109", rfc6238Secret, "081804", 1111111109, true, 37037036},
+		{"rfc vector 1234567890", rfc6238Secret, "005924", 1234567890, true, 41152263},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "005924", 1234567890, true, 41152263},
+		{"previous period", rfc6238Secret, "005924", 1234567890 + TOTPPeriodSeconds, true, 41152263},
+		{"next period", rfc6238Secret, "005924", 1234567890 - TOTPPeriodSeconds, true, 41152263},
+		{"beyond skew after", rfc6238Secret, "005924", 1234567890 + 2*TOTPPeriodSeconds, false, 0},
+		{"beyond skew before", rfc6238Secret, "005924", 1234567890 - 2*TOTPPeriodSeconds, false, 0},
+		{"wrong code", rfc6238Secret, "005925", 1234567890, false, 0},
+		{"short code", rfc6238Secret, "05924", 1234567890, false, 0},
+		{"invalid secret", "not base32!", "005924", 1234567890, false, 0},
+	}
+
+	for _, test := range tests {
+
+		step, valid := ValidateTOTPCode(test.secret, test.code, time.Unix(test.at, 0))
+
+		if valid != test.valid || step != test.step {
+			t.Errorf("%s : got step %d valid %t, want step %d valid %t", test.name, step, valid, test.step, test.valid)
+		}
+	}
+}
+
+// Replays are told by the matched time step, which must not depend on when the code is submitted within the skew
+func TestValidateTOTPCodeReplayStep(t *testing.T) {
+
+	issuedAt := time.Unix(1234567890, 0)
+	code := totpCode([]byte("12345678901234567890"), issuedAt.Unix()/TOTPPeriodSeconds)
+
+	firstStep, valid := ValidateTOTPCode(rfc6238Secret, code, issuedAt)
+
+	if !valid {
+		t.Fatal("code must be valid when issued")
+	}
+
+	replayedStep, valid := ValidateTOTPCode(rfc6238Secret, code, issuedAt.Add(TOTPPeriodSeconds*time.Second))
+
+	if !valid || replayedStep != firstStep {
+		t.Errorf("replay got step %d valid %t, want step %d", replayedStep, valid, firstStep)
+	}
+
+	nextCode := totpCode([]byte("12345678901234567890"), firstStep+1)
+	nextStep, valid := ValidateTOTPCode(rfc6238Secret, nextCode, issuedAt)
+
+	if !valid || nextStep <= firstStep {
+		t.Errorf("next code got step %d valid %t, want a step after %d", nextStep, valid, firstStep)
+	}
+}
@@ -0,0 +1,37 @@
+package jwt
+
+import (
+	base64 "encoding/base64"
+)
+
+// JWK : Public JSON Web Key (RFC 7517), as published to token verifiers
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// JWKSet : JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK : Public key as JWK (RFC 8037 OKP key for EdDSA). Symmetric keys are never published
+func (key *Key) PublicJWK() (*JWK, bool) {
+
+	if key.Algorithm != AlgorithmEdDSA || len(key.PublicKey) == 0 {
+		return nil, false
+	}
+
+	return &JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(key.PublicKey),
+		Use:       "sig",
+		Algorithm: key.Algorithm,
+		KeyID:     key.ID,
+	}, true
+}
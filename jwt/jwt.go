@@ -0,0 +1,267 @@
+package jwt
+
+import (
+	hmac "crypto/hmac"
+	sha256 "crypto/sha256"
+	base64 "encoding/base64"
+	json "encoding/json"
+	errors "errors"
+	strings "strings"
+	time "time"
+
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// Supported signing algorithms (JWA names)
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	// Token types of the typ header
+	TypeJWT         = "JWT"
+	TypeAccessToken = "at+jwt"
+
+	// Leeway : Tolerated clock skew when checking time claims
+	Leeway = 30 * time.Second
+)
+
+var (
+	ErrMalformed        = errors.New("Malformed token")
+	ErrUnknownAlgorithm = errors.New("Unknown signing algorithm")
+	ErrUnknownKey       = errors.New("Unknown signing key")
+	ErrInvalidSignature = errors.New("Invalid token signature")
+	ErrExpired          = errors.New("Token expired")
+	ErrNotYetValid      = errors.New("Token not yet valid")
+)
+
+// Header : JOSE header
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Claims : Registered claims, to be embedded in application claims
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// Validator : Claims checked once the token signature is verified
+type Validator interface {
+	Valid(now time.Time) error
+}
+
+// Valid : Check time claims at now
+func (claims Claims) Valid(now time.Time) error {
+
+	if claims.ExpiresAt != 0 && !now.Add(-Leeway).Before(time.Unix(claims.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+
+	if claims.NotBefore != 0 && now.Add(Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+
+	return nil
+}
+
+// Key : Signing key, identified by ID in the token header
+type Key struct {
+	ID        string
+	Algorithm string
+
+	// HS256 shared secret
+	Secret []byte
+
+	// EdDSA key pair, the private key being only required to sign
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// KeyFunc : Resolve the key verifying a token from its header
+type KeyFunc func(header *Header) (*Key, error)
+
+// NewHS256Key : Return a HS256 key from its secret
+func NewHS256Key(id string, secret []byte) *Key {
+
+	return &Key{
+		ID:        id,
+		Algorithm: AlgorithmHS256,
+		Secret:    secret,
+	}
+}
+
+// NewEdDSAKey : Return an Ed25519 key from its 32 bytes seed
+func NewEdDSAKey(id string, seed []byte) (*Key, error) {
+
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("Ed25519 seed must be 32 bytes long")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+
+	return &Key{
+		ID:         id,
+		Algorithm:  AlgorithmEdDSA,
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// Sign : Serialize claims as a compact JWS of type tokenType, signed with key.
+// Token types keep tokens of different purposes signed by the same keys apart
+func Sign(tokenType string, claims interface{}, key *Key) (string, error) {
+
+	header, err := json.Marshal(Header{
+		Algorithm: key.Algorithm,
+		Type:      tokenType,
+		KeyID:     key.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	signature, err := key.sign([]byte(signingInput))
+
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Parse : Verify token signature with the key resolved by keyFunc, then decode its payload into claims and validate them.
+// The algorithm of the header must match the one of the key, so that a key cannot be used with another algorithm
+func Parse(token string, keyFunc KeyFunc, claims Validator) (*Header, error) {
+
+	segments := strings.Split(token, ".")
+
+	if len(segments) != 3 {
+		return nil, ErrMalformed
+	}
+
+	headerBytes, err := decodeSegment(segments[0])
+
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	var header Header
+
+	if json.Unmarshal(headerBytes, &header) != nil {
+		return nil, ErrMalformed
+	}
+
+	if header.Algorithm != AlgorithmHS256 && header.Algorithm != AlgorithmEdDSA {
+		return nil, ErrUnknownAlgorithm
+	}
+
+	key, err := keyFunc(&header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil || key.Algorithm != header.Algorithm {
+		return nil, ErrUnknownKey
+	}
+
+	signature, err := decodeSegment(segments[2])
+
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if !key.verify([]byte(segments[0]+"."+segments[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := decodeSegment(segments[1])
+
+	if err != nil || json.Unmarshal(payload, claims) != nil {
+		return nil, ErrMalformed
+	}
+
+	err = claims.Valid(time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &header, nil
+}
+
+// ParseUnverified : Decode the payload of token into claims and validate them, without verifying its signature.
+// Only for tokens received directly from their issuer over TLS, which authenticates them in place of the signature
+func ParseUnverified(token string, claims Validator) error {
+
+	segments := strings.Split(token, ".")
+
+	if len(segments) != 3 {
+		return ErrMalformed
+	}
+
+	payload, err := decodeSegment(segments[1])
+
+	if err != nil || json.Unmarshal(payload, claims) != nil {
+		return ErrMalformed
+	}
+
+	return claims.Valid(time.Now())
+}
+
+// sign : Signature of input
+func (key *Key) sign(input []byte) ([]byte, error) {
+
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+
+	case AlgorithmEdDSA:
+		if len(key.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, errors.New("Ed25519 private key required to sign")
+		}
+		return ed25519.Sign(key.PrivateKey, input), nil
+	}
+
+	return nil, ErrUnknownAlgorithm
+}
+
+// verify : Check signature of input
+func (key *Key) verify(input []byte, signature []byte) bool {
+
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		expected, _ := key.sign(input)
+		return hmac.Equal(expected, signature)
+
+	case AlgorithmEdDSA:
+		return len(key.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(key.PublicKey, input, signature)
+	}
+
+	return false
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
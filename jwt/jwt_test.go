@@ -0,0 +1,162 @@
+package jwt
+
+import (
+	base64 "encoding/base64"
+	json "encoding/json"
+	strings "strings"
+	testing "testing"
+	time "time"
+)
+
+// testKeys : Key ring of the tests, resolved by ID
+func testKeys(t *testing.T) map[string]*Key {
+
+	eddsaKey, err := NewEdDSAKey("eddsa", []byte(strings.Repeat("s", 32)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]*Key{
+		"hs256": NewHS256Key("hs256", []byte(strings.Repeat("k", 32))),
+		"eddsa": eddsaKey,
+	}
+}
+
+func testKeyFunc(keys map[string]*Key) KeyFunc {
+
+	return func(header *Header) (*Key, error) {
+
+		key, ok := keys[header.KeyID]
+
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+
+		return key, nil
+	}
+}
+
+// forge : Token of header & claims signed with key, whatever the header says
+func forge(t *testing.T, header Header, claims interface{}, key *Key) string {
+
+	headerBytes, _ := json.Marshal(header)
+	claimsBytes, _ := json.Marshal(claims)
+
+	signingInput := encodeSegment(headerBytes) + "." + encodeSegment(claimsBytes)
+	signature, err := key.sign([]byte(signingInput))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signingInput + "." + encodeSegment(signature)
+}
+
+func TestParse(t *testing.T) {
+
+	keys := testKeys(t)
+	now := time.Now()
+
+	valid := Claims{Subject: "user", ExpiresAt: now.Add(time.Minute).Unix()}
+
+	sign := func(claims Claims, key *Key) string {
+
+		token, err := Sign(TypeJWT, claims, key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	// HS256 token keyed with the public key of the EdDSA key, as in algorithm confusion attacks
+	confused := forge(t, Header{Algorithm: AlgorithmHS256, KeyID: "eddsa"}, valid, NewHS256Key("eddsa", keys["eddsa"].PublicKey))
+
+	eddsaToken := sign(valid, keys["eddsa"])
+	segments := strings.Split(eddsaToken, ".")
+	tamperedPayload, _ := json.Marshal(Claims{Subject: "admin", ExpiresAt: valid.ExpiresAt})
+	tampered := segments[0] + "." + base64.RawURLEncoding.EncodeToString(tamperedPayload) + "." + segments[2]
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"hs256", sign(valid, keys["hs256"]), nil},
+		{"eddsa", eddsaToken, nil},
+		{"within leeway", sign(Claims{ExpiresAt: now.Add(-Leeway / 2).Unix()}, keys["hs256"]), nil},
+		{"without expiration", sign(Claims{Subject: "user"}, keys["hs256"]), nil},
+		{"expired", sign(Claims{ExpiresAt: now.Add(-2 * Leeway).Unix()}, keys["eddsa"]), ErrExpired},
+		{"not yet valid", sign(Claims{NotBefore: now.Add(2 * Leeway).Unix()}, keys["hs256"]), ErrNotYetValid},
+		{"unknown kid", sign(valid, NewHS256Key("other", []byte(strings.Repeat("k", 32)))), ErrUnknownKey},
+		{"algorithm confusion", confused, ErrUnknownKey},
+		{"hs256 header on eddsa key", forge(t, Header{Algorithm: AlgorithmHS256, KeyID: "eddsa"}, valid, keys["hs256"]), ErrUnknownKey},
+		{"none algorithm", forge(t, Header{Algorithm: "none", KeyID: "hs256"}, valid, keys["hs256"]), ErrUnknownAlgorithm},
+		{"other hs256 secret", sign(valid, NewHS256Key("hs256", []byte(strings.Repeat("x", 32)))), ErrInvalidSignature},
+		{"tampered payload", tampered, ErrInvalidSignature},
+		{"two segments", segments[0] + "." + segments[1], ErrMalformed},
+		{"invalid header", "e30K!." + segments[1] + "." + segments[2], ErrMalformed},
+	}
+
+	for _, test := range tests {
+
+		var claims Claims
+		_, err := Parse(test.token, testKeyFunc(keys), &claims)
+
+		if err != test.err {
+			t.Errorf("%s : got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseDecodesClaims(t *testing.T) {
+
+	keys := testKeys(t)
+
+	token, err := Sign(TypeAccessToken, Claims{Issuer: "issuer", Subject: "user", Audience: "client"}, keys["eddsa"])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims Claims
+	header, err := Parse(token, testKeyFunc(keys), &claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Type != TypeAccessToken || header.KeyID != "eddsa" || header.Algorithm != AlgorithmEdDSA {
+		t.Errorf("got header %+v", header)
+	}
+
+	if claims.Issuer != "issuer" || claims.Subject != "user" || claims.Audience != "client" {
+		t.Errorf("got claims %+v", claims)
+	}
+}
+
+func TestClaimsValid(t *testing.T) {
+
+	now := time.Unix(1000000, 0)
+
+	tests := []struct {
+		name   string
+		claims Claims
+		err    error
+	}{
+		{"no time claims", Claims{}, nil},
+		{"expires later", Claims{ExpiresAt: now.Unix() + 1}, nil},
+		{"expired within leeway", Claims{ExpiresAt: now.Add(-Leeway).Unix() + 1}, nil},
+		{"expired at leeway", Claims{ExpiresAt: now.Add(-Leeway).Unix()}, ErrExpired},
+		{"valid from within leeway", Claims{NotBefore: now.Add(Leeway).Unix()}, nil},
+		{"valid from after leeway", Claims{NotBefore: now.Add(Leeway).Unix() + 1}, ErrNotYetValid},
+	}
+
+	for _, test := range tests {
+		if err := test.claims.Valid(now); err != test.err {
+			t.Errorf("%s : got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package jwt
+
+import (
+	bytes "bytes"
+	pem "encoding/pem"
+	errors "errors"
+
+	ed25519 "golang.org/x/crypto/ed25519"
+)
+
+// pkcs8Ed25519Prefix : DER prefix of PKCS #8 Ed25519 private keys (RFC 8410), followed by the 32 bytes seed
+var pkcs8Ed25519Prefix = []byte{0x30, 0x2e, 0x02, 0x01, 0x00, 0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70, 0x04, 0x22, 0x04, 0x20}
+
+// ParseEdDSAPrivateKeyPEM : Seed of a PEM encoded PKCS #8 Ed25519 private key, as generated by
+// openssl genpkey -algorithm ed25519
+func ParseEdDSAPrivateKeyPEM(data []byte) ([]byte, error) {
+
+	block, _ := pem.Decode(data)
+
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("PEM encoded PRIVATE KEY block expected")
+	}
+
+	if len(block.Bytes) != len(pkcs8Ed25519Prefix)+ed25519.SeedSize || !bytes.HasPrefix(block.Bytes, pkcs8Ed25519Prefix) {
+		return nil, errors.New("PKCS #8 Ed25519 private key expected")
+	}
+
+	return block.Bytes[len(pkcs8Ed25519Prefix):], nil
+}
@@ -6,8 +6,11 @@ import (
 	fmt "fmt"
 	log "log"
 	os "os"
+	signal "os/signal"
+	syscall "syscall"
 
 	// Project Libs
+	auth "vulnlabs-rest-api/auth"
 	models "vulnlabs-rest-api/models"
 	router "vulnlabs-rest-api/router"
 )
@@ -31,6 +34,8 @@ func main() {
 	}
 
 	gorm := models.NewGORM(GORMConnectionURL)
+
+	// Redis is required whatever the session store, see models.SessionsConfig
 	redis := models.NewRedis(RedisURL, RedisPassword)
 
 	// Add interfaces & blank config to the environment
@@ -48,6 +53,70 @@ func main() {
 		log.Fatalf(err.Error())
 	}
 
+	// Keys signing issued tokens
+	env.KeyRing, err = models.NewKeyRing(env.Config.SigningKeys)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// ID tokens must be verifiable by relying parties
+	err = models.CheckIDTokenSigningKey(env.Config.OAuth, env.KeyRing)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	go reloadKeyRingOnHangup(env.KeyRing)
+
+	// Session store is selected in config
+	env.Sessions, err = models.NewSessionStore(redis, &env.Config.Sessions, env.KeyRing)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// OAuth tokens are signed by the same key ring as sessions
+	env.OAuth = models.NewOAuthTokenStore(redis, &env.Config.OAuth, env.KeyRing)
+
+	// External identity providers users can log in with
+	env.Federation = models.NewFederation(redis, &env.Config.Federation)
+
+	// Rate limiter store is selected in config
+	env.RateLimiter, err = models.NewRateLimiter(redis, &env.Config.RateLimiting)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Mailer backend is selected in config
+	env.Mailer, err = models.NewMailer(env.Config.Mailer)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Fail fast on invalid password hashing config
+	_, err = auth.NewHasher(env.Config.PasswordHashing)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Fail fast on invalid MFA encryption key, TOTP secrets could neither be stored nor read
+	_, err = auth.NewSecretsCipher(env.Config.MFA)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	// Load breached passwords once, new passwords are checked against them
+	err = auth.LoadBreachedPasswords(env.Config.PasswordPolicy.BreachedPasswordsFile)
+
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
 	router.Listen(env)
 
 	defer func() {
@@ -55,3 +124,38 @@ func main() {
 		redis.CloseConnection()
 	}()
 }
+
+// reloadKeyRingOnHangup : Reload signing keys from config on SIGHUP, so that they can be rotated without restart
+func reloadKeyRingOnHangup(keyRing *models.KeyRing) {
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	for range hangups {
+
+		config, err := models.ReadConfig()
+
+		// Reloaded keys must still sign verifiable ID tokens
+		if err == nil {
+
+			var candidate *models.KeyRing
+
+			candidate, err = models.NewKeyRing(config.SigningKeys)
+
+			if err == nil {
+				err = models.CheckIDTokenSigningKey(config.OAuth, candidate)
+			}
+		}
+
+		if err == nil {
+			err = keyRing.Load(config.SigningKeys)
+		}
+
+		if err != nil {
+			log.Printf("Could not reload signing keys, keeping current ones : %v", err)
+			continue
+		}
+
+		log.Printf("Signing keys reloaded")
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	driver "database/sql/driver"
+	fmt "fmt"
+	strings "strings"
+	time "time"
+	utils "vulnlabs-rest-api/utils"
+
+	gormlib "github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// APIKeyLastUsedThrottle : Last use of a key is recorded at most once a minute
+	APIKeyLastUsedThrottle = time.Minute
+)
+
+// APIKey : User-owned key authenticating machine-to-machine requests as "Authorization: Bearer <key>".
+// Only its hash is stored, Prefix identifies it for display & lookup
+type APIKey struct {
+	ID         string       `json:"id" gorm:"primary_key;unique;not null;"`
+	UserID     string       `json:"-" gorm:"not null;index;"`
+	Name       string       `json:"name" gorm:"not null;"`
+	Prefix     string       `json:"prefix" gorm:"not null;unique;"`
+	KeyHash    string       `json:"-" gorm:"not null;"`
+	Scopes     APIKeyScopes `json:"scopes" gorm:"type:varchar(1024);not null;"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ExpiresAt  *time.Time   `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt"`
+}
+
+// BeforeCreate : Run before DB Insertion
+func (apiKey *APIKey) BeforeCreate(scope *gormlib.Scope) error {
+
+	apiKey.ID = uuid.NewV4().String()
+
+	return nil
+}
+
+// APIKeyScopes : Permissions an API key is restricted to, stored space separated
+type APIKeyScopes []string
+
+// Value : Space separated scopes, for DB storage
+func (scopes APIKeyScopes) Value() (driver.Value, error) {
+
+	return SpaceSeparatedList(scopes).Value()
+}
+
+// Scan : Read space separated scopes from DB
+func (scopes *APIKeyScopes) Scan(value interface{}) error {
+
+	return (*SpaceSeparatedList)(scopes).Scan(value)
+}
+
+// SpaceSeparatedList : List of strings without spaces, stored space separated
+type SpaceSeparatedList []string
+
+// Value : Space separated list, for DB storage
+func (list SpaceSeparatedList) Value() (driver.Value, error) {
+
+	return strings.Join(list, " "), nil
+}
+
+// Scan : Read space separated list from DB
+func (list *SpaceSeparatedList) Scan(value interface{}) error {
+
+	var stored string
+
+	switch value := value.(type) {
+	case []byte:
+		stored = string(value)
+	case string:
+		stored = value
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into a space separated list", value)
+	}
+
+	*list = strings.Fields(stored)
+
+	return nil
+}
+
+// Allow : Check wether scopes grant permission
+func (scopes APIKeyScopes) Allow(permission string) bool {
+
+	return utils.IsStringIn(PermissionAll, scopes) || utils.IsStringIn(permission, scopes)
+}
+
+// Expired : Check wether key expired at now
+func (apiKey *APIKey) Expired(now time.Time) bool {
+
+	return apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt)
+}
+
+// APIKeyCreateRequest : API key creation request body. Key never expires if ExpiresAt is not set
+type APIKeyCreateRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"max=32"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreatedAPIKey : API key returned at creation, the only time the key is returned in clear
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -1,8 +1,86 @@
 package models
 
 var (
-	// TokenExpirationInMinutes : 30min
+	// TokenExpirationInMinutes : 30min (default session idle timeout)
 	TokenExpirationInMinutes = 30
+
+	// SessionAbsoluteTimeoutInMinutes : 12h
+	SessionAbsoluteTimeoutInMinutes = 12 * 60
+
+	// SessionRefreshThrottleInSeconds : Idle expiration is slid at most once a minute
+	SessionRefreshThrottleInSeconds = 60
+
+	// JWTAccessTokenExpirationInSeconds : 5min, access tokens cannot be revoked before
+	JWTAccessTokenExpirationInSeconds = 5 * 60
+
+	// OAuthAuthorizationCodeExpirationInSeconds : 1min, codes are exchanged right after the redirect
+	OAuthAuthorizationCodeExpirationInSeconds = 60
+
+	// OAuthAccessTokenExpirationInSeconds : 10min
+	OAuthAccessTokenExpirationInSeconds = 10 * 60
+
+	// OAuthRefreshTokenExpirationInDays : 30 days
+	OAuthRefreshTokenExpirationInDays = 30
+
+	// FederationStateExpirationInSeconds : 10min to log in at the external provider
+	FederationStateExpirationInSeconds = 10 * 60
+
+	// PasswordMinLength : NIST SP 800-63B recommends at least 8
+	PasswordMinLength = 10
+
+	// PasswordMinCharacterClasses : e.g. lowercase & digits
+	PasswordMinCharacterClasses = 2
+
+	// PasswordMinScore : Safely unguessable (~10^8 guesses and more)
+	PasswordMinScore = 3
+
+	// LoginLockoutAccountFreeAttempts : Wrong passwords allowed per account before lockout
+	LoginLockoutAccountFreeAttempts = 5
+
+	// LoginLockoutIPFreeAttempts : Failed logins allowed per IP before lockout, whatever the account
+	LoginLockoutIPFreeAttempts = 20
+
+	// LoginLockoutBaseDelayInSeconds : 1s, 2s, 4s...
+	LoginLockoutBaseDelayInSeconds = 1
+
+	// LoginLockoutMaxDelayInSeconds : 15min
+	LoginLockoutMaxDelayInSeconds = 15 * 60
+
+	// LoginLockoutFailuresExpirationInMinutes : 1h
+	LoginLockoutFailuresExpirationInMinutes = 60
+
+	// RateLimitGlobalRequests : Requests allowed per client & RateLimitGlobalWindowInSeconds on all routes
+	RateLimitGlobalRequests = 300
+
+	// RateLimitGlobalWindowInSeconds : 1min
+	RateLimitGlobalWindowInSeconds = 60
+
+	// APIKeysMaxPerUser : API keys a user may own
+	APIKeysMaxPerUser = 20
+
+	// MFAChallengeExpirationInSeconds : 5min to enter the second factor
+	MFAChallengeExpirationInSeconds = 300
+
+	// MFAMaxChallengeAttempts : Wrong codes allowed per challenge
+	MFAMaxChallengeAttempts = 5
+
+	// MFARecoveryCodesCount : Recovery codes generated at enrollment
+	MFARecoveryCodesCount = 10
+
+	// PasswordResetTokenExpirationInMinutes : 30min
+	PasswordResetTokenExpirationInMinutes = 30
+
+	// EmailVerificationTokenExpirationInMinutes : 24h
+	EmailVerificationTokenExpirationInMinutes = 24 * 60
+
+	// MailerSendAttempts : Emails are retried twice on transient failures
+	MailerSendAttempts = 3
+
+	// MailerRetryDelayInMilliseconds : 1s, then 2s
+	MailerRetryDelayInMilliseconds = 1000
+
+	// SMTPTimeoutInSeconds : Bound of a whole SMTP dialog
+	SMTPTimeoutInSeconds = 10
 )
 
 // UserCredentials : Models the structure of user credentials in login request body
@@ -17,7 +95,75 @@ type UserInfos struct {
 }
 
 // ChangePasswordRequest : Change password request body
+// Other sessions are always revoked, the current one only if RevokeCurrentSession is set
 type ChangePasswordRequest struct {
-	OldPassword string `json:"oldPassword"`
-	NewPassword string `json:"newPassword"`
+	OldPassword          string `json:"oldPassword" validate:"required"`
+	NewPassword          string `json:"newPassword" validate:"required,max=128"`
+	RevokeCurrentSession bool   `json:"revokeCurrentSession"`
+}
+
+// SessionRefreshRequest : Session refresh request body, for clients not storing the refresh token in cookie
+type SessionRefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// SessionResponse : Credentials returned on login & session refresh.
+// RefreshToken is only set by session stores issuing access tokens separately
+type SessionResponse struct {
+	Session      string `json:"session"`
+	CSRFToken    string `json:"csrfToken"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// MFASessionRequest : Second factor submitted to complete a pending login.
+// Either a TOTP code or a recovery code must be provided
+type MFASessionRequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// MFACodeRequest : Second factor request body (TOTP code or recovery code)
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// MFARecoveryCodes : Recovery codes, returned in clear only once at generation
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// MFARecoveryCodesStatus : Number of unused recovery codes
+type MFARecoveryCodesStatus struct {
+	Remaining int `json:"remaining"`
+}
+
+// MFAEnrollment : Secret & provisioning URI returned at MFA enrollment
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// PasswordResetRequest : Password reset request body
+type PasswordResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordResetConfirmRequest : Password reset confirmation request body
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,max=128"`
+}
+
+// EmailVerificationConfirmRequest : Email verification confirmation request body
+type EmailVerificationConfirmRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// EmailVerification : Stored behind a verification token, binding it to the address it was sent to
+type EmailVerification struct {
+	UserID string `json:"userID"`
+	Email  string `json:"email"`
 }
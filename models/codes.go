@@ -0,0 +1,16 @@
+package models
+
+// Response codes complementing the customhttpresponse ones
+const (
+	// CodeForbidden : Authenticated but not allowed to perform the action
+	CodeForbidden = "FORBIDDEN"
+
+	// CodeInvalidCSRFToken : Missing or wrong CSRF token on a cookie-authenticated mutation
+	CodeInvalidCSRFToken = "INVALID_CSRF_TOKEN"
+
+	// CodeLockedOut : Too many failed logins, retry after the delay given in the Retry-After header
+	CodeLockedOut = "LOCKED_OUT"
+
+	// CodeRateLimited : Too many requests, retry after the delay given in the Retry-After header
+	CodeRateLimited = "RATE_LIMITED"
+)
@@ -4,6 +4,7 @@ import (
 	json "encoding/json"
 	ioutil "io/ioutil"
 	os "os"
+	time "time"
 )
 
 var (
@@ -15,36 +16,641 @@ var (
 // Env : Execution environment containing Datastore communication interfaces & Config
 type Env struct {
 	// Add Databases communication interfaces here
-	GORM   GORMInterface
-	Redis  RedisInterface
-	Config Config
+	GORM        GORMInterface
+	Redis       RedisInterface
+	Sessions    SessionStore
+	KeyRing     *KeyRing
+	OAuth       *OAuthTokenStore
+	Federation  *Federation
+	Mailer      Mailer
+	RateLimiter RateLimiter
+	Config      Config
 }
 
 // Config : Global Config
 type Config struct {
 	// Add config structures here
-	Service       string   `json:"service"`
-	ListeningPort int      `json:"listeningPort"`
-	AdminUsers    []string `json:"adminUsers"`
+	Service         string                `json:"service"`
+	ListeningPort   int                   `json:"listeningPort"`
+	AdminUsers      []string              `json:"adminUsers"`
+	PasswordHashing PasswordHashingConfig `json:"passwordHashing"`
+	PasswordPolicy  PasswordPolicyConfig  `json:"passwordPolicy"`
+	LoginLockout    LoginLockoutConfig    `json:"loginLockout"`
+	RateLimiting    RateLimitingConfig    `json:"rateLimiting"`
+	APIKeys         APIKeysConfig         `json:"apiKeys"`
+	MFA             MFAConfig             `json:"mfa"`
+	Sessions        SessionsConfig        `json:"sessions"`
+	SigningKeys     KeyRingConfig         `json:"signingKeys"`
+	OAuth           OAuthConfig           `json:"oauth"`
+	Federation      FederationConfig      `json:"federation"`
+
+	// Role -> granted permissions, overriding DefaultRolePermissions
+	Roles map[string][]string `json:"roles"`
+
+	PasswordReset     PasswordResetConfig     `json:"passwordReset"`
+	EmailVerification EmailVerificationConfig `json:"emailVerification"`
+	Mailer            MailerConfig            `json:"mailer"`
 }
 
-// RefreshConfig : Load current environment values in config
-func (env *Env) RefreshConfig() error {
+// PasswordHashingConfig : Algorithm used to hash new passwords & its parameters
+// Zero values fall back to the defaults defined in the auth package
+type PasswordHashingConfig struct {
+	// One of "bcrypt", "argon2id" or "scrypt"
+	Algorithm  string         `json:"algorithm"`
+	BcryptCost int            `json:"bcryptCost"`
+	Argon2id   Argon2idConfig `json:"argon2id"`
+	Scrypt     ScryptConfig   `json:"scrypt"`
+}
+
+// Argon2idConfig : Argon2id parameters
+type Argon2idConfig struct {
+	Time        uint32 `json:"time"`
+	MemoryInKiB uint32 `json:"memoryInKiB"`
+	Threads     uint8  `json:"threads"`
+	SaltLength  uint32 `json:"saltLength"`
+	KeyLength   uint32 `json:"keyLength"`
+}
+
+// ScryptConfig : Scrypt parameters (N must be a power of 2)
+type ScryptConfig struct {
+	N          int `json:"n"`
+	R          int `json:"r"`
+	P          int `json:"p"`
+	SaltLength int `json:"saltLength"`
+	KeyLength  int `json:"keyLength"`
+}
+
+// PasswordPolicyConfig : Requirements for new passwords. Zero values fall back to the defaults
+type PasswordPolicyConfig struct {
+	MinLength int `json:"minLength"`
+
+	// Among lowercase, uppercase, digits & symbols
+	MinCharacterClasses int `json:"minCharacterClasses"`
+
+	// Minimum strength score, from 0 (too guessable) to 4 (very unguessable)
+	MinScore int `json:"minScore"`
+
+	// Allow passwords containing the user email or name
+	AllowPersonalInfo bool `json:"allowPersonalInfo"`
+
+	// File of breached passwords SHA-1 hashes, one hex hash per line optionally followed by ":<count>"
+	// as in the Have I Been Pwned downloadable lists. No check if empty
+	BreachedPasswordsFile string `json:"breachedPasswordsFile"`
+}
+
+// Length : Minimum password length, defaults to PasswordMinLength
+func (config PasswordPolicyConfig) Length() int {
+
+	if config.MinLength <= 0 {
+		return PasswordMinLength
+	}
+
+	return config.MinLength
+}
+
+// CharacterClasses : Minimum character classes, defaults to PasswordMinCharacterClasses
+func (config PasswordPolicyConfig) CharacterClasses() int {
+
+	if config.MinCharacterClasses <= 0 {
+		return PasswordMinCharacterClasses
+	}
+
+	return config.MinCharacterClasses
+}
+
+// Score : Minimum strength score, defaults to PasswordMinScore
+func (config PasswordPolicyConfig) Score() int {
+
+	if config.MinScore <= 0 {
+		return PasswordMinScore
+	}
+
+	return config.MinScore
+}
+
+// LoginLockoutConfig : Brute-force protection of logins. Past the free attempts, each failure locks logins
+// of the account (or from the IP) for an exponentially growing delay. Zero values fall back to the defaults
+type LoginLockoutConfig struct {
+	// Failures allowed per account / per IP before being locked out
+	AccountFreeAttempts int `json:"accountFreeAttempts"`
+	IPFreeAttempts      int `json:"ipFreeAttempts"`
+
+	// First lockout delay, doubled on each following failure up to the max delay
+	BaseDelayInSeconds int `json:"baseDelayInSeconds"`
+	MaxDelayInSeconds  int `json:"maxDelayInSeconds"`
+
+	// Failures are forgotten after this period without failure
+	FailuresExpirationInMinutes int `json:"failuresExpirationInMinutes"`
+}
+
+// AccountAttempts : Free attempts per account, defaults to LoginLockoutAccountFreeAttempts
+func (config LoginLockoutConfig) AccountAttempts() int {
+
+	if config.AccountFreeAttempts <= 0 {
+		return LoginLockoutAccountFreeAttempts
+	}
+
+	return config.AccountFreeAttempts
+}
+
+// IPAttempts : Free attempts per IP, defaults to LoginLockoutIPFreeAttempts
+func (config LoginLockoutConfig) IPAttempts() int {
+
+	if config.IPFreeAttempts <= 0 {
+		return LoginLockoutIPFreeAttempts
+	}
+
+	return config.IPFreeAttempts
+}
+
+// FailuresExpiration : Failures counters lifetime, defaults to LoginLockoutFailuresExpirationInMinutes
+func (config LoginLockoutConfig) FailuresExpiration() time.Duration {
+
+	if config.FailuresExpirationInMinutes <= 0 {
+		return time.Duration(LoginLockoutFailuresExpirationInMinutes) * time.Minute
+	}
+
+	return time.Duration(config.FailuresExpirationInMinutes) * time.Minute
+}
+
+// Delay : Lockout delay after failures, given the free attempts. Zero while failures are within free attempts
+func (config LoginLockoutConfig) Delay(failures int, freeAttempts int) time.Duration {
+
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	base, max := config.BaseDelayInSeconds, config.MaxDelayInSeconds
+
+	if base <= 0 {
+		base = LoginLockoutBaseDelayInSeconds
+	}
+
+	if max <= 0 {
+		max = LoginLockoutMaxDelayInSeconds
+	}
+
+	delay := base
+
+	for i := freeAttempts + 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return time.Duration(delay) * time.Second
+}
+
+// RateLimitingConfig : Requests limits. Global limit applies to all requests of a client,
+// routes limits to the routes declaring them in router.Listen
+type RateLimitingConfig struct {
+	// One of "redis" or "memory"
+	Store string `json:"store"`
+
+	Disabled bool `json:"disabled"`
+
+	// Defaults to RateLimitGlobalRequests per RateLimitGlobalWindowInSeconds. Applied per IP before authentication,
+	// then per authenticated user unless By is "ip"
+	Global RateLimit `json:"global"`
+
+	// Route name -> limit, overriding the one declared in router.Listen
+	Routes map[string]RateLimit `json:"routes"`
+}
+
+// GlobalLimit : Limit of all requests of a client
+func (config RateLimitingConfig) GlobalLimit() RateLimit {
+
+	if !config.Global.Enabled() {
+		return RateLimit{
+			Requests:        RateLimitGlobalRequests,
+			WindowInSeconds: RateLimitGlobalWindowInSeconds,
+			By:              config.Global.By,
+		}
+	}
+
+	return config.Global
+}
+
+// RouteLimit : Configured limit of route, or its declared one
+func (config RateLimitingConfig) RouteLimit(route string, declared RateLimit) RateLimit {
+
+	if limit, ok := config.Routes[route]; ok {
+		return limit
+	}
+
+	return declared
+}
+
+// APIKeysConfig : API keys config
+type APIKeysConfig struct {
+	MaxKeysPerUser int `json:"maxKeysPerUser"`
+}
+
+// MaxPerUser : API keys a user may own, defaults to APIKeysMaxPerUser
+func (config APIKeysConfig) MaxPerUser() int {
+
+	if config.MaxKeysPerUser <= 0 {
+		return APIKeysMaxPerUser
+	}
+
+	return config.MaxKeysPerUser
+}
+
+// MFAConfig : Two-factor authentication config
+type MFAConfig struct {
+	// Issuer displayed in authenticator apps
+	Issuer string `json:"issuer"`
+
+	// Required. Base64 encoded 32 bytes AES key used to encrypt TOTP secrets at rest
+	EncryptionKey string `json:"encryptionKey"`
+
+	// File holding the raw 32 bytes key, instead of EncryptionKey
+	EncryptionKeyFile string `json:"encryptionKeyFile"`
+
+	// Lifetime of the "mfa pending" challenge issued at login
+	ChallengeExpirationInSeconds int `json:"challengeExpirationInSeconds"`
+
+	// Number of wrong codes after which the challenge is revoked
+	MaxChallengeAttempts int `json:"maxChallengeAttempts"`
+
+	// Number of recovery codes generated at enrollment
+	RecoveryCodesCount int `json:"recoveryCodesCount"`
+}
+
+// SessionsConfig : User sessions config
+type SessionsConfig struct {
+	// Session store backend, one of "redis" (default), "memory" (single-node deployments only)
+	// or "jwt" (stateless signed access tokens, with refresh tokens stored in Redis).
+	// Redis remains mandatory whatever the store : it also holds password reset & email verification tokens, MFA
+	// challenges, login lockouts, OAuth codes & grants and federated login states
+	Store string `json:"store"`
+
+	// Maximum number of concurrent sessions per user, least recently used ones are revoked beyond (0 means unlimited)
+	MaxSessionsPerUser int `json:"maxSessionsPerUser"`
+
+	// Session expires after this period of inactivity
+	IdleTimeoutInMinutes int `json:"idleTimeoutInMinutes"`
+
+	// Session expires after this period whatever the activity
+	AbsoluteTimeoutInMinutes int `json:"absoluteTimeoutInMinutes"`
+
+	// Minimum delay between two idle expiration refreshes of a session
+	RefreshThrottleInSeconds int `json:"refreshThrottleInSeconds"`
+
+	// Server secret used to HMAC session tokens before storing them (plain SHA-256 if empty)
+	TokenHashingSecret string `json:"tokenHashingSecret"`
+
+	// Access tokens of the "jwt" store. Idle & absolute timeouts apply to its refresh tokens
+	JWT JWTConfig `json:"jwt"`
+}
+
+// IdleTimeout : Idle timeout, defaults to TokenExpirationInMinutes
+func (config SessionsConfig) IdleTimeout() time.Duration {
+
+	if config.IdleTimeoutInMinutes <= 0 {
+		return time.Duration(TokenExpirationInMinutes) * time.Minute
+	}
+
+	return time.Duration(config.IdleTimeoutInMinutes) * time.Minute
+}
+
+// AbsoluteTimeout : Absolute timeout, defaults to SessionAbsoluteTimeoutInMinutes
+func (config SessionsConfig) AbsoluteTimeout() time.Duration {
+
+	if config.AbsoluteTimeoutInMinutes <= 0 {
+		return time.Duration(SessionAbsoluteTimeoutInMinutes) * time.Minute
+	}
+
+	return time.Duration(config.AbsoluteTimeoutInMinutes) * time.Minute
+}
+
+// RefreshThrottle : Refresh throttle, defaults to SessionRefreshThrottleInSeconds
+func (config SessionsConfig) RefreshThrottle() time.Duration {
+
+	if config.RefreshThrottleInSeconds <= 0 {
+		return time.Duration(SessionRefreshThrottleInSeconds) * time.Second
+	}
+
+	return time.Duration(config.RefreshThrottleInSeconds) * time.Second
+}
+
+// JWTConfig : Signed access tokens config. Tokens are signed by the key ring
+type JWTConfig struct {
+	// Issuer (iss claim) of the access tokens
+	Issuer string `json:"issuer"`
+
+	// Access tokens cannot be revoked, keep them short-lived
+	AccessTokenExpirationInSeconds int `json:"accessTokenExpirationInSeconds"`
+}
+
+// KeyRingConfig : Keys signing the tokens issued by the API. To rotate keys without invalidating issued tokens :
+// add the new key to all instances, then make it active, and expire the previous one once the tokens it signed have
+type KeyRingConfig struct {
+	// Key signing new tokens, the other ones are retired and only verify tokens
+	ActiveKeyID string `json:"activeKeyID"`
+
+	Keys []SigningKeyConfig `json:"keys"`
+}
+
+// SigningKeyConfig : Token signing key
+type SigningKeyConfig struct {
+	// Key ID (kid header)
+	ID string `json:"id"`
+
+	// One of "HS256" or "EdDSA"
+	Algorithm string `json:"algorithm"`
+
+	// Base64 encoded HS256 secret (at least 32 bytes), or Ed25519 private key seed (32 bytes)
+	Secret string `json:"secret"`
+
+	// File holding the key, instead of Secret : raw HS256 secret, or PEM encoded PKCS #8 Ed25519 private key
+	File string `json:"file"`
+
+	// Retired key is dropped past this date, the tokens it signed being expired by then (kept forever if unset)
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// AccessTokenExpiration : Access tokens lifetime, defaults to JWTAccessTokenExpirationInSeconds
+func (config JWTConfig) AccessTokenExpiration() time.Duration {
+
+	if config.AccessTokenExpirationInSeconds <= 0 {
+		return time.Duration(JWTAccessTokenExpirationInSeconds) * time.Second
+	}
+
+	return time.Duration(config.AccessTokenExpirationInSeconds) * time.Second
+}
+
+// OAuthConfig : OAuth authorization server config
+type OAuthConfig struct {
+	// Issuer identifier (iss claim) : public URL of this API, without trailing slash.
+	// Requires an active EdDSA signing key, so that relying parties can verify ID tokens with the published JWKS
+	Issuer string `json:"issuer"`
+
+	// Frontend login page, receiving the authorization request URL to return to as "returnTo" query parameter.
+	// Clients are answered login_required if empty
+	LoginURL string `json:"loginURL"`
+
+	// Frontend consent page, receiving the authorization request query parameters.
+	// Clients are answered consent_required if empty
+	ConsentURL string `json:"consentURL"`
+
+	AuthorizationCodeExpirationInSeconds int `json:"authorizationCodeExpirationInSeconds"`
+	AccessTokenExpirationInSeconds       int `json:"accessTokenExpirationInSeconds"`
+
+	// Grants expire after this period without refresh
+	RefreshTokenExpirationInDays int `json:"refreshTokenExpirationInDays"`
+}
+
+// AuthorizationCodeExpiration : Authorization codes lifetime, defaults to OAuthAuthorizationCodeExpirationInSeconds
+func (config OAuthConfig) AuthorizationCodeExpiration() time.Duration {
+
+	if config.AuthorizationCodeExpirationInSeconds <= 0 {
+		return time.Duration(OAuthAuthorizationCodeExpirationInSeconds) * time.Second
+	}
+
+	return time.Duration(config.AuthorizationCodeExpirationInSeconds) * time.Second
+}
+
+// AccessTokenExpiration : Access tokens lifetime, defaults to OAuthAccessTokenExpirationInSeconds
+func (config OAuthConfig) AccessTokenExpiration() time.Duration {
+
+	if config.AccessTokenExpirationInSeconds <= 0 {
+		return time.Duration(OAuthAccessTokenExpirationInSeconds) * time.Second
+	}
+
+	return time.Duration(config.AccessTokenExpirationInSeconds) * time.Second
+}
+
+// RefreshTokenExpiration : Refresh tokens lifetime, defaults to OAuthRefreshTokenExpirationInDays
+func (config OAuthConfig) RefreshTokenExpiration() time.Duration {
+
+	if config.RefreshTokenExpirationInDays <= 0 {
+		return time.Duration(OAuthRefreshTokenExpirationInDays) * 24 * time.Hour
+	}
+
+	return time.Duration(config.RefreshTokenExpirationInDays) * 24 * time.Hour
+}
+
+// FederationConfig : External OpenID Connect providers users can log in with
+type FederationConfig struct {
+	// Frontend page users are sent back to once logged in or linked. It receives "error" query parameter on failure,
+	// or "mfaToken" when the second factor of the user is required
+	RedirectURL string `json:"redirectURL"`
+
+	StateExpirationInSeconds int `json:"stateExpirationInSeconds"`
+
+	Providers []IdentityProviderConfig `json:"providers"`
+}
+
+// IdentityProviderConfig : External OpenID Connect provider, using the callback <oauth issuer>/v1/auth/federation/callback
+type IdentityProviderConfig struct {
+	// Identifier of the provider in requests & linked identities, must not change once identities are linked
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Provider metadata is discovered from <issuer>/.well-known/openid-configuration
+	Issuer string `json:"issuer"`
+
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+
+	// Requested scopes, openid being always requested. Defaults to email & profile
+	Scopes []string `json:"scopes"`
+
+	// Create users at their first login, instead of requiring identities to be linked from existing accounts.
+	// Only applies to identities whose email is verified by the provider, with TrustEmailVerified
+	AllowSignup bool `json:"allowSignup"`
+
+	// Trust the email_verified claim of the provider. Required for signup, as users are created under its email
+	TrustEmailVerified bool `json:"trustEmailVerified"`
+}
+
+// StateExpiration : Federated login state lifetime, defaults to FederationStateExpirationInSeconds
+func (config FederationConfig) StateExpiration() time.Duration {
+
+	if config.StateExpirationInSeconds <= 0 {
+		return time.Duration(FederationStateExpirationInSeconds) * time.Second
+	}
+
+	return time.Duration(config.StateExpirationInSeconds) * time.Second
+}
+
+// Provider : Configured provider of id
+func (config FederationConfig) Provider(id string) (*IdentityProviderConfig, bool) {
+
+	for i := range config.Providers {
+
+		if config.Providers[i].ID == id {
+			return &config.Providers[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// PasswordResetConfig : Password reset config
+type PasswordResetConfig struct {
+	// Frontend page receiving the token as "token" query parameter
+	URL string `json:"url"`
+
+	TokenExpirationInMinutes int `json:"tokenExpirationInMinutes"`
+}
+
+// TokenExpiration : Reset token lifetime, defaults to PasswordResetTokenExpirationInMinutes
+func (config PasswordResetConfig) TokenExpiration() time.Duration {
+
+	if config.TokenExpirationInMinutes <= 0 {
+		return time.Duration(PasswordResetTokenExpirationInMinutes) * time.Minute
+	}
+
+	return time.Duration(config.TokenExpirationInMinutes) * time.Minute
+}
+
+// EmailVerificationConfig : Email verification config
+type EmailVerificationConfig struct {
+	// Frontend page receiving the token as "token" query parameter
+	URL string `json:"url"`
+
+	TokenExpirationInMinutes int `json:"tokenExpirationInMinutes"`
+}
+
+// TokenExpiration : Verification token lifetime, defaults to EmailVerificationTokenExpirationInMinutes
+func (config EmailVerificationConfig) TokenExpiration() time.Duration {
+
+	if config.TokenExpirationInMinutes <= 0 {
+		return time.Duration(EmailVerificationTokenExpirationInMinutes) * time.Minute
+	}
+
+	return time.Duration(config.TokenExpirationInMinutes) * time.Minute
+}
+
+// MailerConfig : Outbound email backend & templates
+type MailerConfig struct {
+	// One of "smtp", "file" or "log" (recipients & subjects only, for development). Required
+	Backend string `json:"backend"`
+
+	From               string `json:"from"`
+	TemplatesDirectory string `json:"templatesDirectory"`
+
+	// Attempts & initial backoff delay when sending fails transiently
+	SendAttempts             int `json:"sendAttempts"`
+	RetryDelayInMilliseconds int `json:"retryDelayInMilliseconds"`
+
+	SMTP SMTPConfig `json:"smtp"`
+
+	File FileMailerConfig `json:"file"`
+}
+
+// FileMailerConfig : File sink settings
+type FileMailerConfig struct {
+	// Directory receiving one .eml file per email
+	Directory string `json:"directory"`
+}
+
+// SMTPConfig : SMTP relay settings
+type SMTPConfig struct {
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	StartTLS         bool   `json:"startTLS"`
+	TimeoutInSeconds int    `json:"timeoutInSeconds"`
+}
+
+// MaxAttempts : Send attempts, defaults to MailerSendAttempts
+func (config MailerConfig) MaxAttempts() int {
+
+	if config.SendAttempts <= 0 {
+		return MailerSendAttempts
+	}
+
+	return config.SendAttempts
+}
+
+// RetryDelay : Delay before the first retry, doubled on each attempt. Defaults to MailerRetryDelayInMilliseconds
+func (config MailerConfig) RetryDelay() time.Duration {
+
+	if config.RetryDelayInMilliseconds <= 0 {
+		return time.Duration(MailerRetryDelayInMilliseconds) * time.Millisecond
+	}
+
+	return time.Duration(config.RetryDelayInMilliseconds) * time.Millisecond
+}
+
+// Timeout : Connection & dialog timeout, defaults to SMTPTimeoutInSeconds
+func (config SMTPConfig) Timeout() time.Duration {
+
+	if config.TimeoutInSeconds <= 0 {
+		return time.Duration(SMTPTimeoutInSeconds) * time.Second
+	}
+
+	return time.Duration(config.TimeoutInSeconds) * time.Second
+}
+
+// ChallengeExpiration : Challenge lifetime in seconds, defaults to MFAChallengeExpirationInSeconds
+func (config MFAConfig) ChallengeExpiration() int {
+
+	if config.ChallengeExpirationInSeconds <= 0 {
+		return MFAChallengeExpirationInSeconds
+	}
+
+	return config.ChallengeExpirationInSeconds
+}
+
+// MaxAttempts : Allowed wrong codes per challenge, defaults to MFAMaxChallengeAttempts
+func (config MFAConfig) MaxAttempts() int {
+
+	if config.MaxChallengeAttempts <= 0 {
+		return MFAMaxChallengeAttempts
+	}
+
+	return config.MaxChallengeAttempts
+}
+
+// RecoveryCodes : Number of recovery codes to generate, defaults to MFARecoveryCodesCount
+func (config MFAConfig) RecoveryCodes() int {
+
+	if config.RecoveryCodesCount <= 0 {
+		return MFARecoveryCodesCount
+	}
+
+	return config.RecoveryCodesCount
+}
+
+// ReadConfig : Read config file, without applying it
+func ReadConfig() (*Config, error) {
 
 	data, err := ioutil.ReadFile(configFilePath)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = json.Unmarshal(data, &env.Config)
+	var config Config
+	err = json.Unmarshal(data, &config)
 
-	// GlobalConfig used for access in models
-	GlobalConfig = &env.Config
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// RefreshConfig : Load current environment values in config
+func (env *Env) RefreshConfig() error {
+
+	config, err := ReadConfig()
 
 	if err != nil {
 		return err
 	}
 
+	env.Config = *config
+
+	// GlobalConfig used for access in models
+	GlobalConfig = &env.Config
+
 	return nil
 }
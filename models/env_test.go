@@ -0,0 +1,33 @@
+package models
+
+import (
+	testing "testing"
+	time "time"
+)
+
+func TestLoginLockoutDelay(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		config       LoginLockoutConfig
+		failures     int
+		freeAttempts int
+		delay        time.Duration
+	}{
+		{"no failure", LoginLockoutConfig{}, 0, 5, 0},
+		{"within free attempts", LoginLockoutConfig{}, 5, 5, 0},
+		{"first lockout", LoginLockoutConfig{}, 6, 5, time.Duration(LoginLockoutBaseDelayInSeconds) * time.Second},
+		{"doubled", LoginLockoutConfig{}, 8, 5, 4 * time.Duration(LoginLockoutBaseDelayInSeconds) * time.Second},
+		{"default max", LoginLockoutConfig{}, 100, 5, time.Duration(LoginLockoutMaxDelayInSeconds) * time.Second},
+		{"configured base", LoginLockoutConfig{BaseDelayInSeconds: 10}, 7, 5, 20 * time.Second},
+		{"configured max", LoginLockoutConfig{BaseDelayInSeconds: 10, MaxDelayInSeconds: 30}, 9, 5, 30 * time.Second},
+		{"base beyond max", LoginLockoutConfig{BaseDelayInSeconds: 60, MaxDelayInSeconds: 30}, 6, 5, 30 * time.Second},
+		{"no free attempt", LoginLockoutConfig{BaseDelayInSeconds: 2}, 1, 0, 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		if delay := test.config.Delay(test.failures, test.freeAttempts); delay != test.delay {
+			t.Errorf("%s : got %s, want %s", test.name, delay, test.delay)
+		}
+	}
+}
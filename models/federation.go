@@ -0,0 +1,442 @@
+package models
+
+import (
+	sha256 "crypto/sha256"
+	base64 "encoding/base64"
+	json "encoding/json"
+	errors "errors"
+	fmt "fmt"
+	net "net"
+	http "net/http"
+	url "net/url"
+	strings "strings"
+	sync "sync"
+	time "time"
+	jwt "vulnlabs-rest-api/jwt"
+	utils "vulnlabs-rest-api/utils"
+
+	gormlib "github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Federated login storage layout in Redis :
+//   federation-state:<digest>:state -> JSON login state (single use, short-lived)
+//
+// Users are sent to the external provider with the authorization code flow, PKCE & a nonce. The ID token is received
+// directly from the provider token endpoint over TLS, which authenticates it (OpenID Connect Core section 3.1.3.7) :
+// discovery & token endpoints must be https, loopback providers aside
+
+const (
+	// FederationMetadataCacheDuration : Provider metadata is rediscovered at this interval
+	FederationMetadataCacheDuration = time.Hour
+
+	// FederationHTTPTimeout : Bound of requests to providers
+	FederationHTTPTimeout = 10 * time.Second
+)
+
+// Federated login error codes, sent to FederationConfig.RedirectURL as "error" query parameter
+const (
+	FederationErrorInvalidState    = "invalid_state"
+	FederationErrorProviderError   = "provider_error"
+	FederationErrorSignupDisabled  = "signup_disabled"
+	FederationErrorEmailRequired   = "email_required"
+	FederationErrorEmailUnverified = "email_unverified"
+	FederationErrorAccountExists   = "account_exists"
+	FederationErrorAccountDisabled = "account_disabled"
+	FederationErrorAlreadyLinked   = "already_linked"
+	FederationErrorServerError     = "server_error"
+)
+
+var (
+	ErrUnknownIdentityProvider = errors.New("Unknown identity provider")
+	ErrInvalidFederationState  = errors.New("Invalid or expired federated login state")
+)
+
+// ExternalIdentity : Identity of a user at an external OpenID Connect provider, logging the user in
+type ExternalIdentity struct {
+	ID        string    `json:"id" gorm:"primary_key;unique;not null;"`
+	UserID    string    `json:"-" gorm:"not null;index;"`
+	Provider  string    `json:"provider" gorm:"not null;unique_index:idx_external_identity;"`
+	Subject   string    `json:"subject" gorm:"not null;unique_index:idx_external_identity;"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BeforeCreate : Run before DB Insertion
+func (identity *ExternalIdentity) BeforeCreate(scope *gormlib.Scope) error {
+
+	identity.ID = uuid.NewV4().String()
+
+	return nil
+}
+
+// IdentityProviderInfo : Public infos of a configured provider, for the login page
+type IdentityProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ExternalIdentityLinkRequest : Request body to link an external identity to the current user
+type ExternalIdentityLinkRequest struct {
+	Provider string `json:"provider" validate:"required,max=64"`
+}
+
+// FederationAuthorizationRedirect : Where to send the user agent to link an external identity
+type FederationAuthorizationRedirect struct {
+	AuthorizationURL string `json:"authorizationURL"`
+}
+
+// FederationState : Pending federated login, stored behind the state parameter
+type FederationState struct {
+	ProviderID   string `json:"providerID"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+
+	// Set when linking an identity to this user rather than logging in
+	LinkUserID string `json:"linkUserID,omitempty"`
+}
+
+// ExternalIDTokenClaims : Claims of the ID tokens of external providers
+type ExternalIDTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      Audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+}
+
+// Audience : aud claim, a single string or an array of strings
+type Audience []string
+
+// UnmarshalJSON : Decode a string or an array of strings
+func (audience *Audience) UnmarshalJSON(data []byte) error {
+
+	var single string
+
+	if json.Unmarshal(data, &single) == nil {
+		*audience = Audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(audience))
+}
+
+// Valid : Check the token is not expired at now
+func (claims *ExternalIDTokenClaims) Valid(now time.Time) error {
+
+	if claims.ExpiresAt == 0 || !now.Add(-jwt.Leeway).Before(time.Unix(claims.ExpiresAt, 0)) {
+		return jwt.ErrExpired
+	}
+
+	return nil
+}
+
+// Federation : Client of the external OpenID Connect providers of config
+type Federation struct {
+	Redis  RedisInterface
+	Config *FederationConfig
+	Client *http.Client
+
+	mutex sync.Mutex
+
+	// Provider ID -> discovered metadata
+	metadata map[string]*discoveredProvider
+}
+
+// discoveredProvider : Provider metadata & when it was fetched
+type discoveredProvider struct {
+	*OpenIDConfiguration
+	FetchedAt time.Time
+}
+
+// NewFederation : Return a new client of the providers of config
+func NewFederation(redis RedisInterface, config *FederationConfig) *Federation {
+
+	return &Federation{
+		Redis:    redis,
+		Config:   config,
+		Client:   &http.Client{Timeout: FederationHTTPTimeout},
+		metadata: map[string]*discoveredProvider{},
+	}
+}
+
+// AuthorizationURL : Start a federated login at provider, returning the URL to send the user agent to and the
+// state it must come back with. Identity is linked to linkUserID if not empty
+func (federation *Federation) AuthorizationURL(provider *IdentityProviderConfig, callbackURL string, linkUserID string) (string, string, error) {
+
+	metadata, err := federation.discover(provider)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := generateOAuthToken()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	codeVerifier, err := generateOAuthToken()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := federation.createState(&FederationState{
+		ProviderID:   provider.ID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	scopes := provider.Scopes
+
+	if len(scopes) == 0 {
+		scopes = []string{OIDCScopeEmail, OIDCScopeProfile}
+	}
+
+	if !utils.IsStringIn(OIDCScopeOpenID, scopes) {
+		scopes = append([]string{OIDCScopeOpenID}, scopes...)
+	}
+
+	authorizationURL, err := url.Parse(metadata.AuthorizationEndpoint)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	query := authorizationURL.Query()
+	query.Set("response_type", OAuthResponseTypeCode)
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", callbackURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", federationCodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", OAuthCodeChallengeMethodS256)
+	authorizationURL.RawQuery = query.Encode()
+
+	return authorizationURL.String(), state, nil
+}
+
+// ConsumeState : Read & delete the pending login of state
+func (federation *Federation) ConsumeState(state string) (*FederationState, error) {
+
+	storageKey := federationStateStorageKey(oauthTokenDigest(state))
+
+	results, err := federation.Redis.Multi([]RedisCommand{
+		RedisCommand{Command: "GET", Args: []interface{}{storageKey}},
+		RedisCommand{Command: "DEL", Args: []interface{}{storageKey}},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := results[0].([]byte)
+
+	if !ok {
+		return nil, ErrInvalidFederationState
+	}
+
+	var federationState FederationState
+
+	err = json.Unmarshal(data, &federationState)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &federationState, nil
+}
+
+// Exchange : Exchange the authorization code of the pending login at provider for the claims of the user ID token
+func (federation *Federation) Exchange(provider *IdentityProviderConfig, callbackURL string, code string, federationState *FederationState) (*ExternalIDTokenClaims, error) {
+
+	metadata, err := federation.discover(provider)
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {OAuthGrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {callbackURL},
+		"code_verifier": {federationState.CodeVerifier},
+	}
+
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+
+	response, err := federation.Client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+		OAuthErrorResponse
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&tokenResponse)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid token response of provider %s : %v", provider.ID, err)
+	}
+
+	if response.StatusCode != http.StatusOK || tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("provider %s rejected the authorization code : %s %s", provider.ID, tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+
+	var claims ExternalIDTokenClaims
+
+	err = jwt.ParseUnverified(tokenResponse.IDToken, &claims)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != metadata.Issuer || !utils.IsStringIn(provider.ClientID, claims.Audience) || claims.Subject == "" {
+		return nil, fmt.Errorf("ID token of provider %s was not issued to this API", provider.ID)
+	}
+
+	if claims.Nonce != federationState.Nonce {
+		return nil, fmt.Errorf("ID token of provider %s does not match the login", provider.ID)
+	}
+
+	return &claims, nil
+}
+
+// createState : Store a pending login behind a new state
+func (federation *Federation) createState(federationState *FederationState) (string, error) {
+
+	state, err := generateOAuthToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(federationState)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = federation.Redis.SetWithExpiration(federationStateStorageKey(oauthTokenDigest(state)), data, int(federation.Config.StateExpiration().Seconds()))
+
+	if err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// discover : Metadata of provider, fetched from its discovery document unless cached
+func (federation *Federation) discover(provider *IdentityProviderConfig) (*OpenIDConfiguration, error) {
+
+	federation.mutex.Lock()
+	defer federation.mutex.Unlock()
+
+	if cached, ok := federation.metadata[provider.ID]; ok && time.Since(cached.FetchedAt) < FederationMetadataCacheDuration {
+		return cached.OpenIDConfiguration, nil
+	}
+
+	if !isSecureFederationEndpoint(provider.Issuer) {
+		return nil, fmt.Errorf("issuer of provider %s must be https", provider.ID)
+	}
+
+	response, err := federation.Client.Get(strings.TrimSuffix(provider.Issuer, "/") + "/.well-known/openid-configuration")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery of provider %s failed with status %d", provider.ID, response.StatusCode)
+	}
+
+	var metadata OpenIDConfiguration
+
+	err = json.NewDecoder(response.Body).Decode(&metadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Metadata must be the one of the configured issuer (OpenID Connect Discovery section 4.3)
+	if metadata.Issuer != provider.Issuer || metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("invalid discovery document of provider %s", provider.ID)
+	}
+
+	// ID tokens are authenticated by the TLS connection to the token endpoint only
+	if !isSecureFederationEndpoint(metadata.TokenEndpoint) {
+		return nil, fmt.Errorf("token endpoint of provider %s must be https", provider.ID)
+	}
+
+	federation.metadata[provider.ID] = &discoveredProvider{
+		OpenIDConfiguration: &metadata,
+		FetchedAt:           time.Now(),
+	}
+
+	return &metadata, nil
+}
+
+// isSecureFederationEndpoint : Check wether endpoint is an https URL, or an http one of a loopback host
+func isSecureFederationEndpoint(endpoint string) bool {
+
+	parsed, err := url.Parse(endpoint)
+
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	if parsed.Scheme == "https" {
+		return true
+	}
+
+	if parsed.Scheme != "http" {
+		return false
+	}
+
+	host := parsed.Hostname()
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// federationCodeChallenge : S256 PKCE code challenge of verifier, as auth.PKCECodeChallenge (auth imports models)
+func federationCodeChallenge(verifier string) string {
+
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func federationStateStorageKey(stateDigest string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisFederationStatePrefix, stateDigest, RedisFederationStateSuffix)
+}
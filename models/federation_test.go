@@ -0,0 +1,175 @@
+package models
+
+import (
+	base64 "encoding/base64"
+	json "encoding/json"
+	http "net/http"
+	httptest "net/http/httptest"
+	reflect "reflect"
+	testing "testing"
+	time "time"
+)
+
+func TestExternalIDTokenClaimsDecoding(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		json     string
+		valid    bool
+		audience Audience
+		verified bool
+	}{
+		{"single audience", `{"sub":"1","aud":"client","email_verified":true}`, true, Audience{"client"}, true},
+		{"audience array", `{"sub":"1","aud":["client","other"]}`, true, Audience{"client", "other"}, false},
+		{"empty audience array", `{"sub":"1","aud":[]}`, true, Audience{}, false},
+		{"no audience", `{"sub":"1"}`, true, nil, false},
+		{"numeric audience", `{"sub":"1","aud":42}`, false, nil, false},
+		{"audience object", `{"sub":"1","aud":{"client":true}}`, false, nil, false},
+		{"email_verified as string", `{"sub":"1","aud":"client","email_verified":"true"}`, false, nil, false},
+	}
+
+	for _, test := range tests {
+
+		var claims ExternalIDTokenClaims
+		err := json.Unmarshal([]byte(test.json), &claims)
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+			continue
+		}
+
+		if test.valid && (!reflect.DeepEqual(claims.Audience, test.audience) || claims.EmailVerified != test.verified) {
+			t.Errorf("%s : got audience %#v verified %t, want %#v %t", test.name, claims.Audience, claims.EmailVerified, test.audience, test.verified)
+		}
+	}
+}
+
+func TestExternalIDTokenClaimsValid(t *testing.T) {
+
+	now := time.Unix(1560000000, 0)
+
+	tests := []struct {
+		name      string
+		expiresAt int64
+		valid     bool
+	}{
+		{"not expired", now.Add(time.Minute).Unix(), true},
+		{"expired within leeway", now.Add(-time.Second).Unix(), true},
+		{"expired", now.Add(-time.Hour).Unix(), false},
+		{"without expiration", 0, false},
+	}
+
+	for _, test := range tests {
+
+		claims := &ExternalIDTokenClaims{ExpiresAt: test.expiresAt}
+
+		if err := claims.Valid(now); (err == nil) != test.valid {
+			t.Errorf("%s : got %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestIsSecureFederationEndpoint(t *testing.T) {
+
+	tests := []struct {
+		endpoint string
+		secure   bool
+	}{
+		{"https://idp.example.com/token", true},
+		{"https://idp.example.com:8443/token", true},
+		{"http://localhost:8090/default/token", true},
+		{"http://127.0.0.1:8090/token", true},
+		{"http://[::1]:8090/token", true},
+		{"http://idp.example.com/token", false},
+		{"http://localhost.example.com/token", false},
+		{"http://10.0.0.1/token", false},
+		{"ftp://idp.example.com/token", false},
+		{"/token", false},
+		{"https:///token", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if secure := isSecureFederationEndpoint(test.endpoint); secure != test.secure {
+			t.Errorf("%s : got %t, want %t", test.endpoint, secure, test.secure)
+		}
+	}
+}
+
+// unsignedIDToken : ID token of claims, as only decoded from token responses
+func unsignedIDToken(claims interface{}) string {
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, _ := json.Marshal(claims)
+
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestFederationExchange(t *testing.T) {
+
+	var issuer, tokenEndpoint string
+	var idTokenClaims map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(OpenIDConfiguration{
+				Issuer:                issuer,
+				AuthorizationEndpoint: issuer + "/authorize",
+				TokenEndpoint:         tokenEndpoint,
+			})
+		case "/token":
+			json.NewEncoder(w).Encode(map[string]string{"id_token": unsignedIDToken(idTokenClaims)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	defer server.Close()
+
+	issuer = server.URL
+	expiresAt := time.Now().Add(time.Minute).Unix()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"iss": issuer, "sub": "subject", "aud": "client", "exp": expiresAt, "nonce": "nonce"}
+	}
+
+	tests := []struct {
+		name          string
+		tokenEndpoint string
+		claims        func(claims map[string]interface{})
+		valid         bool
+	}{
+		{"valid", server.URL + "/token", func(claims map[string]interface{}) {}, true},
+		{"audience array", server.URL + "/token", func(claims map[string]interface{}) { claims["aud"] = []string{"other", "client"} }, true},
+		{"other audience", server.URL + "/token", func(claims map[string]interface{}) { claims["aud"] = "other" }, false},
+		{"other issuer", server.URL + "/token", func(claims map[string]interface{}) { claims["iss"] = "https://other.example.com" }, false},
+		{"other nonce", server.URL + "/token", func(claims map[string]interface{}) { claims["nonce"] = "replayed" }, false},
+		{"without subject", server.URL + "/token", func(claims map[string]interface{}) { delete(claims, "sub") }, false},
+		{"expired", server.URL + "/token", func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }, false},
+		{"plain http token endpoint", "http://idp.example.com/token", func(claims map[string]interface{}) {}, false},
+	}
+
+	for _, test := range tests {
+
+		tokenEndpoint = test.tokenEndpoint
+		idTokenClaims = valid()
+		test.claims(idTokenClaims)
+
+		// Metadata is discovered again for each test
+		federation := NewFederation(nil, &FederationConfig{})
+		provider := &IdentityProviderConfig{ID: "test", Issuer: issuer, ClientID: "client"}
+
+		claims, err := federation.Exchange(provider, "http://localhost/callback", "code", &FederationState{Nonce: "nonce"})
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+			continue
+		}
+
+		if test.valid && (claims.Subject != "subject" || claims.Issuer != issuer) {
+			t.Errorf("%s : got claims %+v", test.name, claims)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	fmt "fmt"
+	ioutil "io/ioutil"
+	log "log"
+	os "os"
+	filepath "path/filepath"
+	strings "strings"
+	time "time"
+)
+
+// FileMailer : Mailer writing each email as an .eml file in a directory, for development
+type FileMailer struct {
+	From      string
+	Directory string
+}
+
+// NewFileMailer : Return a new file mailer
+func NewFileMailer(from string, directory string) *FileMailer {
+
+	return &FileMailer{
+		From:      from,
+		Directory: directory,
+	}
+}
+
+// Send : Write message to <directory>/<timestamp>-<recipient>.eml
+func (mailer *FileMailer) Send(message *MailMessage) error {
+
+	data, err := buildMIMEMessage(mailer.From, message)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(mailer.Directory, 0700)
+
+	if err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.Join(message.To, "_"))
+	fileName := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+
+	return ioutil.WriteFile(filepath.Join(mailer.Directory, fileName), data, 0600)
+}
+
+// LogMailer : Mailer logging emails without sending them, for development.
+// Bodies carry single-use tokens (password resets, email verifications) : only recipients & subjects are logged
+type LogMailer struct{}
+
+// Send : Log email recipients & subject
+func (mailer *LogMailer) Send(message *MailMessage) error {
+
+	log.Printf("Mail to %s - %s", strings.Join(message.To, ", "), message.Subject)
+	return nil
+}
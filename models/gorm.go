@@ -2,6 +2,8 @@ package models
 
 import (
 	json "encoding/json"
+	strings "strings"
+	time "time"
 	utils "vulnlabs-rest-api/utils"
 
 	gormlib "github.com/jinzhu/gorm"
@@ -18,8 +20,31 @@ type GORMInterface interface {
 	CreateUser(userCreateRequestBody *UserCreateRequestBody) (*User, error)
 	ReadUserFromEmail(email string) (*User, error)
 	ReadUserFromID(id string) (*User, error)
+	ListUsers(query *UserListQuery) ([]User, string, error)
 	UpdateUserInfos(user *User, userUpdateRequestBody *UserUpdateRequestBody) error
-	UpdateUserPassword(newHashedPassword string) error
+	UpdateUserRole(user *User, role string) error
+	UpdateUserEmail(user *User, email string) error
+	UpdateUserDisabled(user *User, disabled bool) error
+	UpdateUserPassword(user *User, newHashedPassword string) error
+	UpdateUserMFA(user *User, encryptedSecret string, enabled bool) error
+	ReplaceRecoveryCodes(user *User, codeHashes []string) error
+	ConsumeRecoveryCode(user *User, codeHash string) (bool, error)
+	CountRecoveryCodes(user *User) (int, error)
+	CreateAPIKey(apiKey *APIKey) error
+	ReadAPIKeyFromPrefix(prefix string) (*APIKey, error)
+	ListUserAPIKeys(user *User) ([]APIKey, error)
+	UpdateAPIKeyLastUsed(apiKey *APIKey, lastUsedAt time.Time) error
+	DeleteUserAPIKey(user *User, id string) (bool, error)
+	DeleteUserAPIKeys(user *User) error
+	CreateOAuthClient(client *OAuthClient) error
+	ReadOAuthClientFromID(id string) (*OAuthClient, error)
+	ListOAuthClients() ([]OAuthClient, error)
+	DeleteOAuthClient(id string) (bool, error)
+	CreateExternalIdentity(identity *ExternalIdentity) error
+	ReadExternalIdentity(provider string, subject string) (*ExternalIdentity, error)
+	ListUserExternalIdentities(user *User) ([]ExternalIdentity, error)
+	DeleteUserExternalIdentity(user *User, id string) (bool, error)
+	DeleteUserExternalIdentities(user *User) error
 	DeleteUser(user *User) error
 	IsRecordNotFoundError(err error) bool
 }
@@ -46,7 +71,10 @@ func NewGORM(connectionURL string) *GORM {
 	db = db.Set("gorm:table_options", "ENGINE=InnoDB CHARSET=utf8 auto_increment=1").Set("gorm:auto_preload", true)
 
 	// Migrate DB Schemas
-	db.AutoMigrate(&User{})
+	db.AutoMigrate(&User{}, &RecoveryCode{}, &APIKey{}, &OAuthClient{}, &ExternalIdentity{})
+
+	// Users created before CreatedAt existed may have no creation date, which keyset pagination would skip
+	db.Model(&User{}).Where("created_at IS NULL").UpdateColumn("created_at", gormlib.Expr("CURRENT_TIMESTAMP"))
 
 	// Return new MongoDB abstraction struct
 	return &GORM{
@@ -95,6 +123,75 @@ func (gorm *GORM) ReadUserFromID(id string) (*User, error) {
 	return &user, gorm.Database.Where("id = ?", id).First(&user).Error
 }
 
+// ListUsers : Read a page of users matching query from DB. Returns the cursor of the next page, if any
+func (gorm *GORM) ListUsers(query *UserListQuery) ([]User, string, error) {
+
+	column, descending, err := query.SortColumn()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	db := gorm.Database
+
+	// Filters
+	if query.Email != "" {
+		db = db.Where("email LIKE ?", "%"+escapeLike(query.Email)+"%")
+	}
+
+	if query.Name != "" {
+		db = db.Where("first_name LIKE ? OR last_name LIKE ?", "%"+escapeLike(query.Name)+"%", "%"+escapeLike(query.Name)+"%")
+	}
+
+	if query.Role != "" {
+		db = db.Where("role = ?", query.Role)
+	}
+
+	if query.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *query.CreatedAfter)
+	}
+
+	if query.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *query.CreatedBefore)
+	}
+
+	// Keyset pagination : resume strictly after the cursor position, ID breaking ties
+	direction, comparison := "ASC", ">"
+
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+
+		value, id, err := decodeUserListCursor(query.Cursor, column)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		db = db.Where(column+" "+comparison+" ? OR ("+column+" = ? AND id "+comparison+" ?)", value, value, id)
+	}
+
+	limit := query.PageLimit()
+
+	// One extra user tells wether there is a next page
+	users := []User{}
+	err = db.Order(column + " " + direction).Order("id " + direction).Limit(limit + 1).Find(&users).Error
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(users) <= limit {
+		return users, "", nil
+	}
+
+	users = users[:limit]
+
+	return users, encodeUserListCursor(&users[limit-1], column), nil
+}
+
 // UpdateUserInfos : Update user infos in DB
 func (gorm *GORM) UpdateUserInfos(user *User, userUpdateRequestBody *UserUpdateRequestBody) error {
 
@@ -104,10 +201,187 @@ func (gorm *GORM) UpdateUserInfos(user *User, userUpdateRequestBody *UserUpdateR
 	return gorm.Database.Save(user).Error
 }
 
+// UpdateUserRole : Update user role in DB
+func (gorm *GORM) UpdateUserRole(user *User, role string) error {
+
+	return gorm.Database.Model(user).Update("role", role).Error
+}
+
+// UpdateUserEmail : Set user verified email in DB, clearing the pending one
+func (gorm *GORM) UpdateUserEmail(user *User, email string) error {
+
+	return gorm.Database.Model(user).Updates(map[string]interface{}{
+		"email":          email,
+		"email_verified": true,
+		"pending_email":  "",
+	}).Error
+}
+
+// UpdateUserDisabled : Disable or enable user in DB
+func (gorm *GORM) UpdateUserDisabled(user *User, disabled bool) error {
+
+	return gorm.Database.Model(user).Update("disabled", disabled).Error
+}
+
 // UpdateUserPassword : Update user password in DB
-func (gorm *GORM) UpdateUserPassword(newHashedPassword string) error {
+func (gorm *GORM) UpdateUserPassword(user *User, newHashedPassword string) error {
+
+	return gorm.Database.Model(user).Update("password", newHashedPassword).Error
+}
+
+// UpdateUserMFA : Update user TOTP secret & MFA status in DB
+func (gorm *GORM) UpdateUserMFA(user *User, encryptedSecret string, enabled bool) error {
+
+	return gorm.Database.Model(user).Updates(map[string]interface{}{"mfa_secret": encryptedSecret, "mfa_enabled": enabled}).Error
+}
+
+// ReplaceRecoveryCodes : Replace all user recovery codes by the given hashes in DB
+func (gorm *GORM) ReplaceRecoveryCodes(user *User, codeHashes []string) error {
+
+	tx := gorm.Database.Begin()
+
+	err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+
+		err = tx.Create(&RecoveryCode{UserID: user.ID, CodeHash: codeHash}).Error
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// ConsumeRecoveryCode : Delete recovery code from DB. Returns false if user has no such code
+func (gorm *GORM) ConsumeRecoveryCode(user *User, codeHash string) (bool, error) {
 
-	return gorm.Database.Select("password").Updates(map[string]interface{}{"password": newHashedPassword}).Error
+	result := gorm.Database.Where("user_id = ? AND code_hash = ?", user.ID, codeHash).Delete(&RecoveryCode{})
+
+	return result.RowsAffected == 1, result.Error
+}
+
+// CountRecoveryCodes : Count user remaining recovery codes in DB
+func (gorm *GORM) CountRecoveryCodes(user *User) (int, error) {
+
+	count := 0
+
+	return count, gorm.Database.Model(&RecoveryCode{}).Where("user_id = ?", user.ID).Count(&count).Error
+}
+
+// CreateAPIKey : Store API key in DB
+func (gorm *GORM) CreateAPIKey(apiKey *APIKey) error {
+
+	return gorm.Database.Create(apiKey).Error
+}
+
+// ReadAPIKeyFromPrefix : Read API key from DB
+func (gorm *GORM) ReadAPIKeyFromPrefix(prefix string) (*APIKey, error) {
+
+	var apiKey APIKey
+
+	return &apiKey, gorm.Database.Where("prefix = ?", prefix).First(&apiKey).Error
+}
+
+// ListUserAPIKeys : Read user API keys from DB, newest first
+func (gorm *GORM) ListUserAPIKeys(user *User) ([]APIKey, error) {
+
+	apiKeys := []APIKey{}
+
+	return apiKeys, gorm.Database.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&apiKeys).Error
+}
+
+// UpdateAPIKeyLastUsed : Record API key last use in DB
+func (gorm *GORM) UpdateAPIKeyLastUsed(apiKey *APIKey, lastUsedAt time.Time) error {
+
+	return gorm.Database.Model(apiKey).Update("last_used_at", lastUsedAt).Error
+}
+
+// DeleteUserAPIKey : Delete API key of user from DB. Returns false if user has no such key
+func (gorm *GORM) DeleteUserAPIKey(user *User, id string) (bool, error) {
+
+	result := gorm.Database.Where("user_id = ? AND id = ?", user.ID, id).Delete(&APIKey{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteUserAPIKeys : Delete all API keys of user from DB
+func (gorm *GORM) DeleteUserAPIKeys(user *User) error {
+
+	return gorm.Database.Where("user_id = ?", user.ID).Delete(&APIKey{}).Error
+}
+
+// CreateOAuthClient : Store OAuth client in DB
+func (gorm *GORM) CreateOAuthClient(client *OAuthClient) error {
+
+	return gorm.Database.Create(client).Error
+}
+
+// ReadOAuthClientFromID : Read OAuth client from DB
+func (gorm *GORM) ReadOAuthClientFromID(id string) (*OAuthClient, error) {
+
+	var client OAuthClient
+
+	return &client, gorm.Database.Where("id = ?", id).First(&client).Error
+}
+
+// ListOAuthClients : Read OAuth clients from DB, newest first
+func (gorm *GORM) ListOAuthClients() ([]OAuthClient, error) {
+
+	clients := []OAuthClient{}
+
+	return clients, gorm.Database.Order("created_at DESC").Find(&clients).Error
+}
+
+// DeleteOAuthClient : Delete OAuth client from DB. Returns false if there is no such client
+func (gorm *GORM) DeleteOAuthClient(id string) (bool, error) {
+
+	result := gorm.Database.Where("id = ?", id).Delete(&OAuthClient{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateExternalIdentity : Store external identity in DB
+func (gorm *GORM) CreateExternalIdentity(identity *ExternalIdentity) error {
+
+	return gorm.Database.Create(identity).Error
+}
+
+// ReadExternalIdentity : Read the identity of subject at provider from DB
+func (gorm *GORM) ReadExternalIdentity(provider string, subject string) (*ExternalIdentity, error) {
+
+	var identity ExternalIdentity
+
+	return &identity, gorm.Database.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+}
+
+// ListUserExternalIdentities : Read external identities of user from DB, newest first
+func (gorm *GORM) ListUserExternalIdentities(user *User) ([]ExternalIdentity, error) {
+
+	identities := []ExternalIdentity{}
+
+	return identities, gorm.Database.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&identities).Error
+}
+
+// DeleteUserExternalIdentity : Delete external identity of user from DB. Returns false if user has no such identity
+func (gorm *GORM) DeleteUserExternalIdentity(user *User, id string) (bool, error) {
+
+	result := gorm.Database.Where("user_id = ? AND id = ?", user.ID, id).Delete(&ExternalIdentity{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteUserExternalIdentities : Delete all external identities of user from DB
+func (gorm *GORM) DeleteUserExternalIdentities(user *User) error {
+
+	return gorm.Database.Where("user_id = ?", user.ID).Delete(&ExternalIdentity{}).Error
 }
 
 // DeleteUser : Delete user from DB
@@ -116,6 +390,12 @@ func (gorm *GORM) DeleteUser(user *User) error {
 	return gorm.Database.Delete(&user).Error
 }
 
+// escapeLike : Escape LIKE wildcards of user input
+func escapeLike(s string) string {
+
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
 // IsRecordNotFoundError : Check if error is of type RecordNotFound
 func (gorm *GORM) IsRecordNotFoundError(err error) bool {
 	return gormlib.IsRecordNotFoundError(err)
@@ -0,0 +1,458 @@
+package models
+
+import (
+	hex "encoding/hex"
+	json "encoding/json"
+	errors "errors"
+	fmt "fmt"
+	time "time"
+	jwt "vulnlabs-rest-api/jwt"
+	utils "vulnlabs-rest-api/utils"
+)
+
+// Session storage layout in Redis :
+//   refresh-token:<digest>:session  -> JSON refresh token record (expires with the session, or at the session
+//                                      absolute timeout once rotated, to detect its reuse)
+//   user:<userID>:refreshSessions   -> hash of session ID -> JSON session record
+//
+// Access tokens are verified from their signature only : they are not stored, and stay valid until they expire
+// even if their session is revoked
+
+// JWTSessionStore : Session store issuing short-lived signed access tokens, and rotating refresh tokens stored in Redis
+type JWTSessionStore struct {
+	Redis   RedisInterface
+	Config  *SessionsConfig
+	KeyRing *KeyRing
+}
+
+// jwtSessionRecord : Session as stored by the JWT session store
+type jwtSessionRecord struct {
+	Session
+	RefreshTokenDigest string    `json:"refreshTokenDigest"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+}
+
+// refreshTokenRecord : Session a refresh token was issued for
+type refreshTokenRecord struct {
+	UserID    string `json:"userID"`
+	SessionID string `json:"sessionID"`
+}
+
+// accessTokenClaims : Claims of access tokens
+type accessTokenClaims struct {
+	jwt.Claims
+	SessionID string `json:"sid"`
+}
+
+// NewJWTSessionStore : Return a new JWT session store, signing access tokens with the active key of keyRing
+func NewJWTSessionStore(redis RedisInterface, config *SessionsConfig, keyRing *KeyRing) (*JWTSessionStore, error) {
+
+	if _, err := keyRing.SigningKey(); err != nil {
+		return nil, err
+	}
+
+	return &JWTSessionStore{
+		Redis:   redis,
+		Config:  config,
+		KeyRing: keyRing,
+	}, nil
+}
+
+func (store *JWTSessionStore) CreateSession(userID string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	sessions, err := store.ListUserSessions(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessionsToEvict(sessions, store.Config.MaxSessionsPerUser) {
+
+		err = store.DeleteUserSession(userID, session.ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	record := &jwtSessionRecord{
+		Session: Session{
+			ID:         hex.EncodeToString(randomBytes),
+			UserID:     userID,
+			CreatedAt:  now,
+			LastSeenAt: now,
+			IP:         ip,
+			UserAgent:  userAgent,
+		},
+	}
+
+	return store.issueCredentials(record)
+}
+
+// RotateSession : Refresh tokens are single use. Presenting an already exchanged one means it leaked :
+// the whole session is revoked, so that neither the legitimate client nor the attacker can refresh it anymore
+func (store *JWTSessionStore) RotateSession(refreshToken string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	refreshTokenDigest := SessionTokenDigest(*store.Config, refreshToken)
+
+	data, err := store.Redis.Get(refreshTokenStorageKey(refreshTokenDigest))
+
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var tokenRecord refreshTokenRecord
+	err = json.Unmarshal(data, &tokenRecord)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Aborted when the sessions of the user changed meanwhile : retried, a concurrent exchange of the same token
+	// is then detected as a reuse
+	for attempt := 1; attempt <= RedisTransactionMaxAttempts; attempt++ {
+
+		credentials, err := store.rotateSession(&tokenRecord, refreshTokenDigest, ip, userAgent)
+
+		switch err {
+		case ErrRedisTransactionAborted:
+			continue
+		case ErrSessionExpired, ErrRefreshTokenReused:
+
+			deleteErr := store.DeleteUserSession(tokenRecord.UserID, tokenRecord.SessionID)
+
+			if deleteErr != nil && err == ErrRefreshTokenReused {
+				return nil, deleteErr
+			}
+		}
+
+		return credentials, err
+	}
+
+	return nil, ErrRedisTransactionAborted
+}
+
+// rotateSession : Check refresh token digest against the session it was issued for, and rotate it,
+// atomically so that a refresh token is exchanged once only
+func (store *JWTSessionStore) rotateSession(tokenRecord *refreshTokenRecord, refreshTokenDigest string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	var credentials *SessionCredentials
+
+	_, err := store.Redis.Watch([]string{userRefreshSessionsStorageKey(tokenRecord.UserID)}, func() ([]RedisCommand, error) {
+
+		record, err := store.readSessionRecord(tokenRecord.UserID, tokenRecord.SessionID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+
+		if !now.Before(record.ExpiresAt) {
+			return nil, ErrSessionExpired
+		}
+
+		if record.RefreshTokenDigest != refreshTokenDigest {
+			return nil, ErrRefreshTokenReused
+		}
+
+		record.LastSeenAt = now
+		record.IP = ip
+		record.UserAgent = userAgent
+
+		// Exchanged token is kept until the session can no longer be refreshed, to detect its reuse
+		rotatedTokenExpiration := record.CreatedAt.Add(store.Config.AbsoluteTimeout()).Sub(now)
+
+		var commands []RedisCommand
+
+		credentials, commands, err = store.newCredentials(record)
+
+		commands = append(commands, RedisCommand{
+			Command: "EXPIRE",
+			Args:    []interface{}{refreshTokenStorageKey(refreshTokenDigest), int(rotatedTokenExpiration.Seconds())},
+		})
+
+		return commands, err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// ReadSessionUserID : Access tokens are verified statelessly, from their signature
+func (store *JWTSessionStore) ReadSessionUserID(token string) (string, error) {
+
+	claims, err := store.parseAccessToken(token)
+
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+func (store *JWTSessionStore) SessionID(token string) (string, error) {
+
+	claims, err := store.parseAccessToken(token)
+
+	if err != nil {
+		return "", err
+	}
+
+	return claims.SessionID, nil
+}
+
+// RefreshSession : Access tokens cannot be extended, clients rotate their refresh token instead
+func (store *JWTSessionStore) RefreshSession(userID string, token string) (time.Duration, bool, error) {
+
+	return 0, false, nil
+}
+
+// ListUserSessions : Records of expired sessions are pruned
+func (store *JWTSessionStore) ListUserSessions(userID string) ([]Session, error) {
+
+	records, err := store.Redis.HGetAll(userRefreshSessionsStorageKey(userID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	now := time.Now()
+
+	for sessionID, data := range records {
+
+		var record jwtSessionRecord
+		err = json.Unmarshal(data, &record)
+
+		if err != nil || !now.Before(record.ExpiresAt) {
+			store.Redis.HDel(userRefreshSessionsStorageKey(userID), sessionID)
+			continue
+		}
+
+		record.UserID = userID
+		sessions = append(sessions, record.Session)
+	}
+
+	return sessions, nil
+}
+
+func (store *JWTSessionStore) DeleteUserSession(userID string, sessionID string) error {
+
+	record, err := store.readSessionRecord(userID, sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.Redis.Delete(refreshTokenStorageKey(record.RefreshTokenDigest))
+
+	if err != nil {
+		return err
+	}
+
+	return store.Redis.HDel(userRefreshSessionsStorageKey(userID), sessionID)
+}
+
+func (store *JWTSessionStore) DeleteUserSessions(userID string, exceptSessionID string) error {
+
+	records, err := store.Redis.HGetAll(userRefreshSessionsStorageKey(userID))
+
+	if err != nil {
+		return err
+	}
+
+	for sessionID, data := range records {
+
+		if sessionID == exceptSessionID {
+			continue
+		}
+
+		var record jwtSessionRecord
+
+		if json.Unmarshal(data, &record) == nil {
+
+			err = store.Redis.Delete(refreshTokenStorageKey(record.RefreshTokenDigest))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = store.Redis.HDel(userRefreshSessionsStorageKey(userID), sessionID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// issueCredentials : Generate a new refresh token & access token for session, and store it
+func (store *JWTSessionStore) issueCredentials(record *jwtSessionRecord) (*SessionCredentials, error) {
+
+	credentials, commands, err := store.newCredentials(record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.Redis.Multi(commands)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// newCredentials : Generate a new refresh token & access token for session, with the commands storing them
+func (store *JWTSessionStore) newCredentials(record *jwtSessionRecord) (*SessionCredentials, []RedisCommand, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(32)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken := hex.EncodeToString(randomBytes)
+	refreshTokenExpiration := SessionExpiration(*store.Config, record.CreatedAt, record.LastSeenAt)
+
+	record.RefreshTokenDigest = SessionTokenDigest(*store.Config, refreshToken)
+	record.ExpiresAt = record.LastSeenAt.Add(refreshTokenExpiration)
+
+	accessToken, accessTokenExpiration, err := store.signAccessToken(record)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recordData, err := json.Marshal(record)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenData, err := json.Marshal(refreshTokenRecord{
+		UserID:    record.UserID,
+		SessionID: record.ID,
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commands := []RedisCommand{
+		RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{refreshTokenStorageKey(record.RefreshTokenDigest), int(refreshTokenExpiration.Seconds()), tokenData},
+		},
+		RedisCommand{
+			Command: "HSET",
+			Args:    []interface{}{userRefreshSessionsStorageKey(record.UserID), record.ID, recordData},
+		},
+	}
+
+	return &SessionCredentials{
+		Token:                  accessToken,
+		TokenExpiration:        accessTokenExpiration,
+		RefreshToken:           refreshToken,
+		RefreshTokenExpiration: refreshTokenExpiration,
+	}, commands, nil
+}
+
+// signAccessToken : Sign an access token of session, never outliving it
+func (store *JWTSessionStore) signAccessToken(record *jwtSessionRecord) (string, time.Duration, error) {
+
+	expiration := store.Config.JWT.AccessTokenExpiration()
+
+	if remaining := record.CreatedAt.Add(store.Config.AbsoluteTimeout()).Sub(record.LastSeenAt); remaining < expiration {
+		expiration = remaining
+	}
+
+	signingKey, err := store.KeyRing.SigningKey()
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+
+	token, err := jwt.Sign(jwt.TypeAccessToken, accessTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:    store.Config.JWT.Issuer,
+			Subject:   record.UserID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiration).Unix(),
+			ID:        hex.EncodeToString(randomBytes),
+		},
+		SessionID: record.ID,
+	}, signingKey)
+
+	return token, expiration, err
+}
+
+// parseAccessToken : Verify access token signature, type, issuer & expiration
+func (store *JWTSessionStore) parseAccessToken(token string) (*accessTokenClaims, error) {
+
+	var claims accessTokenClaims
+
+	header, err := jwt.Parse(token, store.KeyRing.VerificationKey, &claims)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Type != jwt.TypeAccessToken || claims.Issuer != store.Config.JWT.Issuer || claims.Subject == "" || claims.SessionID == "" {
+		return nil, errors.New("Invalid access token")
+	}
+
+	return &claims, nil
+}
+
+// readSessionRecord : Read session record from the user session set
+func (store *JWTSessionStore) readSessionRecord(userID string, sessionID string) (*jwtSessionRecord, error) {
+
+	data, err := store.Redis.HGet(userRefreshSessionsStorageKey(userID), sessionID)
+
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var record jwtSessionRecord
+	err = json.Unmarshal(data, &record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record.UserID = userID
+
+	return &record, nil
+}
+
+func refreshTokenStorageKey(tokenDigest string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisRefreshTokenPrefix, tokenDigest, RedisRefreshTokenSessionSuffix)
+}
+
+func userRefreshSessionsStorageKey(userID string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisUserStoragePrefix, userID, RedisUserRefreshSessionsSuffix)
+}
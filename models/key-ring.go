@@ -0,0 +1,207 @@
+package models
+
+import (
+	base64 "encoding/base64"
+	errors "errors"
+	fmt "fmt"
+	ioutil "io/ioutil"
+	sort "sort"
+	sync "sync"
+	time "time"
+	jwt "vulnlabs-rest-api/jwt"
+)
+
+var (
+	ErrNoActiveSigningKey = errors.New("No active signing key")
+)
+
+// KeyRing : Concurrency-safe set of token signing keys. The active key signs new tokens,
+// retired keys keep verifying the tokens they signed until they expire
+type KeyRing struct {
+	mutex sync.RWMutex
+
+	active *jwt.Key
+
+	// Key ID -> key
+	keys map[string]*ringKey
+}
+
+// ringKey : Key of the ring & its expiration
+type ringKey struct {
+	*jwt.Key
+	ExpiresAt *time.Time
+}
+
+// NewKeyRing : Return a key ring loaded from config
+func NewKeyRing(config KeyRingConfig) (*KeyRing, error) {
+
+	ring := &KeyRing{
+		keys: map[string]*ringKey{},
+	}
+
+	return ring, ring.Load(config)
+}
+
+// Load : Replace the keys of the ring by the ones of config. Keys are all loaded before the ring is updated,
+// so that it is left untouched if one is invalid
+func (ring *KeyRing) Load(config KeyRingConfig) error {
+
+	keys := map[string]*ringKey{}
+
+	for _, keyConfig := range config.Keys {
+
+		if _, ok := keys[keyConfig.ID]; ok {
+			return fmt.Errorf("duplicate signing key %s", keyConfig.ID)
+		}
+
+		key, err := loadSigningKey(keyConfig)
+
+		if err != nil {
+			return fmt.Errorf("invalid signing key %s : %v", keyConfig.ID, err)
+		}
+
+		keys[key.ID] = &ringKey{
+			Key:       key,
+			ExpiresAt: keyConfig.ExpiresAt,
+		}
+	}
+
+	var active *jwt.Key
+
+	if config.ActiveKeyID != "" {
+
+		activeKey, ok := keys[config.ActiveKeyID]
+
+		if !ok {
+			return errors.New("unknown active signing key " + config.ActiveKeyID)
+		}
+
+		if activeKey.expired(time.Now()) {
+			return errors.New("active signing key " + config.ActiveKeyID + " is expired")
+		}
+
+		active = activeKey.Key
+	}
+
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	ring.active = active
+	ring.keys = keys
+
+	return nil
+}
+
+// SigningKey : Active key
+func (ring *KeyRing) SigningKey() (*jwt.Key, error) {
+
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	if ring.active == nil {
+		return nil, ErrNoActiveSigningKey
+	}
+
+	return ring.active, nil
+}
+
+// VerificationKey : Unexpired key identified by the token header, as a jwt.KeyFunc
+func (ring *KeyRing) VerificationKey(header *jwt.Header) (*jwt.Key, error) {
+
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	key, ok := ring.keys[header.KeyID]
+
+	if !ok || key.expired(time.Now()) {
+		return nil, jwt.ErrUnknownKey
+	}
+
+	return key.Key, nil
+}
+
+// JWKS : Public keys of the unexpired asymmetric keys, active and retired
+func (ring *KeyRing) JWKS() *jwt.JWKSet {
+
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	set := &jwt.JWKSet{
+		Keys: []jwt.JWK{},
+	}
+
+	now := time.Now()
+
+	for _, key := range ring.keys {
+
+		if key.expired(now) {
+			continue
+		}
+
+		if jwk, ok := key.PublicJWK(); ok {
+			set.Keys = append(set.Keys, *jwk)
+		}
+	}
+
+	// Stable output, for caches
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return set
+}
+
+// expired : Check wether key is expired at now
+func (key *ringKey) expired(now time.Time) bool {
+
+	return key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)
+}
+
+// loadSigningKey : Decode configured key, from its file if any
+func loadSigningKey(config SigningKeyConfig) (*jwt.Key, error) {
+
+	if config.ID == "" {
+		return nil, errors.New("key ID required")
+	}
+
+	secret, err := signingKeySecret(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Algorithm {
+	case jwt.AlgorithmHS256:
+
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes long")
+		}
+
+		return jwt.NewHS256Key(config.ID, secret), nil
+
+	case jwt.AlgorithmEdDSA:
+		return jwt.NewEdDSAKey(config.ID, secret)
+	}
+
+	return nil, jwt.ErrUnknownAlgorithm
+}
+
+// signingKeySecret : Raw key material, read from file or decoded from config
+func signingKeySecret(config SigningKeyConfig) ([]byte, error) {
+
+	if config.File == "" {
+		return base64.StdEncoding.DecodeString(config.Secret)
+	}
+
+	data, err := ioutil.ReadFile(config.File)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Algorithm == jwt.AlgorithmEdDSA {
+		return jwt.ParseEdDSAPrivateKeyPEM(data)
+	}
+
+	return data, nil
+}
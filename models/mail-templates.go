@@ -0,0 +1,88 @@
+package models
+
+import (
+	bytes "bytes"
+	fmt "fmt"
+	htmltemplate "html/template"
+	os "os"
+	filepath "path/filepath"
+	texttemplate "text/template"
+)
+
+// MailTemplates : Email bodies templates. Template <name> is made of <name>.txt and/or <name>.html files
+type MailTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// LoadMailTemplates : Parse all *.txt & *.html templates of directory (no templates if empty)
+func LoadMailTemplates(directory string) (*MailTemplates, error) {
+
+	templates := &MailTemplates{
+		text: texttemplate.New("text"),
+		html: htmltemplate.New("html"),
+	}
+
+	if directory == "" {
+		return templates, nil
+	}
+
+	if _, err := os.Stat(directory); err != nil {
+		return nil, fmt.Errorf("could not load mail templates : %v", err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(directory, "*.txt")); len(files) > 0 {
+
+		_, err := templates.text.ParseFiles(files...)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(directory, "*.html")); len(files) > 0 {
+
+		_, err := templates.html.ParseFiles(files...)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+// Render : Render message Text & HTML bodies from its template & data
+func (templates *MailTemplates) Render(message *MailMessage) error {
+
+	textTemplate := templates.text.Lookup(message.Template + ".txt")
+	htmlTemplate := templates.html.Lookup(message.Template + ".html")
+
+	if textTemplate == nil && htmlTemplate == nil {
+		return fmt.Errorf("unknown mail template %s", message.Template)
+	}
+
+	if textTemplate != nil {
+
+		var buffer bytes.Buffer
+
+		if err := textTemplate.Execute(&buffer, message.Data); err != nil {
+			return err
+		}
+
+		message.Text = buffer.String()
+	}
+
+	if htmlTemplate != nil {
+
+		var buffer bytes.Buffer
+
+		if err := htmlTemplate.Execute(&buffer, message.Data); err != nil {
+			return err
+		}
+
+		message.HTML = buffer.String()
+	}
+
+	return nil
+}
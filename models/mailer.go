@@ -0,0 +1,203 @@
+package models
+
+import (
+	bytes "bytes"
+	rand "crypto/rand"
+	hex "encoding/hex"
+	errors "errors"
+	fmt "fmt"
+	mime "mime"
+	multipart "mime/multipart"
+	net "net"
+	textproto "net/textproto"
+	strings "strings"
+	time "time"
+)
+
+const (
+	MailerBackendSMTP = "smtp"
+	MailerBackendFile = "file"
+	MailerBackendLog  = "log"
+)
+
+// Mailer : Outbound email communication interface
+type Mailer interface {
+	Send(message *MailMessage) error
+}
+
+// MailMessage : Email to send. If Template is set, Text & HTML bodies are rendered from it with Data
+type MailMessage struct {
+	To       []string
+	Subject  string
+	Text     string
+	HTML     string
+	Template string
+	Data     interface{}
+}
+
+// mailPipeline : Mailer rendering templates, then sending through transport with retries on transient failures
+type mailPipeline struct {
+	transport  Mailer
+	templates  *MailTemplates
+	attempts   int
+	retryDelay time.Duration
+}
+
+// NewMailer : Return the mailer described by config
+func NewMailer(config MailerConfig) (Mailer, error) {
+
+	var transport Mailer
+
+	switch config.Backend {
+	case MailerBackendSMTP:
+		transport = NewSMTPMailer(config.From, config.SMTP)
+	case MailerBackendFile:
+		transport = NewFileMailer(config.From, config.File.Directory)
+	case MailerBackendLog:
+		transport = &LogMailer{}
+	case "":
+		return nil, fmt.Errorf("mailer backend must be set, one of %s, %s or %s", MailerBackendSMTP, MailerBackendFile, MailerBackendLog)
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %s", config.Backend)
+	}
+
+	templates, err := LoadMailTemplates(config.TemplatesDirectory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailPipeline{
+		transport:  transport,
+		templates:  templates,
+		attempts:   config.MaxAttempts(),
+		retryDelay: config.RetryDelay(),
+	}, nil
+}
+
+// Send : Render message template if any, then send it. Transient failures are retried with exponential backoff
+func (pipeline *mailPipeline) Send(message *MailMessage) error {
+
+	if message.Template != "" {
+
+		rendered := *message
+		err := pipeline.templates.Render(&rendered)
+
+		if err != nil {
+			return err
+		}
+
+		message = &rendered
+	}
+
+	var err error
+	delay := pipeline.retryDelay
+
+	for attempt := 1; attempt <= pipeline.attempts; attempt++ {
+
+		err = pipeline.transport.Send(message)
+
+		if err == nil || !isTransientMailError(err) {
+			return err
+		}
+
+		if attempt < pipeline.attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	return fmt.Errorf("giving up sending mail after %d attempts : %v", pipeline.attempts, err)
+}
+
+// isTransientMailError : Network errors & SMTP 4xx replies are worth retrying
+func isTransientMailError(err error) bool {
+
+	if protocolErr, ok := err.(*textproto.Error); ok {
+		return protocolErr.Code >= 400 && protocolErr.Code < 500
+	}
+
+	_, isNetError := err.(net.Error)
+
+	return isNetError
+}
+
+// buildMIMEMessage : Build the RFC 5322 message, multipart/alternative when both text & HTML bodies are set
+func buildMIMEMessage(from string, message *MailMessage) ([]byte, error) {
+
+	if message.Text == "" && message.HTML == "" {
+		return nil, errors.New("Empty mail body")
+	}
+
+	var buffer bytes.Buffer
+
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(message.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(from),
+		"MIME-Version: 1.0",
+	}
+
+	for _, header := range headers {
+		buffer.WriteString(header + "\r\n")
+	}
+
+	// Single part message
+	if message.Text == "" || message.HTML == "" {
+
+		contentType, body := "text/plain", message.Text
+
+		if message.Text == "" {
+			contentType, body = "text/html", message.HTML
+		}
+
+		buffer.WriteString("Content-Type: " + contentType + "; charset=utf-8\r\n\r\n")
+		buffer.WriteString(body)
+
+		return buffer.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+
+	buffer.WriteString("Content-Type: multipart/alternative; boundary=" + writer.Boundary() + "\r\n\r\n")
+
+	// Least preferred part first
+	for _, part := range []struct{ contentType, body string }{{"text/plain", message.Text}, {"text/html", message.HTML}} {
+
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + "; charset=utf-8"}})
+
+		if err != nil {
+			return nil, err
+		}
+
+		partWriter.Write([]byte(part.body))
+	}
+
+	err := writer.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.Write(parts.Bytes())
+
+	return buffer.Bytes(), nil
+}
+
+// messageID : Unique Message-ID in the sender domain
+func messageID(from string) string {
+
+	domain := "localhost"
+
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimRight(from[at+1:], ">")
+	}
+
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(randomBytes), domain)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	bytes "bytes"
+	log "log"
+	os "os"
+	strings "strings"
+	testing "testing"
+)
+
+func TestNewMailerBackend(t *testing.T) {
+
+	tests := []struct {
+		backend string
+		valid   bool
+	}{
+		{"", false},
+		{"sendmail", false},
+		{MailerBackendLog, true},
+		{MailerBackendFile, true},
+	}
+
+	for _, test := range tests {
+
+		_, err := NewMailer(MailerConfig{Backend: test.backend, TemplatesDirectory: os.TempDir()})
+
+		// Valid backends may only fail on templates
+		if invalid := err != nil && strings.Contains(err.Error(), "backend"); invalid == test.valid {
+			t.Errorf("%q : got error %v, want valid %t", test.backend, err, test.valid)
+		}
+	}
+}
+
+func TestLogMailerRedactsBody(t *testing.T) {
+
+	var output bytes.Buffer
+
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	err := (&LogMailer{}).Send(&MailMessage{
+		To:      []string{"user@vulnlabs.localhost"},
+		Subject: "Reset your password",
+		Text:    "https://frontend.localhost/password-reset?token=secret-token",
+		HTML:    `<a href="https://frontend.localhost/password-reset?token=secret-token">Reset</a>`,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if logged := output.String(); !strings.Contains(logged, "user@vulnlabs.localhost") || !strings.Contains(logged, "Reset your password") || strings.Contains(logged, "secret-token") {
+		t.Errorf("got log %q, want recipient & subject only", logged)
+	}
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	sync "sync"
+	time "time"
+)
+
+const (
+	// Interval between two collections of outdated counters
+	memoryRateLimiterCollectInterval = time.Minute
+)
+
+// MemoryRateLimiter : Concurrency-safe in-memory rate limiter, counting requests of this API instance only
+type MemoryRateLimiter struct {
+	mutex sync.Mutex
+
+	// key -> counters of the current & previous windows
+	counters map[string]*memoryRateLimitCounter
+}
+
+// memoryRateLimitCounter : Requests of the window starting at WindowStart, and of the one before
+type memoryRateLimitCounter struct {
+	WindowStart time.Time
+	Window      time.Duration
+	Previous    int
+	Current     int
+}
+
+// NewMemoryRateLimiter : Return a new in-memory rate limiter, collecting outdated counters in background
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+
+	limiter := &MemoryRateLimiter{
+		counters: map[string]*memoryRateLimitCounter{},
+	}
+
+	go func() {
+		for range time.Tick(memoryRateLimiterCollectInterval) {
+			limiter.collectOutdated()
+		}
+	}()
+
+	return limiter
+}
+
+func (limiter *MemoryRateLimiter) Hit(key string, limit RateLimit) (*RateLimitResult, error) {
+
+	now := time.Now()
+	windowStart := now.Truncate(limit.Window())
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	counter := limiter.counters[key]
+
+	switch {
+	case counter == nil || counter.Window != limit.Window() || windowStart.Sub(counter.WindowStart) > limit.Window():
+		counter = &memoryRateLimitCounter{WindowStart: windowStart, Window: limit.Window()}
+		limiter.counters[key] = counter
+	case windowStart.After(counter.WindowStart):
+		counter.WindowStart, counter.Previous, counter.Current = windowStart, counter.Current, 0
+	}
+
+	counter.Current++
+
+	return slidingWindowResult(limit, now, counter.Previous, counter.Current), nil
+}
+
+// collectOutdated : Delete counters whose windows are over
+func (limiter *MemoryRateLimiter) collectOutdated() {
+
+	now := time.Now()
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for key, counter := range limiter.counters {
+
+		if now.Sub(counter.WindowStart) > 2*counter.Window {
+			delete(limiter.counters, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	testing "testing"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+
+	limiter := NewMemoryRateLimiter()
+	limit := RateLimit{Requests: 3, WindowInSeconds: 3600}
+
+	for i := 1; i <= 4; i++ {
+
+		result, err := limiter.Hit("client", limit)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if allowed := i <= limit.Requests; result.Allowed != allowed {
+			t.Errorf("request %d : got allowed %t, want %t", i, result.Allowed, allowed)
+		}
+	}
+
+	// Keys are counted apart
+	if result, _ := limiter.Hit("other", limit); !result.Allowed || result.Remaining != limit.Requests-1 {
+		t.Errorf("other key got %+v", result)
+	}
+
+	// Counters older than a window no longer count
+	limiter.mutex.Lock()
+	limiter.counters["client"].WindowStart = limiter.counters["client"].WindowStart.Add(-2 * limit.Window())
+	limiter.mutex.Unlock()
+
+	if result, _ := limiter.Hit("client", limit); !result.Allowed || result.Remaining != limit.Requests-1 {
+		t.Errorf("outdated counter got %+v", result)
+	}
+}
+
+func TestMemoryRateLimiterCollectOutdated(t *testing.T) {
+
+	limiter := NewMemoryRateLimiter()
+	limit := RateLimit{Requests: 3, WindowInSeconds: 60}
+
+	limiter.Hit("outdated", limit)
+	limiter.Hit("previous", limit)
+	limiter.Hit("current", limit)
+
+	limiter.mutex.Lock()
+	limiter.counters["outdated"].WindowStart = limiter.counters["outdated"].WindowStart.Add(-3 * limit.Window())
+	limiter.counters["previous"].WindowStart = limiter.counters["previous"].WindowStart.Add(-limit.Window())
+	limiter.mutex.Unlock()
+
+	limiter.collectOutdated()
+
+	tests := []struct {
+		key  string
+		kept bool
+	}{
+		{"outdated", false},
+		{"previous", true},
+		{"current", true},
+	}
+
+	for _, test := range tests {
+		if _, kept := limiter.counters[test.key]; kept != test.kept {
+			t.Errorf("%s : got kept %t, want %t", test.key, kept, test.kept)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	sync "sync"
+	time "time"
+)
+
+const (
+	// Interval between two collections of expired sessions
+	memorySessionStoreCollectInterval = time.Minute
+)
+
+// MemorySessionStore : Concurrency-safe in-memory session store, for tests & single-node deployments.
+// Sessions are lost on restart
+type MemorySessionStore struct {
+	Config *SessionsConfig
+
+	mutex sync.Mutex
+
+	// token digest -> session
+	sessions map[string]*memorySession
+
+	// userID -> session ID -> token digest
+	userSessions map[string]map[string]string
+}
+
+// memorySession : Session record & its expiration
+type memorySession struct {
+	sessionRecord
+	ExpiresAt time.Time
+}
+
+// NewMemorySessionStore : Return a new in-memory session store, collecting expired sessions in background
+func NewMemorySessionStore(config *SessionsConfig) *MemorySessionStore {
+
+	store := &MemorySessionStore{
+		Config:       config,
+		sessions:     map[string]*memorySession{},
+		userSessions: map[string]map[string]string{},
+	}
+
+	go func() {
+		for range time.Tick(memorySessionStoreCollectInterval) {
+			store.collectExpired()
+		}
+	}()
+
+	return store
+}
+
+func (store *MemorySessionStore) CreateSession(userID string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	record, sessionToken, err := newSessionRecord(*store.Config, userID, ip, userAgent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, session := range sessionsToEvict(store.listUserSessions(userID), store.Config.MaxSessionsPerUser) {
+		store.deleteSession(store.userSessions[userID][session.ID])
+	}
+
+	expiration := SessionExpiration(*store.Config, record.CreatedAt, record.CreatedAt)
+
+	store.sessions[record.TokenDigest] = &memorySession{
+		sessionRecord: *record,
+		ExpiresAt:     record.CreatedAt.Add(expiration),
+	}
+
+	if store.userSessions[userID] == nil {
+		store.userSessions[userID] = map[string]string{}
+	}
+
+	store.userSessions[userID][record.ID] = record.TokenDigest
+
+	return &SessionCredentials{
+		Token:           sessionToken,
+		TokenExpiration: expiration,
+	}, nil
+}
+
+func (store *MemorySessionStore) RotateSession(refreshToken string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	return rotateSession(store, refreshToken, ip, userAgent)
+}
+
+func (store *MemorySessionStore) ReadSessionUserID(token string) (string, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, err := store.readSession(SessionTokenDigest(*store.Config, token))
+
+	if err != nil {
+		return "", err
+	}
+
+	return session.UserID, nil
+}
+
+func (store *MemorySessionStore) SessionID(token string) (string, error) {
+
+	return SessionID(token), nil
+}
+
+func (store *MemorySessionStore) RefreshSession(userID string, token string) (time.Duration, bool, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, err := store.readSession(SessionTokenDigest(*store.Config, token))
+
+	if err != nil || session.UserID != userID {
+		return 0, false, ErrSessionNotFound
+	}
+
+	now := time.Now().UTC()
+
+	// Absolute lifetime cannot be extended
+	if now.Sub(session.CreatedAt) >= store.Config.AbsoluteTimeout() {
+
+		store.deleteSession(session.TokenDigest)
+		return 0, false, ErrSessionExpired
+	}
+
+	if now.Sub(session.LastSeenAt) < store.Config.RefreshThrottle() {
+		return session.ExpiresAt.Sub(now), false, nil
+	}
+
+	expiration := SessionExpiration(*store.Config, session.CreatedAt, now)
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(expiration)
+
+	return expiration, true, nil
+}
+
+func (store *MemorySessionStore) ListUserSessions(userID string) ([]Session, error) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.listUserSessions(userID), nil
+}
+
+func (store *MemorySessionStore) DeleteUserSession(userID string, sessionID string) error {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	tokenDigest, ok := store.userSessions[userID][sessionID]
+
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	store.deleteSession(tokenDigest)
+
+	return nil
+}
+
+func (store *MemorySessionStore) DeleteUserSessions(userID string, exceptSessionID string) error {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for sessionID, tokenDigest := range store.userSessions[userID] {
+
+		if sessionID != exceptSessionID {
+			store.deleteSession(tokenDigest)
+		}
+	}
+
+	return nil
+}
+
+// readSession : Get unexpired session from token digest. Mutex must be held
+func (store *MemorySessionStore) readSession(tokenDigest string) (*memorySession, error) {
+
+	session, ok := store.sessions[tokenDigest]
+
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	if !time.Now().Before(session.ExpiresAt) {
+
+		store.deleteSession(tokenDigest)
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// listUserSessions : List unexpired user sessions. Mutex must be held
+func (store *MemorySessionStore) listUserSessions(userID string) []Session {
+
+	sessions := []Session{}
+
+	for _, tokenDigest := range store.userSessions[userID] {
+
+		if session, err := store.readSession(tokenDigest); err == nil {
+			sessions = append(sessions, session.Session)
+		}
+	}
+
+	return sessions
+}
+
+// deleteSession : Remove session from both indexes. Mutex must be held
+func (store *MemorySessionStore) deleteSession(tokenDigest string) {
+
+	session, ok := store.sessions[tokenDigest]
+
+	if !ok {
+		return
+	}
+
+	delete(store.sessions, tokenDigest)
+	delete(store.userSessions[session.UserID], session.ID)
+
+	if len(store.userSessions[session.UserID]) == 0 {
+		delete(store.userSessions, session.UserID)
+	}
+}
+
+// collectExpired : Remove all expired sessions
+func (store *MemorySessionStore) collectExpired() {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+
+	for tokenDigest, session := range store.sessions {
+
+		if !now.Before(session.ExpiresAt) {
+			store.deleteSession(tokenDigest)
+		}
+	}
+}
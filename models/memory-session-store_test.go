@@ -0,0 +1,181 @@
+package models
+
+import (
+	testing "testing"
+	time "time"
+)
+
+// backdate : Move session of token back in time by age, as if created & last seen then. Ignores evicted sessions
+func backdate(store *MemorySessionStore, token string, age time.Duration) {
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[SessionTokenDigest(*store.Config, token)]
+
+	if !ok {
+		return
+	}
+
+	session.CreatedAt = session.CreatedAt.Add(-age)
+	session.LastSeenAt = session.LastSeenAt.Add(-age)
+}
+
+func TestMemorySessionStoreEviction(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		maxSessions int
+		created     int
+		remaining   int
+	}{
+		{"unlimited", 0, 5, 5},
+		{"below max", 3, 2, 2},
+		{"at max", 3, 3, 3},
+		{"beyond max", 3, 5, 3},
+		{"single session", 1, 3, 1},
+	}
+
+	for _, test := range tests {
+
+		store := NewMemorySessionStore(&SessionsConfig{MaxSessionsPerUser: test.maxSessions})
+		tokens := []string{}
+
+		for i := 0; i < test.created; i++ {
+
+			credentials, err := store.CreateSession("user", "127.0.0.1", "test")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Sessions created earlier were used less recently
+			for _, token := range tokens {
+				backdate(store, token, time.Minute)
+			}
+
+			tokens = append(tokens, credentials.Token)
+		}
+
+		sessions, _ := store.ListUserSessions("user")
+
+		if len(sessions) != test.remaining {
+			t.Errorf("%s : got %d sessions, want %d", test.name, len(sessions), test.remaining)
+		}
+
+		// Least recently used sessions are the evicted ones
+		for i, token := range tokens {
+
+			_, err := store.ReadSessionUserID(token)
+
+			if evicted := i < test.created-test.remaining; (err != nil) != evicted {
+				t.Errorf("%s : session %d got error %v, want evicted %t", test.name, i, err, evicted)
+			}
+		}
+	}
+}
+
+func TestMemorySessionStoreTimeouts(t *testing.T) {
+
+	config := &SessionsConfig{IdleTimeoutInMinutes: 30, AbsoluteTimeoutInMinutes: 60, RefreshThrottleInSeconds: 60}
+
+	tests := []struct {
+		name       string
+		age        time.Duration
+		err        error
+		refreshed  bool
+		expiration time.Duration
+	}{
+		{"refresh throttled", 0, nil, false, time.Minute},
+		{"active session", 10 * time.Minute, nil, true, 30 * time.Minute},
+		{"near absolute timeout", 45 * time.Minute, nil, true, 15 * time.Minute},
+		{"at absolute timeout", 60 * time.Minute, ErrSessionExpired, false, 0},
+	}
+
+	for _, test := range tests {
+
+		store := NewMemorySessionStore(config)
+		credentials, err := store.CreateSession("user", "127.0.0.1", "test")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		backdate(store, credentials.Token, test.age)
+
+		// Session is not idle : only the absolute timeout can expire it
+		store.mutex.Lock()
+		store.sessions[SessionTokenDigest(*config, credentials.Token)].ExpiresAt = time.Now().Add(time.Minute)
+		store.mutex.Unlock()
+
+		expiration, refreshed, err := store.RefreshSession("user", credentials.Token)
+
+		if err != test.err || refreshed != test.refreshed {
+			t.Errorf("%s : got refreshed %t error %v, want %t %v", test.name, refreshed, err, test.refreshed, test.err)
+			continue
+		}
+
+		if diff := expiration - test.expiration; diff > time.Second || diff < -time.Second {
+			t.Errorf("%s : got expiration %s, want %s", test.name, expiration, test.expiration)
+		}
+
+		if _, err := store.ReadSessionUserID(credentials.Token); (err == nil) != (test.err == nil) {
+			t.Errorf("%s : got read error %v after refresh", test.name, err)
+		}
+	}
+}
+
+func TestMemorySessionStoreIdleTimeout(t *testing.T) {
+
+	store := NewMemorySessionStore(&SessionsConfig{IdleTimeoutInMinutes: 30})
+	credentials, err := store.CreateSession("user", "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.RefreshSession("other", credentials.Token); err != ErrSessionNotFound {
+		t.Errorf("refresh by another user got %v, want %v", err, ErrSessionNotFound)
+	}
+
+	store.mutex.Lock()
+	store.sessions[SessionTokenDigest(*store.Config, credentials.Token)].ExpiresAt = time.Now()
+	store.mutex.Unlock()
+
+	if _, err := store.ReadSessionUserID(credentials.Token); err != ErrSessionNotFound {
+		t.Errorf("idle session got %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if sessions, _ := store.ListUserSessions("user"); len(sessions) != 0 {
+		t.Errorf("idle session must not be listed, got %d sessions", len(sessions))
+	}
+}
+
+func TestMemorySessionStoreDeleteUserSessions(t *testing.T) {
+
+	store := NewMemorySessionStore(&SessionsConfig{})
+
+	current, _ := store.CreateSession("user", "127.0.0.1", "test")
+	other, _ := store.CreateSession("user", "127.0.0.1", "test")
+	unrelated, _ := store.CreateSession("other", "127.0.0.1", "test")
+
+	if err := store.DeleteUserSessions("user", SessionID(current.Token)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		kept  bool
+	}{
+		{"current session", current.Token, true},
+		{"other session", other.Token, false},
+		{"session of another user", unrelated.Token, true},
+	}
+
+	for _, test := range tests {
+		if _, err := store.ReadSessionUserID(test.token); (err == nil) != test.kept {
+			t.Errorf("%s : got error %v, want kept %t", test.name, err, test.kept)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package models
+
+import (
+	sha256 "crypto/sha256"
+	hex "encoding/hex"
+	json "encoding/json"
+	errors "errors"
+	fmt "fmt"
+	strings "strings"
+	time "time"
+	jwt "vulnlabs-rest-api/jwt"
+	utils "vulnlabs-rest-api/utils"
+)
+
+// OAuth storage layout in Redis :
+//   oauth-code:<digest>:code              -> JSON authorization code (single use, short-lived)
+//   oauth-grant:<grantID>:grant           -> JSON grant (expires if not refreshed, deleted on revocation)
+//   oauth-refresh-token:<digest>:grantID  -> grant ID (rotated tokens are kept as long as their grant, to detect their reuse)
+//   oauth-access-token:<jti>:revoked      -> revoked access token, until it expires
+//   user:<userID>:oauthConsents           -> hash of client ID -> space separated consented scopes
+//
+// Access tokens are signed JWTs (RFC 9068) verifiable from the published keys. They are only active as long as
+// their grant is, which the API & the introspection endpoint check
+
+var (
+	ErrOAuthInvalidGrant       = errors.New("Invalid, expired or revoked grant")
+	ErrOAuthInvalidScope       = errors.New("Scope exceeds the granted one")
+	ErrOAuthRefreshTokenReused = errors.New("Refresh token reused, grant revoked")
+)
+
+// OAuthTokenStore : Storage of the authorization codes, grants & tokens of the OAuth authorization server
+type OAuthTokenStore struct {
+	Redis   RedisInterface
+	Config  *OAuthConfig
+	KeyRing *KeyRing
+}
+
+// OAuthAccessTokenClaims : Claims of OAuth access tokens (RFC 9068)
+type OAuthAccessTokenClaims struct {
+	jwt.Claims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+	GrantID  string `json:"gid"`
+}
+
+// Scopes : Scopes of the access token
+func (claims *OAuthAccessTokenClaims) Scopes() []string {
+
+	return ParseOAuthScope(claims.Scope)
+}
+
+// NewOAuthTokenStore : Return a new OAuth token store, signing access tokens with the active key of keyRing
+func NewOAuthTokenStore(redis RedisInterface, config *OAuthConfig, keyRing *KeyRing) *OAuthTokenStore {
+
+	return &OAuthTokenStore{
+		Redis:   redis,
+		Config:  config,
+		KeyRing: keyRing,
+	}
+}
+
+// CreateAuthorizationCode : Store approved authorization request behind a new code
+func (store *OAuthTokenStore) CreateAuthorizationCode(authorizationCode *OAuthAuthorizationCode) (string, error) {
+
+	code, err := generateOAuthToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(authorizationCode)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = store.Redis.SetWithExpiration(oauthCodeStorageKey(oauthTokenDigest(code)), data, int(store.Config.AuthorizationCodeExpiration().Seconds()))
+
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConsumeAuthorizationCode : Read & delete the authorization request of code, atomically so that it is used once only.
+// Codes issued to another client than clientID are not deleted
+func (store *OAuthTokenStore) ConsumeAuthorizationCode(code string, clientID string) (*OAuthAuthorizationCode, error) {
+
+	key := oauthCodeStorageKey(oauthTokenDigest(code))
+
+	// Client of a code never changes, it can be checked before consuming the code
+	authorizationCode, err := store.readAuthorizationCode(key)
+
+	if err != nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	if authorizationCode.ClientID != clientID {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	results, err := store.Redis.Multi([]RedisCommand{
+		RedisCommand{
+			Command: "GET",
+			Args:    []interface{}{key},
+		},
+		RedisCommand{
+			Command: "DEL",
+			Args:    []interface{}{key},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Code was consumed since it was read
+	if _, ok := results[0].([]byte); !ok {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	return authorizationCode, nil
+}
+
+// readAuthorizationCode : Authorization request stored at key
+func (store *OAuthTokenStore) readAuthorizationCode(key string) (*OAuthAuthorizationCode, error) {
+
+	data, err := store.Redis.Get(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var authorizationCode OAuthAuthorizationCode
+	err = json.Unmarshal(data, &authorizationCode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorizationCode, nil
+}
+
+// IssueTokens : Create a grant of scopes to client by user, and issue its first tokens
+func (store *OAuthTokenStore) IssueTokens(clientID string, userID string, scopes []string, authTime time.Time) (*OAuthTokens, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &OAuthGrant{
+		ID:        hex.EncodeToString(randomBytes),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		AuthTime:  authTime,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return store.issueTokens(grant, scopes)
+}
+
+// RefreshTokens : Exchange the refresh token of client for new tokens. Refresh tokens are single use : presenting an
+// already exchanged one means it leaked, and revokes its grant. Access token scopes can be narrowed with scopes
+func (store *OAuthTokenStore) RefreshTokens(clientID string, refreshToken string, scopes []string) (*OAuthTokens, error) {
+
+	refreshTokenDigest := oauthTokenDigest(refreshToken)
+
+	grantID, err := store.Redis.Get(oauthRefreshTokenStorageKey(refreshTokenDigest))
+
+	if err != nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	// Aborted when the grant changed meanwhile : retried, a concurrent exchange of the same token is then
+	// detected as a reuse
+	for attempt := 1; attempt <= RedisTransactionMaxAttempts; attempt++ {
+
+		tokens, err := store.refreshTokens(clientID, string(grantID), refreshTokenDigest, scopes)
+
+		switch err {
+		case ErrRedisTransactionAborted:
+			continue
+		case ErrOAuthRefreshTokenReused:
+
+			revokeErr := store.RevokeGrant(string(grantID))
+
+			if revokeErr != nil {
+				return nil, revokeErr
+			}
+		}
+
+		return tokens, err
+	}
+
+	return nil, ErrRedisTransactionAborted
+}
+
+// refreshTokens : Check refresh token digest against its grant, and rotate it, atomically so that a refresh token
+// is exchanged once only
+func (store *OAuthTokenStore) refreshTokens(clientID string, grantID string, refreshTokenDigest string, scopes []string) (*OAuthTokens, error) {
+
+	var tokens *OAuthTokens
+
+	_, err := store.Redis.Watch([]string{oauthGrantStorageKey(grantID)}, func() ([]RedisCommand, error) {
+
+		grant, err := store.ReadGrant(grantID)
+
+		if err != nil || grant.ClientID != clientID {
+			return nil, ErrOAuthInvalidGrant
+		}
+
+		if grant.RefreshTokenDigest != refreshTokenDigest {
+			return nil, ErrOAuthRefreshTokenReused
+		}
+
+		if len(scopes) == 0 {
+			scopes = grant.Scopes
+		}
+
+		for _, scope := range scopes {
+
+			if !utils.IsStringIn(scope, grant.Scopes) {
+				return nil, ErrOAuthInvalidScope
+			}
+		}
+
+		var commands []RedisCommand
+
+		tokens, commands, err = store.newTokens(grant, scopes)
+
+		commands = append(commands, RedisCommand{
+			Command: "EXPIRE",
+			Args:    []interface{}{oauthRefreshTokenStorageKey(refreshTokenDigest), int(store.Config.RefreshTokenExpiration().Seconds())},
+		})
+
+		return commands, err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// ReadGrant : Read active grant
+func (store *OAuthTokenStore) ReadGrant(grantID string) (*OAuthGrant, error) {
+
+	data, err := store.Redis.Get(oauthGrantStorageKey(grantID))
+
+	if err != nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	var grant OAuthGrant
+	err = json.Unmarshal(data, &grant)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+// ReadRefreshTokenGrant : Read the grant of an unexchanged refresh token
+func (store *OAuthTokenStore) ReadRefreshTokenGrant(refreshToken string) (*OAuthGrant, error) {
+
+	refreshTokenDigest := oauthTokenDigest(refreshToken)
+
+	grantID, err := store.Redis.Get(oauthRefreshTokenStorageKey(refreshTokenDigest))
+
+	if err != nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	grant, err := store.ReadGrant(string(grantID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if grant.RefreshTokenDigest != refreshTokenDigest {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	return grant, nil
+}
+
+// RevokeGrant : Revoke grant, its refresh token & access tokens
+func (store *OAuthTokenStore) RevokeGrant(grantID string) error {
+
+	grant, err := store.ReadGrant(grantID)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.Redis.Delete(oauthRefreshTokenStorageKey(grant.RefreshTokenDigest))
+
+	if err != nil {
+		return err
+	}
+
+	return store.Redis.Delete(oauthGrantStorageKey(grant.ID))
+}
+
+// ParseAccessToken : Verify access token signature, type, issuer & expiration. Use AccessTokenActive to check revocation
+func (store *OAuthTokenStore) ParseAccessToken(token string) (*OAuthAccessTokenClaims, error) {
+
+	var claims OAuthAccessTokenClaims
+
+	header, err := jwt.Parse(token, store.KeyRing.VerificationKey, &claims)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Type != jwt.TypeAccessToken || claims.Issuer != store.Config.Issuer || claims.Subject == "" || claims.ClientID == "" || claims.GrantID == "" {
+		return nil, errors.New("Invalid OAuth access token")
+	}
+
+	return &claims, nil
+}
+
+// AccessTokenActive : Check that access token was not revoked, nor its grant
+func (store *OAuthTokenStore) AccessTokenActive(claims *OAuthAccessTokenClaims) (bool, error) {
+
+	grantActive, err := store.Redis.Exists(oauthGrantStorageKey(claims.GrantID))
+
+	if err != nil || !grantActive {
+		return false, err
+	}
+
+	revoked, err := store.Redis.Exists(oauthAccessTokenStorageKey(claims.ID))
+
+	if err != nil {
+		return false, err
+	}
+
+	return !revoked, nil
+}
+
+// RevokeAccessToken : Deny access token until it expires
+func (store *OAuthTokenStore) RevokeAccessToken(claims *OAuthAccessTokenClaims) error {
+
+	remaining := time.Until(time.Unix(claims.ExpiresAt, 0).Add(jwt.Leeway))
+
+	if remaining <= 0 {
+		return nil
+	}
+
+	return store.Redis.SetWithExpiration(oauthAccessTokenStorageKey(claims.ID), []byte("1"), int(remaining.Seconds())+1)
+}
+
+// ConsentedScopes : Scopes user consented to grant client
+func (store *OAuthTokenStore) ConsentedScopes(userID string, clientID string) []string {
+
+	data, err := store.Redis.HGet(userOAuthConsentsStorageKey(userID), clientID)
+
+	if err != nil {
+		return []string{}
+	}
+
+	return ParseOAuthScope(string(data))
+}
+
+// AddConsent : Remember that user consented to grant scopes to client, on top of the already consented ones
+func (store *OAuthTokenStore) AddConsent(userID string, clientID string, scopes []string) error {
+
+	consented := store.ConsentedScopes(userID, clientID)
+
+	for _, scope := range scopes {
+
+		if !utils.IsStringIn(scope, consented) {
+			consented = append(consented, scope)
+		}
+	}
+
+	return store.Redis.HSet(userOAuthConsentsStorageKey(userID), clientID, []byte(strings.Join(consented, " ")))
+}
+
+// issueTokens : Generate new refresh & access tokens of scopes for grant, and store them
+func (store *OAuthTokenStore) issueTokens(grant *OAuthGrant, scopes []string) (*OAuthTokens, error) {
+
+	tokens, commands, err := store.newTokens(grant, scopes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.Redis.Multi(commands)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// newTokens : Generate new refresh & access tokens of scopes for grant, with the commands storing them
+func (store *OAuthTokenStore) newTokens(grant *OAuthGrant, scopes []string) (*OAuthTokens, []RedisCommand, error) {
+
+	refreshToken, err := generateOAuthToken()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	grant.RefreshTokenDigest = oauthTokenDigest(refreshToken)
+
+	accessToken, accessTokenExpiration, err := store.signAccessToken(grant, scopes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(grant)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expiration := int(store.Config.RefreshTokenExpiration().Seconds())
+
+	commands := []RedisCommand{
+		RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{oauthGrantStorageKey(grant.ID), expiration, data},
+		},
+		RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{oauthRefreshTokenStorageKey(grant.RefreshTokenDigest), expiration, []byte(grant.ID)},
+		},
+	}
+
+	return &OAuthTokens{
+		Grant:                 grant,
+		Scopes:                scopes,
+		AccessToken:           accessToken,
+		AccessTokenExpiration: accessTokenExpiration,
+		RefreshToken:          refreshToken,
+	}, commands, nil
+}
+
+// signAccessToken : Sign an access token of scopes for grant
+func (store *OAuthTokenStore) signAccessToken(grant *OAuthGrant, scopes []string) (string, time.Duration, error) {
+
+	signingKey, err := store.KeyRing.SigningKey()
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	expiration := store.Config.AccessTokenExpiration()
+
+	token, err := jwt.Sign(jwt.TypeAccessToken, OAuthAccessTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:    store.Config.Issuer,
+			Subject:   grant.UserID,
+			Audience:  grant.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiration).Unix(),
+			ID:        hex.EncodeToString(randomBytes),
+		},
+		ClientID: grant.ClientID,
+		Scope:    strings.Join(scopes, " "),
+		GrantID:  grant.ID,
+	}, signingKey)
+
+	return token, expiration, err
+}
+
+// generateOAuthToken : Generate a random opaque token (authorization code, refresh token)
+func generateOAuthToken() (string, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// oauthTokenDigest : Digest under which an opaque token is stored
+func oauthTokenDigest(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func oauthCodeStorageKey(codeDigest string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisOAuthCodePrefix, codeDigest, RedisOAuthCodeSuffix)
+}
+
+func oauthGrantStorageKey(grantID string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisOAuthGrantPrefix, grantID, RedisOAuthGrantSuffix)
+}
+
+func oauthRefreshTokenStorageKey(tokenDigest string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisOAuthRefreshTokenPrefix, tokenDigest, RedisOAuthRefreshTokenSuffix)
+}
+
+func oauthAccessTokenStorageKey(tokenID string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisOAuthAccessTokenPrefix, tokenID, RedisOAuthAccessTokenSuffix)
+}
+
+func userOAuthConsentsStorageKey(userID string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisUserStoragePrefix, userID, RedisUserOAuthConsentsSuffix)
+}
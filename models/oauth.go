@@ -0,0 +1,185 @@
+package models
+
+import (
+	strings "strings"
+	time "time"
+	utils "vulnlabs-rest-api/utils"
+
+	gormlib "github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// OAuth protocol values (RFC 6749, RFC 7636)
+const (
+	OAuthResponseTypeCode = "code"
+
+	OAuthGrantTypeAuthorizationCode = "authorization_code"
+	OAuthGrantTypeRefreshToken      = "refresh_token"
+
+	OAuthCodeChallengeMethodS256 = "S256"
+
+	OAuthTokenTypeBearer       = "Bearer"
+	OAuthTokenTypeAccessToken  = "access_token"
+	OAuthTokenTypeRefreshToken = "refresh_token"
+
+	OAuthConsentApprove = "approve"
+	OAuthConsentDeny    = "deny"
+)
+
+// OAuth error codes (RFC 6749 sections 4.1.2.1 & 5.2)
+const (
+	OAuthErrorInvalidRequest          = "invalid_request"
+	OAuthErrorInvalidClient           = "invalid_client"
+	OAuthErrorInvalidGrant            = "invalid_grant"
+	OAuthErrorInvalidScope            = "invalid_scope"
+	OAuthErrorUnauthorizedClient      = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrorUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrorAccessDenied            = "access_denied"
+	OAuthErrorLoginRequired           = "login_required"
+	OAuthErrorConsentRequired         = "consent_required"
+	OAuthErrorServerError             = "server_error"
+)
+
+// OAuthClient : Application authenticating users against this API. Only its secret hash is stored
+type OAuthClient struct {
+	ID         string `json:"id" gorm:"primary_key;unique;not null;"`
+	Name       string `json:"name" gorm:"not null;"`
+	SecretHash string `json:"-"`
+
+	// Public clients (SPAs, native apps) cannot keep a secret : they have none, and must use PKCE
+	Public bool `json:"public"`
+
+	// Users are not asked to consent to first-party clients
+	FirstParty bool `json:"firstParty"`
+
+	RedirectURIs SpaceSeparatedList `json:"redirectURIs" gorm:"type:varchar(2048);not null;"`
+
+	// Scopes the client may request
+	Scopes SpaceSeparatedList `json:"scopes" gorm:"type:varchar(1024);not null;"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BeforeCreate : Run before DB Insertion
+func (client *OAuthClient) BeforeCreate(scope *gormlib.Scope) error {
+
+	client.ID = uuid.NewV4().String()
+
+	return nil
+}
+
+// OAuthClientCreateRequest : OAuth client registration request body
+type OAuthClientCreateRequest struct {
+	Name         string   `json:"name" validate:"required,max=64"`
+	Public       bool     `json:"public"`
+	FirstParty   bool     `json:"firstParty"`
+	RedirectURIs []string `json:"redirectURIs" validate:"required,max=8"`
+	Scopes       []string `json:"scopes" validate:"max=32"`
+}
+
+// CreatedOAuthClient : OAuth client returned at registration, the only time its secret is returned in clear
+type CreatedOAuthClient struct {
+	OAuthClient
+	Secret string `json:"secret,omitempty"`
+}
+
+// OAuthClientInfo : Public OAuth client infos, as displayed on the consent page
+type OAuthClientInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// OAuthAuthorizationCode : Authorization request approved by a user, stored behind its single-use code
+type OAuthAuthorizationCode struct {
+	ClientID            string    `json:"clientID"`
+	UserID              string    `json:"userID"`
+	Scopes              []string  `json:"scopes"`
+	RedirectURI         string    `json:"redirectURI"`
+	RedirectURIProvided bool      `json:"redirectURIProvided"`
+	CodeChallenge       string    `json:"codeChallenge"`
+	CodeChallengeMethod string    `json:"codeChallengeMethod"`
+	AuthTime            time.Time `json:"authTime"`
+
+	// OpenID Connect nonce, returned in the ID token
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// OAuthGrant : Authorization of a client by a user, from which tokens are issued until it is revoked or expires
+type OAuthGrant struct {
+	ID                 string    `json:"id"`
+	ClientID           string    `json:"clientID"`
+	UserID             string    `json:"userID"`
+	Scopes             []string  `json:"scopes"`
+	AuthTime           time.Time `json:"authTime"`
+	CreatedAt          time.Time `json:"createdAt"`
+	RefreshTokenDigest string    `json:"refreshTokenDigest"`
+}
+
+// OAuthTokens : Tokens issued from a grant
+type OAuthTokens struct {
+	Grant                 *OAuthGrant
+	Scopes                []string
+	AccessToken           string
+	AccessTokenExpiration time.Duration
+	RefreshToken          string
+
+	// Only issued for the openid scope
+	IDToken string
+}
+
+// OAuthTokenResponse : Token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OAuthErrorResponse : OAuth error response (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthIntrospection : Token introspection response (RFC 7662). Only Active is set for inactive tokens
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// OAuthAuthorizationRedirect : Where the consent page sends the user back to the client
+type OAuthAuthorizationRedirect struct {
+	RedirectURI string `json:"redirectURI"`
+}
+
+// IsOAuthScope : Check wether scope can be requested by OAuth clients
+func IsOAuthScope(scope string) bool {
+
+	return utils.IsStringIn(scope, Permissions) || isOIDCScope(scope)
+}
+
+// ParseOAuthScope : Scopes of a space separated scope parameter, deduplicated
+func ParseOAuthScope(scope string) []string {
+
+	scopes := []string{}
+
+	for _, s := range strings.Fields(scope) {
+
+		if !utils.IsStringIn(s, scopes) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	sha256 "crypto/sha256"
+	sha512 "crypto/sha512"
+	base64 "encoding/base64"
+	fmt "fmt"
+	strings "strings"
+	time "time"
+	jwt "vulnlabs-rest-api/jwt"
+	utils "vulnlabs-rest-api/utils"
+)
+
+// OpenID Connect scopes (OpenID Connect Core section 5.4). Role is specific to this API
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+	OIDCScopeEmail   = "email"
+	OIDCScopePhone   = "phone"
+	OIDCScopeRole    = "role"
+)
+
+var (
+	// OIDCScopeClaims : User claims released by each OpenID Connect scope, in ID tokens & at the userinfo endpoint
+	OIDCScopeClaims = map[string][]string{
+		OIDCScopeOpenID:  []string{"sub"},
+		OIDCScopeProfile: []string{"name", "given_name", "family_name", "picture"},
+		OIDCScopeEmail:   []string{"email", "email_verified"},
+		OIDCScopePhone:   []string{"phone_number", "phone_number_verified"},
+		OIDCScopeRole:    []string{"role"},
+	}
+
+	// OIDCScopes : All OpenID Connect scopes
+	OIDCScopes = []string{
+		OIDCScopeOpenID,
+		OIDCScopeProfile,
+		OIDCScopeEmail,
+		OIDCScopePhone,
+		OIDCScopeRole,
+	}
+)
+
+// OIDCUserClaims : Standard claims of a user (OpenID Connect Core section 5.1), only set for the granted scopes
+type OIDCUserClaims struct {
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Picture    string `json:"picture,omitempty"`
+
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+
+	Role string `json:"role,omitempty"`
+}
+
+// OIDCIDTokenClaims : Claims of ID tokens (OpenID Connect Core section 2)
+type OIDCIDTokenClaims struct {
+	jwt.Claims
+	AuthTime        int64  `json:"auth_time"`
+	Nonce           string `json:"nonce,omitempty"`
+	AccessTokenHash string `json:"at_hash,omitempty"`
+	OIDCUserClaims
+}
+
+// OIDCUserInfo : Userinfo endpoint response (OpenID Connect Core section 5.3.2)
+type OIDCUserInfo struct {
+	Subject string `json:"sub"`
+	OIDCUserClaims
+}
+
+// OpenIDConfiguration : OpenID provider metadata (OpenID Connect Discovery section 3)
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// NewOIDCUserClaims : Claims of user released by scopes
+func NewOIDCUserClaims(user *User, scopes []string) OIDCUserClaims {
+
+	claims := OIDCUserClaims{}
+
+	if utils.IsStringIn(OIDCScopeProfile, scopes) {
+		claims.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+		claims.Picture = user.ProfilePictureURL
+	}
+
+	if utils.IsStringIn(OIDCScopeEmail, scopes) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+
+	// Phone numbers are never verified by this API
+	if utils.IsStringIn(OIDCScopePhone, scopes) && user.PhoneNumber != "" {
+		phoneNumberVerified := false
+		claims.PhoneNumber = user.PhoneNumber
+		claims.PhoneNumberVerified = &phoneNumberVerified
+	}
+
+	if utils.IsStringIn(OIDCScopeRole, scopes) {
+		claims.Role = string(user.Role)
+	}
+
+	return claims
+}
+
+// NewOpenIDConfiguration : Provider metadata of the authorization server of config, whose ID tokens are signed with
+// signingAlgorithm
+func NewOpenIDConfiguration(config OAuthConfig, signingAlgorithm string) *OpenIDConfiguration {
+
+	scopes := append(append([]string{}, OIDCScopes...), Permissions...)
+	claims := []string{"iss", "aud", "exp", "iat", "auth_time", "nonce"}
+
+	for _, scope := range OIDCScopes {
+		claims = append(claims, OIDCScopeClaims[scope]...)
+	}
+
+	return &OpenIDConfiguration{
+		Issuer:                            config.Issuer,
+		AuthorizationEndpoint:             config.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     config.Issuer + "/oauth/token",
+		UserInfoEndpoint:                  config.Issuer + "/oauth/userinfo",
+		JWKSURI:                           config.Issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                config.Issuer + "/oauth/revoke",
+		IntrospectionEndpoint:             config.Issuer + "/oauth/introspect",
+		ScopesSupported:                   scopes,
+		ClaimsSupported:                   claims,
+		ResponseTypesSupported:            []string{OAuthResponseTypeCode},
+		GrantTypesSupported:               []string{OAuthGrantTypeAuthorizationCode, OAuthGrantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{OAuthCodeChallengeMethodS256},
+	}
+}
+
+// CheckIDTokenSigningKey : Check the active key of ring signs ID tokens relying parties can verify, when the
+// authorization server of config is enabled. HS256 ID tokens could only be verified with the secret of the key ring
+func CheckIDTokenSigningKey(config OAuthConfig, ring *KeyRing) error {
+
+	if config.Issuer == "" {
+		return nil
+	}
+
+	signingKey, err := ring.SigningKey()
+
+	if err != nil {
+		return fmt.Errorf("OAuth issuer %s requires an active EdDSA signing key : %v", config.Issuer, err)
+	}
+
+	if signingKey.Algorithm != jwt.AlgorithmEdDSA {
+		return fmt.Errorf("OAuth issuer %s requires an active EdDSA signing key, %s is %s", config.Issuer, signingKey.ID, signingKey.Algorithm)
+	}
+
+	return nil
+}
+
+// SignIDToken : Sign an ID token for user, audience of tokens client, carrying the claims of tokens scopes
+func (store *OAuthTokenStore) SignIDToken(tokens *OAuthTokens, user *User, nonce string) (string, error) {
+
+	signingKey, err := store.KeyRing.SigningKey()
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	return jwt.Sign(jwt.TypeJWT, OIDCIDTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:    store.Config.Issuer,
+			Subject:   user.ID,
+			Audience:  tokens.Grant.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(store.Config.AccessTokenExpiration()).Unix(),
+		},
+		AuthTime:        tokens.Grant.AuthTime.Unix(),
+		Nonce:           nonce,
+		AccessTokenHash: accessTokenHash(signingKey.Algorithm, tokens.AccessToken),
+		OIDCUserClaims:  NewOIDCUserClaims(user, tokens.Scopes),
+	}, signingKey)
+}
+
+// accessTokenHash : at_hash of accessToken, the left half of its hash by the hash function of algorithm
+func accessTokenHash(algorithm string, accessToken string) string {
+
+	var sum []byte
+
+	switch algorithm {
+	case jwt.AlgorithmEdDSA:
+		digest := sha512.Sum512([]byte(accessToken))
+		sum = digest[:]
+	default:
+		digest := sha256.Sum256([]byte(accessToken))
+		sum = digest[:]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// isOIDCScope : Check wether scope is an OpenID Connect scope
+func isOIDCScope(scope string) bool {
+
+	return utils.IsStringIn(scope, OIDCScopes)
+}
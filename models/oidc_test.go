@@ -0,0 +1,44 @@
+package models
+
+import (
+	base64 "encoding/base64"
+	strings "strings"
+	testing "testing"
+	jwt "vulnlabs-rest-api/jwt"
+)
+
+func TestCheckIDTokenSigningKey(t *testing.T) {
+
+	secret := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+	keys := []SigningKeyConfig{
+		{ID: "hs256", Algorithm: jwt.AlgorithmHS256, Secret: secret},
+		{ID: "eddsa", Algorithm: jwt.AlgorithmEdDSA, Secret: secret},
+	}
+
+	tests := []struct {
+		name        string
+		issuer      string
+		activeKeyID string
+		valid       bool
+	}{
+		{"EdDSA active key", "https://api.example.com", "eddsa", true},
+		{"HS256 active key", "https://api.example.com", "hs256", false},
+		{"no active key", "https://api.example.com", "", false},
+		{"OAuth disabled", "", "hs256", true},
+		{"OAuth disabled without key", "", "", true},
+	}
+
+	for _, test := range tests {
+
+		ring, err := NewKeyRing(KeyRingConfig{ActiveKeyID: test.activeKeyID, Keys: keys})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := CheckIDTokenSigningKey(OAuthConfig{Issuer: test.issuer}, ring); (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	errors "errors"
+	math "math"
+	time "time"
+)
+
+const (
+	RateLimiterStoreRedis  = "redis"
+	RateLimiterStoreMemory = "memory"
+
+	// Rate limits scopes
+	RateLimitByUser = "user"
+	RateLimitByIP   = "ip"
+)
+
+// RateLimiter : Sliding window request counters
+type RateLimiter interface {
+	// Hit : Count a request of key against limit
+	Hit(key string, limit RateLimit) (*RateLimitResult, error)
+}
+
+// RateLimit : Requests allowed per window
+type RateLimit struct {
+	Requests        int `json:"requests"`
+	WindowInSeconds int `json:"windowInSeconds"`
+
+	// Requests are counted per authenticated user (per IP for anonymous requests) with "user", or per IP with "ip"
+	By string `json:"by"`
+}
+
+// Window : Limit window duration
+func (limit RateLimit) Window() time.Duration {
+
+	return time.Duration(limit.WindowInSeconds) * time.Second
+}
+
+// Enabled : Wether limit has requests & a window set
+func (limit RateLimit) Enabled() bool {
+
+	return limit.Requests > 0 && limit.WindowInSeconds > 0
+}
+
+// RateLimitResult : Outcome of a counted request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Until the current window ends
+	Reset time.Duration
+}
+
+// NewRateLimiter : Return the rate limiter described by config. Redis limiter falls back to memory when Redis fails
+func NewRateLimiter(redis RedisInterface, config *RateLimitingConfig) (RateLimiter, error) {
+
+	switch config.Store {
+	case "", RateLimiterStoreRedis:
+		return NewRedisRateLimiter(redis, NewMemoryRateLimiter()), nil
+	case RateLimiterStoreMemory:
+		return NewMemoryRateLimiter(), nil
+	}
+
+	return nil, errors.New("unknown rate limiter store " + config.Store)
+}
+
+// slidingWindowResult : Weight previous window count by its part still covered by the sliding window,
+// approximating the requests of the last window duration
+func slidingWindowResult(limit RateLimit, now time.Time, previous int, current int) *RateLimitResult {
+
+	window := limit.Window()
+	elapsed := now.Sub(now.Truncate(window))
+
+	count := float64(previous)*(1-float64(elapsed)/float64(window)) + float64(current)
+	remaining := limit.Requests - int(math.Ceil(count))
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &RateLimitResult{
+		Allowed:   count <= float64(limit.Requests),
+		Limit:     limit.Requests,
+		Remaining: remaining,
+		Reset:     window - elapsed,
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	testing "testing"
+	time "time"
+)
+
+func TestSlidingWindowResult(t *testing.T) {
+
+	limit := RateLimit{Requests: 10, WindowInSeconds: 60}
+
+	// Minute-aligned time, windows starting on minutes
+	windowStart := time.Unix(1560000000, 0)
+
+	tests := []struct {
+		name      string
+		elapsed   time.Duration
+		previous  int
+		current   int
+		allowed   bool
+		remaining int
+		reset     time.Duration
+	}{
+		{"first request", 0, 0, 1, true, 9, 60 * time.Second},
+		{"at limit", 30 * time.Second, 0, 10, true, 0, 30 * time.Second},
+		{"beyond limit", 30 * time.Second, 0, 11, false, 0, 30 * time.Second},
+		{"previous window fully counted", 0, 10, 1, false, 0, 60 * time.Second},
+		{"previous window quarter elapsed", 15 * time.Second, 8, 2, true, 2, 45 * time.Second},
+		{"previous window half elapsed", 30 * time.Second, 10, 6, false, 0, 30 * time.Second},
+		{"previous window almost over", 54 * time.Second, 10, 9, true, 0, 6 * time.Second},
+		{"partial request rounded up", 45 * time.Second, 1, 1, true, 8, 15 * time.Second},
+	}
+
+	for _, test := range tests {
+
+		result := slidingWindowResult(limit, windowStart.Add(test.elapsed), test.previous, test.current)
+
+		if result.Allowed != test.allowed || result.Remaining != test.remaining || result.Reset != test.reset || result.Limit != limit.Requests {
+			t.Errorf("%s : got %+v, want allowed %t remaining %d reset %s", test.name, result, test.allowed, test.remaining, test.reset)
+		}
+	}
+}
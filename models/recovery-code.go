@@ -0,0 +1,8 @@
+package models
+
+// RecoveryCode : Single-use MFA recovery code. Only its hash is stored
+type RecoveryCode struct {
+	ID       uint   `json:"-" gorm:"primary_key"`
+	UserID   string `json:"-" gorm:"not null;index;"`
+	CodeHash string `json:"-" gorm:"not null;unique;"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	fmt "fmt"
+	log "log"
+	strconv "strconv"
+	time "time"
+)
+
+// Rate limit counters layout in Redis :
+//   rate-limit:<key>:<window start> -> requests count (expires after the following window)
+
+// RedisRateLimiter : Rate limiter shared by all API instances through Redis
+type RedisRateLimiter struct {
+	Redis RedisInterface
+
+	// Used while Redis is unavailable, not to block nor let through all requests
+	Fallback RateLimiter
+}
+
+// NewRedisRateLimiter : Return a new Redis rate limiter
+func NewRedisRateLimiter(redis RedisInterface, fallback RateLimiter) *RedisRateLimiter {
+
+	return &RedisRateLimiter{
+		Redis:    redis,
+		Fallback: fallback,
+	}
+}
+
+func (limiter *RedisRateLimiter) Hit(key string, limit RateLimit) (*RateLimitResult, error) {
+
+	now := time.Now()
+	windowStart := now.Truncate(limit.Window())
+
+	currentKey := fmt.Sprintf("%s:%s:%d", RedisRateLimitPrefix, key, windowStart.Unix())
+	previousKey := fmt.Sprintf("%s:%s:%d", RedisRateLimitPrefix, key, windowStart.Add(-limit.Window()).Unix())
+
+	current, err := limiter.Redis.Incr(currentKey)
+
+	if err == nil && current == 1 {
+		err = limiter.Redis.Expire(currentKey, 2*limit.WindowInSeconds)
+	}
+
+	if err != nil {
+
+		if limiter.Fallback == nil {
+			return nil, err
+		}
+
+		log.Printf("Rate limiting falls back to memory : %v", err)
+		return limiter.Fallback.Hit(key, limit)
+	}
+
+	// No previous window
+	previous := 0
+
+	if data, err := limiter.Redis.Get(previousKey); err == nil {
+		previous, _ = strconv.Atoi(string(data))
+	}
+
+	return slidingWindowResult(limit, now, previous, current), nil
+}
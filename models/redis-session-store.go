@@ -0,0 +1,272 @@
+package models
+
+import (
+	json "encoding/json"
+	fmt "fmt"
+	time "time"
+)
+
+// Session storage layout in Redis :
+//   session:<digest>:userID -> userID (expires with the session, slid on activity)
+//   user:<userID>:sessions  -> hash of session ID -> JSON session record
+
+// RedisSessionStore : Session store backed by Redis
+type RedisSessionStore struct {
+	Redis  RedisInterface
+	Config *SessionsConfig
+}
+
+// NewRedisSessionStore : Return a new Redis session store
+func NewRedisSessionStore(redis RedisInterface, config *SessionsConfig) *RedisSessionStore {
+
+	return &RedisSessionStore{
+		Redis:  redis,
+		Config: config,
+	}
+}
+
+func (store *RedisSessionStore) CreateSession(userID string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	sessions, err := store.ListUserSessions(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessionsToEvict(sessions, store.Config.MaxSessionsPerUser) {
+
+		err = store.DeleteUserSession(userID, session.ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	record, sessionToken, err := newSessionRecord(*store.Config, userID, ip, userAgent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := SessionExpiration(*store.Config, record.CreatedAt, record.CreatedAt)
+
+	// Init Redis transaction to add datas to User and Session storage
+	transactionCommands := []RedisCommand{
+		RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{sessionStorageKey(record.TokenDigest), int(expiration.Seconds()), []byte(userID)},
+		},
+		RedisCommand{
+			Command: "HSET",
+			Args:    []interface{}{userSessionsStorageKey(userID), record.ID, data},
+		},
+	}
+
+	_, err = store.Redis.Multi(transactionCommands)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionCredentials{
+		Token:           sessionToken,
+		TokenExpiration: expiration,
+	}, nil
+}
+
+func (store *RedisSessionStore) RotateSession(refreshToken string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	return rotateSession(store, refreshToken, ip, userAgent)
+}
+
+func (store *RedisSessionStore) ReadSessionUserID(token string) (string, error) {
+
+	userID, err := store.Redis.Get(sessionStorageKey(SessionTokenDigest(*store.Config, token)))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(userID), nil
+}
+
+func (store *RedisSessionStore) SessionID(token string) (string, error) {
+
+	return SessionID(token), nil
+}
+
+func (store *RedisSessionStore) RefreshSession(userID string, token string) (time.Duration, bool, error) {
+
+	record, err := store.readSessionRecord(userID, SessionID(token))
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	now := time.Now().UTC()
+
+	// Absolute lifetime cannot be extended
+	if now.Sub(record.CreatedAt) >= store.Config.AbsoluteTimeout() {
+
+		store.DeleteUserSession(userID, record.ID)
+		return 0, false, ErrSessionExpired
+	}
+
+	if now.Sub(record.LastSeenAt) < store.Config.RefreshThrottle() {
+		return record.LastSeenAt.Add(SessionExpiration(*store.Config, record.CreatedAt, record.LastSeenAt)).Sub(now), false, nil
+	}
+
+	record.LastSeenAt = now
+	expiration := SessionExpiration(*store.Config, record.CreatedAt, now)
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	transactionCommands := []RedisCommand{
+		RedisCommand{
+			Command: "EXPIRE",
+			Args:    []interface{}{sessionStorageKey(record.TokenDigest), int(expiration.Seconds())},
+		},
+		RedisCommand{
+			Command: "HSET",
+			Args:    []interface{}{userSessionsStorageKey(userID), record.ID, data},
+		},
+	}
+
+	_, err = store.Redis.Multi(transactionCommands)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return expiration, true, nil
+}
+
+// ListUserSessions : Records of expired sessions are pruned
+func (store *RedisSessionStore) ListUserSessions(userID string) ([]Session, error) {
+
+	records, err := store.Redis.HGetAll(userSessionsStorageKey(userID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+
+	for sessionID, data := range records {
+
+		var record sessionRecord
+		err = json.Unmarshal(data, &record)
+
+		if err != nil {
+			store.Redis.HDel(userSessionsStorageKey(userID), sessionID)
+			continue
+		}
+
+		exists, err := store.Redis.Exists(sessionStorageKey(record.TokenDigest))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			store.Redis.HDel(userSessionsStorageKey(userID), sessionID)
+			continue
+		}
+
+		record.UserID = userID
+		sessions = append(sessions, record.Session)
+	}
+
+	return sessions, nil
+}
+
+func (store *RedisSessionStore) DeleteUserSession(userID string, sessionID string) error {
+
+	record, err := store.readSessionRecord(userID, sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.Redis.Delete(sessionStorageKey(record.TokenDigest))
+
+	if err != nil {
+		return err
+	}
+
+	return store.Redis.HDel(userSessionsStorageKey(userID), sessionID)
+}
+
+func (store *RedisSessionStore) DeleteUserSessions(userID string, exceptSessionID string) error {
+
+	records, err := store.Redis.HGetAll(userSessionsStorageKey(userID))
+
+	if err != nil {
+		return err
+	}
+
+	for sessionID, data := range records {
+
+		if sessionID == exceptSessionID {
+			continue
+		}
+
+		var record sessionRecord
+
+		if json.Unmarshal(data, &record) == nil {
+
+			err = store.Redis.Delete(sessionStorageKey(record.TokenDigest))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = store.Redis.HDel(userSessionsStorageKey(userID), sessionID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readSessionRecord : Read session record from the user session set
+func (store *RedisSessionStore) readSessionRecord(userID string, sessionID string) (*sessionRecord, error) {
+
+	data, err := store.Redis.HGet(userSessionsStorageKey(userID), sessionID)
+
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	var record sessionRecord
+	err = json.Unmarshal(data, &record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record.UserID = userID
+
+	return &record, nil
+}
+
+func sessionStorageKey(tokenDigest string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisSessionStoragePrefix, tokenDigest, RedisSessionStorageUserIDSuffix)
+}
+
+func userSessionsStorageKey(userID string) string {
+	return fmt.Sprintf("%s:%s:%s", RedisUserStoragePrefix, userID, RedisUserStorageSessionsSuffix)
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	errors "errors"
 	fmt "fmt"
+	time "time"
 	utils "vulnlabs-rest-api/utils"
 
 	"github.com/gomodule/redigo/redis"
@@ -12,7 +14,37 @@ const (
 	RedisSessionStoragePrefix       = "session"
 	RedisSessionStorageUserIDSuffix = "userID"
 	RedisUserStoragePrefix          = "user"
-	RedisUserStorageSessionSuffix   = "session"
+	RedisUserStorageSessionsSuffix  = "sessions"
+	RedisUserStorageMFAStepSuffix   = "mfaStep"
+	RedisMFAStoragePrefix           = "mfa"
+	RedisMFAStorageUserIDSuffix     = "userID"
+	RedisMFAStorageAttemptsSuffix   = "attempts"
+	RedisPasswordResetStoragePrefix = "password-reset"
+	RedisPasswordResetUserIDSuffix  = "userID"
+	RedisEmailVerificationPrefix    = "email-verification"
+	RedisEmailVerificationSuffix    = "verification"
+	RedisLoginAccountPrefix         = "login-account"
+	RedisLoginIPPrefix              = "login-ip"
+	RedisLoginFailuresSuffix        = "failures"
+	RedisLoginLockedUntilSuffix     = "lockedUntil"
+	RedisRateLimitPrefix            = "rate-limit"
+	RedisRefreshTokenPrefix         = "refresh-token"
+	RedisRefreshTokenSessionSuffix  = "session"
+	RedisUserRefreshSessionsSuffix  = "refreshSessions"
+	RedisUserOAuthConsentsSuffix    = "oauthConsents"
+	RedisOAuthCodePrefix            = "oauth-code"
+	RedisOAuthCodeSuffix            = "code"
+	RedisOAuthGrantPrefix           = "oauth-grant"
+	RedisOAuthGrantSuffix           = "grant"
+	RedisOAuthRefreshTokenPrefix    = "oauth-refresh-token"
+	RedisOAuthRefreshTokenSuffix    = "grantID"
+	RedisOAuthAccessTokenPrefix     = "oauth-access-token"
+	RedisOAuthAccessTokenSuffix     = "revoked"
+	RedisFederationStatePrefix      = "federation-state"
+	RedisFederationStateSuffix      = "state"
+
+	// Attempts of a watched transaction aborted by concurrent changes
+	RedisTransactionMaxAttempts = 3
 )
 
 // RedisInterface : Redis Communication interface
@@ -21,15 +53,27 @@ type RedisInterface interface {
 	Get(key string) ([]byte, error)
 	Set(key string, value []byte) error
 	SetWithExpiration(key string, value []byte, expirationInSeconds int) error
+	SetIfNotExists(key string, value []byte, expirationInSeconds int) (bool, error)
 	Exists(key string) (bool, error)
 	Delete(key string) error
+	Expire(key string, expirationInSeconds int) error
+	HGet(key string, field string) ([]byte, error)
+	HGetAll(key string) (map[string][]byte, error)
+	HSet(key string, field string, value []byte) error
+	HDel(key string, field string) error
 	Incr(counterKey string) (int, error)
+	Decr(counterKey string) (int, error)
 	Multi(commands []RedisCommand) ([]interface{}, error)
+	Watch(keys []string, transaction func() ([]RedisCommand, error)) ([]interface{}, error)
 }
 
-// Redis : Redis communication interface
+// ErrRedisTransactionAborted : Watched keys changed before the transaction ran, it may be retried
+var ErrRedisTransactionAborted = errors.New("Redis transaction aborted, watched keys changed")
+
+// Redis : Redis communication interface. Each call takes its own connection from Pool, so that concurrent
+// requests never interleave their commands, in particular within transactions
 type Redis struct {
-	Connection redis.Conn
+	Pool *redis.Pool
 }
 
 // RedisCommand : Redis command struct
@@ -41,33 +85,49 @@ type RedisCommand struct {
 // NewRedis : Return a new Redis abstraction struct
 func NewRedis(connectionURL string, password string) *Redis {
 
-	// Initialize the redis connection to a redis instance running on your local machine
-	conn, err := redisgo.DialURL(connectionURL)
+	// Pool of authenticated connections to a redis instance running on your local machine
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redisgo.DialURL(connectionURL, redisgo.DialPassword(password))
+		},
+	}
+
+	// Fail fast when Redis cannot be reached
+	conn := pool.Get()
+	_, err := conn.Do("PING")
+	conn.Close()
 
 	if err != nil {
 		utils.PanicOnError(err, "Failed to connect to Redis")
 	}
 
-	// Authenticate to Redis
-	conn.Do("AUTH", password)
-
-	// Return new MongoDB abstraction struct
 	return &Redis{
-		Connection: conn,
+		Pool: pool,
 	}
 }
 
-// CloseConnection : Close Redis Connection
+// CloseConnection : Close Redis connections pool
 func (redis *Redis) CloseConnection() error {
 
-	return redis.Connection.Close()
+	return redis.Pool.Close()
+}
+
+// do : Run command on a connection of the pool
+func (redis *Redis) do(command string, args ...interface{}) (interface{}, error) {
+
+	conn := redis.Pool.Get()
+	defer conn.Close()
+
+	return conn.Do(command, args...)
 }
 
 func (redis *Redis) Get(key string) ([]byte, error) {
 
 	var data []byte
 
-	data, err := redisgo.Bytes(redis.Connection.Do("GET", key))
+	data, err := redisgo.Bytes(redis.do("GET", key))
 
 	if err != nil {
 		return nil, fmt.Errorf("error getting key %s : %v", key, err)
@@ -78,7 +138,7 @@ func (redis *Redis) Get(key string) ([]byte, error) {
 func (redis *Redis) HGet(key string, field string) ([]byte, error) {
 
 	var data []byte
-	data, err := redisgo.Bytes(redis.Connection.Do("HGET", key, field))
+	data, err := redisgo.Bytes(redis.do("HGET", key, field))
 
 	if err != nil {
 		return nil, fmt.Errorf("error getting key %s : %v", key, err)
@@ -86,18 +146,49 @@ func (redis *Redis) HGet(key string, field string) ([]byte, error) {
 	return data, nil
 }
 
-func (redis *Redis) HSet(key string, field1 string, value1 []byte, field2 string, value2 []byte) error {
+func (redis *Redis) HGetAll(key string) (map[string][]byte, error) {
+
+	values, err := redisgo.Values(redis.do("HGETALL", key))
 
-	_, err := redis.Connection.Do("HSET", key, field1, value1, field2, value2)
 	if err != nil {
-		return fmt.Errorf("error setting key %s to %s : %v", key, value1, err)
+		return nil, fmt.Errorf("error getting key %s : %v", key, err)
 	}
+
+	data := map[string][]byte{}
+
+	for i := 0; i+1 < len(values); i += 2 {
+
+		field, _ := redisgo.String(values[i], nil)
+		value, _ := redisgo.Bytes(values[i+1], nil)
+		data[field] = value
+	}
+
+	return data, nil
+}
+
+func (redis *Redis) HSet(key string, field string, value []byte) error {
+
+	_, err := redis.do("HSET", key, field, value)
+	if err != nil {
+		return fmt.Errorf("error setting field %s of key %s : %v", field, key, err)
+	}
+	return nil
+}
+
+func (redis *Redis) HDel(key string, field string) error {
+
+	_, err := redis.do("HDEL", key, field)
+
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (redis *Redis) SetWithExpiration(key string, value []byte, expirationInSeconds int) error {
 
-	_, err := redis.Connection.Do("SETEX", key, fmt.Sprintf("%d", expirationInSeconds), value)
+	_, err := redis.do("SETEX", key, fmt.Sprintf("%d", expirationInSeconds), value)
 	if err != nil {
 		v := string(value)
 		if len(v) > 15 {
@@ -108,9 +199,21 @@ func (redis *Redis) SetWithExpiration(key string, value []byte, expirationInSeco
 	return nil
 }
 
+// SetIfNotExists : Set key with expiration unless it already exists, telling whether it was set
+func (redis *Redis) SetIfNotExists(key string, value []byte, expirationInSeconds int) (bool, error) {
+
+	reply, err := redis.do("SET", key, value, "EX", expirationInSeconds, "NX")
+
+	if err != nil {
+		return false, fmt.Errorf("error setting key %s : %v", key, err)
+	}
+
+	return reply != nil, nil
+}
+
 func (redis *Redis) Set(key string, value []byte) error {
 
-	_, err := redis.Connection.Do("SET", key, value)
+	_, err := redis.do("SET", key, value)
 	if err != nil {
 		v := string(value)
 		if len(v) > 15 {
@@ -123,7 +226,7 @@ func (redis *Redis) Set(key string, value []byte) error {
 
 func (redis *Redis) Rename(oldKey string, newKey string) error {
 
-	_, err := redis.Connection.Do("RENAME", oldKey, newKey)
+	_, err := redis.do("RENAME", oldKey, newKey)
 	if err != nil {
 		return fmt.Errorf("error renaming key %s to %s : %v", oldKey, newKey, err)
 	}
@@ -132,7 +235,7 @@ func (redis *Redis) Rename(oldKey string, newKey string) error {
 
 func (redis *Redis) Exists(key string) (bool, error) {
 
-	ok, err := redisgo.Bool(redis.Connection.Do("EXISTS", key))
+	ok, err := redisgo.Bool(redis.do("EXISTS", key))
 	if err != nil {
 		return ok, fmt.Errorf("error checking if key %s exists : %v", key, err)
 	}
@@ -141,7 +244,7 @@ func (redis *Redis) Exists(key string) (bool, error) {
 
 func (redis *Redis) Delete(key string) error {
 
-	_, err := redis.Connection.Do("DEL", key)
+	_, err := redis.do("DEL", key)
 
 	if err != nil {
 		return err
@@ -150,12 +253,23 @@ func (redis *Redis) Delete(key string) error {
 	return nil
 }
 
+func (redis *Redis) Expire(key string, expirationInSeconds int) error {
+
+	_, err := redis.do("EXPIRE", key, expirationInSeconds)
+
+	if err != nil {
+		return fmt.Errorf("error setting expiration of key %s : %v", key, err)
+	}
+
+	return nil
+}
+
 func (redis *Redis) GetKeys(pattern string) ([]string, error) {
 
 	iter := 0
 	keys := []string{}
 	for {
-		arr, err := redisgo.Values(redis.Connection.Do("SCAN", iter, "MATCH", pattern))
+		arr, err := redisgo.Values(redis.do("SCAN", iter, "MATCH", pattern))
 		if err != nil {
 			return keys, fmt.Errorf("error retrieving '%s' keys", pattern)
 		}
@@ -174,18 +288,72 @@ func (redis *Redis) GetKeys(pattern string) ([]string, error) {
 
 func (redis *Redis) Incr(counterKey string) (int, error) {
 
-	return redisgo.Int(redis.Connection.Do("INCR", counterKey))
+	return redisgo.Int(redis.do("INCR", counterKey))
 }
 
+func (redis *Redis) Decr(counterKey string) (int, error) {
+
+	return redisgo.Int(redis.do("DECR", counterKey))
+}
+
+// Multi : Run commands in a transaction, on a connection of their own
 func (redis *Redis) Multi(commands []RedisCommand) ([]interface{}, error) {
 
-	redis.Connection.Send("MULTI")
+	conn := redis.Pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
 
 	for _, cmd := range commands {
-		redis.Connection.Send(cmd.Command, cmd.Args...)
+		conn.Send(cmd.Command, cmd.Args...)
 	}
 
-	r, err := redisgo.Values(redis.Connection.Do("EXEC"))
+	r, err := redisgo.Values(conn.Do("EXEC"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Watch : Run the commands returned by transaction in a transaction, which is aborted with ErrRedisTransactionAborted
+// if keys changed since transaction was called. Keys read by transaction are thus checked & set atomically
+func (redis *Redis) Watch(keys []string, transaction func() ([]RedisCommand, error)) ([]interface{}, error) {
+
+	conn := redis.Pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{}
+
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	_, err := conn.Do("WATCH", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	commands, err := transaction()
+
+	if err != nil {
+		conn.Do("UNWATCH")
+		return nil, err
+	}
+
+	conn.Send("MULTI")
+
+	for _, cmd := range commands {
+		conn.Send(cmd.Command, cmd.Args...)
+	}
+
+	r, err := redisgo.Values(conn.Do("EXEC"))
+
+	if err == redisgo.ErrNil {
+		return nil, ErrRedisTransactionAborted
+	}
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,78 @@
+package models
+
+import (
+	utils "vulnlabs-rest-api/utils"
+)
+
+// Permissions required by routes, granted to roles
+const (
+	PermissionAll = "*"
+
+	PermissionAccountRead  = "account:read"
+	PermissionAccountWrite = "account:write"
+
+	PermissionUsersRead           = "users:read"
+	PermissionUsersWrite          = "users:write"
+	PermissionUsersDelete         = "users:delete"
+	PermissionUsersSessionsRevoke = "users:sessions:revoke"
+	PermissionOAuthClientsRead    = "oauth:clients:read"
+	PermissionOAuthClientsWrite   = "oauth:clients:write"
+)
+
+var (
+	// Permissions : All permissions, PermissionAll aside
+	Permissions = []string{
+		PermissionAccountRead,
+		PermissionAccountWrite,
+		PermissionUsersRead,
+		PermissionUsersWrite,
+		PermissionUsersDelete,
+		PermissionUsersSessionsRevoke,
+		PermissionOAuthClientsRead,
+		PermissionOAuthClientsWrite,
+	}
+
+	// SelfServicePermissions : Permissions of self-service routes (acting on the caller own account), granted to every role.
+	// They only restrict API keys & OAuth access tokens, which reach no route outside their scopes
+	SelfServicePermissions = []string{
+		PermissionAccountRead,
+		PermissionAccountWrite,
+	}
+
+	// DefaultRolePermissions : Permissions of each role, unless overridden in Config.Roles (json "roles")
+	DefaultRolePermissions = map[string][]string{
+		ADMIN_ROLE:   []string{PermissionAll},
+		DEFAULT_ROLE: []string{},
+	}
+)
+
+// RolePermissions : Permissions granted to role
+func (config Config) RolePermissions(role string) []string {
+
+	if permissions, ok := config.Roles[role]; ok {
+		return permissions
+	}
+
+	return DefaultRolePermissions[role]
+}
+
+// RoleExists : Check wether role is defined in config or by default
+func (config Config) RoleExists(role string) bool {
+
+	_, inConfig := config.Roles[role]
+	_, byDefault := DefaultRolePermissions[role]
+
+	return inConfig || byDefault
+}
+
+// HasPermission : Check wether role is granted permission
+func (config Config) HasPermission(role string, permission string) bool {
+
+	if utils.IsStringIn(permission, SelfServicePermissions) {
+		return true
+	}
+
+	permissions := config.RolePermissions(role)
+
+	return utils.IsStringIn(PermissionAll, permissions) || utils.IsStringIn(permission, permissions)
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	hmac "crypto/hmac"
+	sha256 "crypto/sha256"
+	hex "encoding/hex"
+	errors "errors"
+	sort "sort"
+	strings "strings"
+	time "time"
+	utils "vulnlabs-rest-api/utils"
+)
+
+const (
+	SessionStoreRedis  = "redis"
+	SessionStoreMemory = "memory"
+	SessionStoreJWT    = "jwt"
+)
+
+var (
+	ErrSessionExpired     = errors.New("Session expired")
+	ErrSessionNotFound    = errors.New("Session not found")
+	ErrRefreshTokenReused = errors.New("Refresh token reused, session revoked")
+)
+
+// SessionStore : Session storage, owning create/lookup/refresh/revoke semantics
+type SessionStore interface {
+	// CreateSession : Issue session credentials for user and store the session with its metadata.
+	// Least recently used sessions are revoked beyond SessionsConfig.MaxSessionsPerUser
+	CreateSession(userID string, ip string, userAgent string) (*SessionCredentials, error)
+
+	// RotateSession : Exchange the refresh token of a session (or its token if the store issues no refresh token)
+	// for new credentials, the exchanged token being invalidated
+	RotateSession(refreshToken string, ip string, userAgent string) (*SessionCredentials, error)
+
+	// ReadSessionUserID : Get the user owning the session token
+	ReadSessionUserID(token string) (string, error)
+
+	// SessionID : Get the ID of the session of token
+	SessionID(token string) (string, error)
+
+	// RefreshSession : Slide the session idle expiration, at most once per SessionsConfig.RefreshThrottle.
+	// Returns the remaining session lifetime, and wether it was refreshed
+	RefreshSession(userID string, token string) (time.Duration, bool, error)
+
+	// ListUserSessions : List active user sessions
+	ListUserSessions(userID string) ([]Session, error)
+
+	// DeleteUserSession : Revoke user session from its ID
+	DeleteUserSession(userID string, sessionID string) error
+
+	// DeleteUserSessions : Revoke all user sessions but the one identified by exceptSessionID (if not empty)
+	DeleteUserSessions(userID string, exceptSessionID string) error
+}
+
+// Session : Session metadata, as listed to its user
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	Current    bool      `json:"current"`
+}
+
+// SessionCredentials : Credentials issued to the client of a session
+type SessionCredentials struct {
+	// Token authenticating requests, as session cookie or bearer token
+	Token           string
+	TokenExpiration time.Duration
+
+	// Token to present to RotateSession, empty if Token itself is
+	RefreshToken           string
+	RefreshTokenExpiration time.Duration
+}
+
+// sessionRecord : Session as stored by the session stores. The raw token is never stored
+type sessionRecord struct {
+	Session
+	TokenDigest string `json:"tokenDigest"`
+}
+
+// NewSessionStore : Return the session store selected in config. Stores issuing signed tokens sign them with keyRing
+func NewSessionStore(redis RedisInterface, config *SessionsConfig, keyRing *KeyRing) (SessionStore, error) {
+
+	switch config.Store {
+	case "", SessionStoreRedis:
+		return NewRedisSessionStore(redis, config), nil
+	case SessionStoreMemory:
+		return NewMemorySessionStore(config), nil
+	case SessionStoreJWT:
+		return NewJWTSessionStore(redis, config, keyRing)
+	}
+
+	return nil, errors.New("unknown session store " + config.Store)
+}
+
+// SessionID : Public identifier of the session, derived from its token so it can be recomputed on each request
+func SessionID(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// rotateSession : Replace the session of token by a new one, for stores whose tokens are their own refresh token
+func rotateSession(store SessionStore, token string, ip string, userAgent string) (*SessionCredentials, error) {
+
+	userID, err := store.ReadSessionUserID(token)
+
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	err = store.DeleteUserSession(userID, SessionID(token))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store.CreateSession(userID, ip, userAgent)
+}
+
+// SessionExpiration : Remaining lifetime at now of a session created at createdAt, if it stays idle
+func SessionExpiration(config SessionsConfig, createdAt time.Time, now time.Time) time.Duration {
+
+	remaining := createdAt.Add(config.AbsoluteTimeout()).Sub(now)
+
+	if idle := config.IdleTimeout(); idle < remaining {
+		return idle
+	}
+
+	return remaining
+}
+
+// SessionTokenDigest : Digest under which the session token is stored.
+// HMAC-SHA256 keyed with SessionsConfig.TokenHashingSecret, or plain SHA-256 if no secret is configured
+func SessionTokenDigest(config SessionsConfig, token string) string {
+
+	if config.TokenHashingSecret == "" {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.TokenHashingSecret))
+	mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newSessionRecord : Generate a session token and its record
+func newSessionRecord(config SessionsConfig, userID string, ip string, userAgent string) (*sessionRecord, string, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionToken := strings.ToUpper(hex.EncodeToString(randomBytes))
+	now := time.Now().UTC()
+
+	return &sessionRecord{
+		Session: Session{
+			ID:         SessionID(sessionToken),
+			UserID:     userID,
+			CreatedAt:  now,
+			LastSeenAt: now,
+			IP:         ip,
+			UserAgent:  userAgent,
+		},
+		TokenDigest: SessionTokenDigest(config, sessionToken),
+	}, sessionToken, nil
+}
+
+// sessionsToEvict : Least recently used sessions to revoke so that a new one fits in maxSessions (0 means unlimited)
+func sessionsToEvict(sessions []Session, maxSessions int) []Session {
+
+	if maxSessions <= 0 || len(sessions) < maxSessions {
+		return nil
+	}
+
+	// Oldest activity first
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.Before(sessions[j].LastSeenAt)
+	})
+
+	return sessions[:len(sessions)-maxSessions+1]
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	tls "crypto/tls"
+	fmt "fmt"
+	net "net"
+	smtp "net/smtp"
+	time "time"
+)
+
+// SMTPMailer : Mailer sending through an SMTP relay
+type SMTPMailer struct {
+	From   string
+	Config SMTPConfig
+}
+
+// NewSMTPMailer : Return a new SMTP mailer
+func NewSMTPMailer(from string, config SMTPConfig) *SMTPMailer {
+
+	return &SMTPMailer{
+		From:   from,
+		Config: config,
+	}
+}
+
+// Send : Send message through a new SMTP connection
+func (mailer *SMTPMailer) Send(message *MailMessage) error {
+
+	data, err := buildMIMEMessage(mailer.From, message)
+
+	if err != nil {
+		return err
+	}
+
+	timeout := mailer.Config.Timeout()
+	address := net.JoinHostPort(mailer.Config.Host, fmt.Sprintf("%d", mailer.Config.Port))
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+
+	if err != nil {
+		return err
+	}
+
+	// Bound the whole SMTP dialog
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, mailer.Config.Host)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if mailer.Config.StartTLS {
+
+		err = client.StartTLS(&tls.Config{ServerName: mailer.Config.Host})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if mailer.Config.Username != "" {
+
+		err = client.Auth(smtp.PlainAuth("", mailer.Config.Username, mailer.Config.Password, mailer.Config.Host))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(mailer.From)
+
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range message.To {
+
+		err = client.Rcpt(recipient)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
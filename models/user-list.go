@@ -0,0 +1,148 @@
+package models
+
+import (
+	base64 "encoding/base64"
+	json "encoding/json"
+	errors "errors"
+	strings "strings"
+	time "time"
+)
+
+const (
+	UserListDefaultLimit = 20
+	UserListMaxLimit     = 100
+	UserListDefaultSort  = "createdAt"
+)
+
+var (
+	// UserListSortColumns : Sortable fields (API name -> column). Prefix with "-" for descending order
+	UserListSortColumns = map[string]string{
+		"createdAt": "created_at",
+		"email":     "email",
+		"firstName": "first_name",
+		"lastName":  "last_name",
+	}
+
+	ErrInvalidCursor = errors.New("Invalid cursor")
+)
+
+// UserListQuery : Filters, sort order & cursor of a user listing
+type UserListQuery struct {
+	// Substring filters
+	Email string
+	Name  string
+
+	// Exact filter
+	Role string
+
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// Sort field (see UserListSortColumns), "-" prefixed for descending order
+	Sort string
+
+	Limit  int
+	Cursor string
+}
+
+// UserListPage : Page of a user listing
+type UserListPage struct {
+	Users []User       `json:"users"`
+	Page  PageMetadata `json:"page"`
+}
+
+// PageMetadata : Cursor pagination metadata
+type PageMetadata struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// userListCursor : Position after the last user of a page : its sort value, and its ID to break ties
+type userListCursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// SortColumn : DB column & direction of the query sort order
+func (query *UserListQuery) SortColumn() (string, bool, error) {
+
+	sort := query.Sort
+
+	if sort == "" {
+		sort = UserListDefaultSort
+	}
+
+	descending := strings.HasPrefix(sort, "-")
+	column, ok := UserListSortColumns[strings.TrimPrefix(sort, "-")]
+
+	if !ok {
+		return "", false, errors.New("Invalid sort field")
+	}
+
+	return column, descending, nil
+}
+
+// PageLimit : Requested page size, defaults to UserListDefaultLimit and capped to UserListMaxLimit
+func (query *UserListQuery) PageLimit() int {
+
+	if query.Limit <= 0 {
+		return UserListDefaultLimit
+	}
+
+	if query.Limit > UserListMaxLimit {
+		return UserListMaxLimit
+	}
+
+	return query.Limit
+}
+
+// encodeUserListCursor : Cursor pointing after user for the given sort column
+func encodeUserListCursor(user *User, column string) string {
+
+	cursor := userListCursor{ID: user.ID}
+
+	switch column {
+	case "created_at":
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "email":
+		cursor.Value = user.Email
+	case "first_name":
+		cursor.Value = user.FirstName
+	case "last_name":
+		cursor.Value = user.LastName
+	}
+
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserListCursor : Decode cursor into the sort value to resume from (typed for column) and the tie-breaking ID
+func decodeUserListCursor(encoded string, column string) (interface{}, string, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var cursor userListCursor
+
+	if json.Unmarshal(data, &cursor) != nil || cursor.ID == "" {
+		return nil, "", ErrInvalidCursor
+	}
+
+	if column == "created_at" {
+
+		createdAt, err := time.Parse(time.RFC3339Nano, cursor.Value)
+
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+
+		return createdAt, cursor.ID, nil
+	}
+
+	return cursor.Value, cursor.ID, nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	sort "sort"
+	testing "testing"
+	time "time"
+)
+
+// usersAfterCursor : Users matching the keyset condition of ListUsers for an ascending created_at sort
+func usersAfterCursor(users []User, createdAt time.Time, id string) []User {
+
+	after := []User{}
+
+	for _, user := range users {
+
+		if user.CreatedAt.After(createdAt) || (user.CreatedAt.Equal(createdAt) && user.ID > id) {
+			after = append(after, user)
+		}
+	}
+
+	return after
+}
+
+func TestUserListCursorPagination(t *testing.T) {
+
+	tied := time.Date(2019, 5, 1, 12, 0, 0, 123456789, time.UTC)
+
+	users := []User{
+		{ID: "a", CreatedAt: time.Time{}},
+		{ID: "b", CreatedAt: time.Time{}},
+		{ID: "c", CreatedAt: tied},
+		{ID: "d", CreatedAt: tied},
+		{ID: "e", CreatedAt: tied},
+		{ID: "f", CreatedAt: tied.Add(time.Nanosecond)},
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt) || (users[i].CreatedAt.Equal(users[j].CreatedAt) && users[i].ID < users[j].ID)
+	})
+
+	for _, limit := range []int{1, 2, 4} {
+
+		seen := []string{}
+		remaining := users
+
+		for len(remaining) > 0 {
+
+			page := remaining
+
+			if len(page) > limit {
+				page = page[:limit]
+			}
+
+			for _, user := range page {
+				seen = append(seen, user.ID)
+			}
+
+			value, id, err := decodeUserListCursor(encodeUserListCursor(&page[len(page)-1], "created_at"), "created_at")
+
+			if err != nil {
+				t.Fatalf("limit %d : %v", limit, err)
+			}
+
+			remaining = usersAfterCursor(users, value.(time.Time), id)
+		}
+
+		if len(seen) != len(users) {
+			t.Errorf("limit %d : got users %v, want each of the %d users once", limit, seen, len(users))
+			continue
+		}
+
+		for i, user := range users {
+			if seen[i] != user.ID {
+				t.Errorf("limit %d : got users %v, want them in sort order", limit, seen)
+				break
+			}
+		}
+	}
+}
+
+func TestDecodeUserListCursor(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		cursor string
+		column string
+		valid  bool
+	}{
+		{"created at", encodeUserListCursor(&User{ID: "a", CreatedAt: time.Now()}, "created_at"), "created_at", true},
+		{"zero created at", encodeUserListCursor(&User{ID: "a"}, "created_at"), "created_at", true},
+		{"email", encodeUserListCursor(&User{ID: "a", Email: "a@vulnlabs.localhost"}, "email"), "email", true},
+		{"email cursor on created at", encodeUserListCursor(&User{ID: "a", Email: "a@vulnlabs.localhost"}, "email"), "created_at", false},
+		{"no ID", encodeUserListCursor(&User{Email: "a@vulnlabs.localhost"}, "email"), "email", false},
+		{"not base64", "!!!", "email", false},
+	}
+
+	for _, test := range tests {
+
+		if _, _, err := decodeUserListCursor(test.cursor, test.column); (err == nil) != test.valid {
+			t.Errorf("%s : got error %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	time "time"
 	utils "vulnlabs-rest-api/utils"
 
 	gormlib "github.com/jinzhu/gorm"
@@ -9,35 +10,52 @@ import (
 
 const (
 	DEFAULT_ROLE = "H4x0r"
+	ADMIN_ROLE   = "Admin"
 )
 
 // User : User Account Struct
 type User struct {
 	ID                string         `json:"id" gorm:"primary_key;unique;not null;"`
 	Email             string         `json:"email,omitempty" gorm:"unique;not null;"`
+	EmailVerified     bool           `json:"emailVerified" gorm:"not null;default:false;"`
+	PendingEmail      string         `json:"pendingEmail,omitempty"`
 	Password          string         `json:"-" gorm:"not null;"`
 	FirstName         string         `json:"firstName,omitempty" gorm:"not null;"`
 	LastName          string         `json:"lastName,omitempty" gorm:"not null;"`
 	PhoneNumber       string         `json:"phoneNumber,omitempty" gorm:"not null;"`
 	ProfilePictureURL string         `json:"profilePictureURL,omitempty"`
 	Role              ReadOnlyString `json:"role,omitempty" gorm:"not null;"`
+	MFAEnabled        bool           `json:"mfaEnabled" gorm:"not null;default:false;"`
+	MFASecret         string         `json:"-"`
+	Disabled          bool           `json:"disabled" gorm:"not null;default:false;"`
+	CreatedAt         time.Time      `json:"createdAt" gorm:"not null;default:CURRENT_TIMESTAMP;"`
 }
 
 type UserCreateRequestBody struct {
-	Email             string `json:"email,omitempty"`
-	Password          string `json:"password,omitempty"`
-	FirstName         string `json:"firstName,omitempty"`
-	LastName          string `json:"lastName,omitempty"`
-	PhoneNumber       string `json:"phoneNumber,omitempty"`
-	ProfilePictureURL string `json:"profilePictureURL,omitempty"`
+	Email             string `json:"email,omitempty" validate:"required,email,max=254"`
+	Password          string `json:"password,omitempty" validate:"required,max=128"`
+	FirstName         string `json:"firstName,omitempty" validate:"required,max=64"`
+	LastName          string `json:"lastName,omitempty" validate:"required,max=64"`
+	PhoneNumber       string `json:"phoneNumber,omitempty" validate:"e164"`
+	ProfilePictureURL string `json:"profilePictureURL,omitempty" validate:"url,max=2048"`
 }
 
 type UserUpdateRequestBody struct {
-	Email             string `json:"email,omitempty"`
-	FirstName         string `json:"firstName,omitempty"`
-	LastName          string `json:"lastName,omitempty"`
-	PhoneNumber       string `json:"phoneNumber,omitempty"`
-	ProfilePictureURL string `json:"profilePictureURL,omitempty"`
+	Email             string `json:"email,omitempty" validate:"email,max=254"`
+	FirstName         string `json:"firstName,omitempty" validate:"max=64"`
+	LastName          string `json:"lastName,omitempty" validate:"max=64"`
+	PhoneNumber       string `json:"phoneNumber,omitempty" validate:"e164"`
+	ProfilePictureURL string `json:"profilePictureURL,omitempty" validate:"url,max=2048"`
+}
+
+// AdminUserUpdateRequestBody : User update by an admin, role included
+type AdminUserUpdateRequestBody struct {
+	Email             string `json:"email,omitempty" validate:"email,max=254"`
+	FirstName         string `json:"firstName,omitempty" validate:"max=64"`
+	LastName          string `json:"lastName,omitempty" validate:"max=64"`
+	PhoneNumber       string `json:"phoneNumber,omitempty" validate:"e164"`
+	ProfilePictureURL string `json:"profilePictureURL,omitempty" validate:"url,max=2048"`
+	Role              string `json:"role,omitempty" validate:"max=64"`
 }
 
 //BeforeCreate : Run before DB Insertion
@@ -46,12 +64,14 @@ func (user *User) BeforeCreate(scope *gormlib.Scope) error {
 	// Set UserID
 	user.ID = uuid.NewV4().String()
 
-	// If user is in admin list, get role admin
-	if utils.IsStringIn(user.Email, GlobalConfig.AdminUsers) {
-		user.Role = "Admin"
-	} else {
-		user.Role = DEFAULT_ROLE
-	}
+	// Admin role is only granted once the email is verified, see GrantsAdminRole
+	user.Role = DEFAULT_ROLE
 
 	return nil
 }
+
+// GrantsAdminRole : Wether user verified email is in the admin list while user does not have admin role yet
+func (user *User) GrantsAdminRole() bool {
+
+	return user.EmailVerified && string(user.Role) == DEFAULT_ROLE && utils.IsStringIn(user.Email, GlobalConfig.AdminUsers)
+}
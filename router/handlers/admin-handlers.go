@@ -0,0 +1,415 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	mux "github.com/gorilla/mux"
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+// AdminListUsers : List users page by page. Supports email, name, role, createdAfter & createdBefore filters,
+// sort order (e.g. sort=-createdAt), limit and cursor query parameters
+func AdminListUsers(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	query, err := parseUserListQuery(r)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	users, nextCursor, err := env.GORM.ListUsers(query)
+
+	if err != nil {
+
+		if err == models.ErrInvalidCursor {
+			validationErrors := validation.Errors{}
+			validationErrors.Add("cursor", "cursor", "must be a cursor returned by a previous page")
+			return customhttpresponse.CodeValidationFailed, validationErrors
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	sort := query.Sort
+
+	if sort == "" {
+		sort = models.UserListDefaultSort
+	}
+
+	// Pagination links, as per RFC 8288
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(r, ""))}
+
+	if nextCursor != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, nextCursor)))
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(
+		models.UserListPage{
+			Users: users,
+			Page: models.PageMetadata{
+				Limit:      query.PageLimit(),
+				Sort:       sort,
+				NextCursor: nextCursor,
+			},
+		}, responseDetails, w,
+	)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminReadUser : Read any user informations from DB
+func AdminReadUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(user, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminUpdateUser : Update any user, role included
+func AdminUpdateUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Parse Request Body
+	var adminUserUpdateRequest models.AdminUserUpdateRequestBody
+	err = json.NewDecoder(r.Body).Decode(&adminUserUpdateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&adminUserUpdateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	if adminUserUpdateRequest.Role != "" && string(user.Role) != adminUserUpdateRequest.Role {
+
+		if !env.Config.RoleExists(adminUserUpdateRequest.Role) {
+			validationErrors := validation.Errors{}
+			validationErrors.Add("role", "role", "must be a configured role")
+			return customhttpresponse.CodeValidationFailed, validationErrors
+		}
+
+		// Admins cannot lock themselves out
+		if isCaller(r, user) {
+			return models.CodeForbidden, errors.New("Cannot change own role")
+		}
+
+		// Callers can neither grant nor take away more than they hold
+		for _, role := range []string{string(user.Role), adminUserUpdateRequest.Role} {
+
+			statusCode, err := callerHoldsRole(env, r, role)
+
+			if err != nil {
+				return statusCode, err
+			}
+		}
+	}
+
+	userUpdateRequest := models.UserUpdateRequestBody{
+		Email:             adminUserUpdateRequest.Email,
+		FirstName:         adminUserUpdateRequest.FirstName,
+		LastName:          adminUserUpdateRequest.LastName,
+		PhoneNumber:       adminUserUpdateRequest.PhoneNumber,
+		ProfilePictureURL: adminUserUpdateRequest.ProfilePictureURL,
+	}
+
+	// New email only replaces the current one once verified by its owner
+	pendingEmail, statusCode, err := stageEmailChange(env, user, &userUpdateRequest)
+
+	if err != nil {
+		return statusCode, err
+	}
+
+	// Update user infos in DB
+	err = env.GORM.UpdateUserInfos(user, &userUpdateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if pendingEmail != "" {
+		sendEmailVerificationEmailInBackground(env, user, pendingEmail)
+	}
+
+	// Role is read-only for self-service updates, hence its own update
+	if adminUserUpdateRequest.Role != "" {
+
+		err = env.GORM.UpdateUserRole(user, adminUserUpdateRequest.Role)
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(user, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminDisableUser : Prevent user from logging in and revoke its sessions
+func AdminDisableUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	return updateUserDisabled(env, w, r, true, utils.GetCurrentFuncName())
+}
+
+// AdminEnableUser : Allow a disabled user to log in again
+func AdminEnableUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	return updateUserDisabled(env, w, r, false, utils.GetCurrentFuncName())
+}
+
+// AdminDeleteUser : Delete any user from DB
+func AdminDeleteUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Own account is deleted through DELETE /v1/user
+	if isCaller(r, user) {
+		return models.CodeForbidden, errors.New("Cannot delete own account")
+	}
+
+	err = deleteUserAccount(env, user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminDeleteUserSessions : Revoke all sessions of any user
+func AdminDeleteUserSessions(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	err = env.Sessions.DeleteUserSessions(user.ID, "")
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminUnlockUser : Lift the failed logins lockout of any user
+func AdminUnlockUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	err = resetLoginFailures(env, user.Email)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// updateUserDisabled : Disable or enable the user identified in route, action names the calling handler in response details
+func updateUserDisabled(env *models.Env, w http.ResponseWriter, r *http.Request, disabled bool, action string) (string, error) {
+
+	user, err := env.GORM.ReadUserFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Admins cannot lock themselves out
+	if isCaller(r, user) {
+		return models.CodeForbidden, errors.New("Cannot disable own account")
+	}
+
+	err = env.GORM.UpdateUserDisabled(user, disabled)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if disabled {
+
+		err = env.Sessions.DeleteUserSessions(user.ID, "")
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, action, customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(user, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// parseUserListQuery : Parse user listing query parameters. Invalid fields are returned as validation.Errors
+func parseUserListQuery(r *http.Request) (*models.UserListQuery, error) {
+
+	params := r.URL.Query()
+	validationErrors := validation.Errors{}
+
+	query := &models.UserListQuery{
+		Email:  params.Get("email"),
+		Name:   params.Get("name"),
+		Role:   params.Get("role"),
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+
+	if _, _, err := query.SortColumn(); err != nil {
+		validationErrors.Add("sort", "sort", "must be one of the sortable fields, optionally prefixed with \"-\"")
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+
+		if err != nil || query.Limit <= 0 {
+			validationErrors.Add("limit", "min", "must be a positive integer")
+		}
+	}
+
+	dateFilters := []struct {
+		Field  string
+		Target **time.Time
+	}{
+		{"createdAfter", &query.CreatedAfter},
+		{"createdBefore", &query.CreatedBefore},
+	}
+
+	for _, filter := range dateFilters {
+
+		if value := params.Get(filter.Field); value != "" {
+
+			date, err := time.Parse(time.RFC3339, value)
+
+			if err != nil {
+				validationErrors.Add(filter.Field, "date", "must be an RFC 3339 date")
+				continue
+			}
+
+			*filter.Target = &date
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	return query, nil
+}
+
+// pageURL : Request URL pointing to the page starting at cursor (first page if empty)
+func pageURL(r *http.Request, cursor string) string {
+
+	params := r.URL.Query()
+	params.Del("cursor")
+
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	u := url.URL{Path: r.URL.Path, RawQuery: params.Encode()}
+
+	return u.String()
+}
+
+// isCaller : Check wether user is the one performing the request
+func isCaller(r *http.Request, user *models.User) bool {
+
+	return r.Context().Value(middlewares.ContextUserKey).(string) == user.ID
+}
+
+// callerHoldsRole : Check the caller is granted every permission of role, by its own role & by the scopes of its credentials
+func callerHoldsRole(env *models.Env, r *http.Request, role string) (string, error) {
+
+	caller, err := env.GORM.ReadUserFromID(r.Context().Value(middlewares.ContextUserKey).(string))
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	scopes, scoped := r.Context().Value(middlewares.ContextAPIKeyScopesKey).(models.APIKeyScopes)
+
+	for _, permission := range env.Config.RolePermissions(role) {
+
+		if !env.Config.HasPermission(string(caller.Role), permission) || (scoped && !scopes.Allow(permission)) {
+			return models.CodeForbidden, fmt.Errorf("Permission %s of role %s required", permission, role)
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	mux "github.com/gorilla/mux"
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+// CreateAPIKey : Create an API key for user. The key is only returned in this response
+func CreateAPIKey(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Delegated credentials cannot mint credentials outliving them, whatever the requested scopes
+	if middlewares.IsDelegated(r) {
+		return models.CodeForbidden, errors.New("API keys can only be created from a session of the user")
+	}
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Parse Request Body
+	var apiKeyCreateRequest models.APIKeyCreateRequest
+	err = json.NewDecoder(r.Body).Decode(&apiKeyCreateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&apiKeyCreateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	validationErrors := validation.Errors{}
+
+	// Keys cannot be granted more than the user role
+	for _, scope := range apiKeyCreateRequest.Scopes {
+
+		known := scope == models.PermissionAll || utils.IsStringIn(scope, models.Permissions)
+
+		if !known || !env.Config.HasPermission(string(user.Role), scope) {
+			validationErrors.Add("scopes", "scope", "must be permissions granted to you, "+scope+" is not")
+			break
+		}
+	}
+
+	if apiKeyCreateRequest.ExpiresAt != nil && !apiKeyCreateRequest.ExpiresAt.After(time.Now()) {
+		validationErrors.Add("expiresAt", "future", "must be in the future")
+	}
+
+	if len(validationErrors) > 0 {
+		return customhttpresponse.CodeValidationFailed, validationErrors
+	}
+
+	apiKeys, err := env.GORM.ListUserAPIKeys(user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if len(apiKeys) >= env.Config.APIKeys.MaxPerUser() {
+		return models.CodeForbidden, errors.New("Too many API keys, revoke unused ones first")
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	apiKey := &models.APIKey{
+		UserID:    user.ID,
+		Name:      apiKeyCreateRequest.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.TokenDigest(key),
+		Scopes:    models.APIKeyScopes(apiKeyCreateRequest.Scopes),
+		ExpiresAt: apiKeyCreateRequest.ExpiresAt,
+	}
+
+	err = env.GORM.CreateAPIKey(apiKey)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(&models.CreatedAPIKey{APIKey: *apiKey, Key: key}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ReadAPIKeys : List user API keys, without the keys themselves
+func ReadAPIKeys(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	apiKeys, err := env.GORM.ListUserAPIKeys(user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(apiKeys, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// DeleteAPIKey : Revoke one of user API keys
+func DeleteAPIKey(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	deleted, err := env.GORM.DeleteUserAPIKey(user, mux.Vars(r)["id"])
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !deleted {
+		return customhttpresponse.CodeDoesNotExist, errors.New("API key does not exist")
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"vulnlabs-rest-api/auth"
 	"vulnlabs-rest-api/models"
 	middlewares "vulnlabs-rest-api/router/middlewares"
@@ -13,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	mux "github.com/gorilla/mux"
 	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
 )
 
@@ -27,6 +30,13 @@ func CreateSession(env *models.Env, w http.ResponseWriter, r *http.Request) (str
 		return customhttpresponse.CodeInvalidJSON, err
 	}
 
+	// Brute-force protection, attempt is counted before the password is checked not to tell wether it is right
+	attempt, lockout := registerLoginAttempt(env, r, credentials.Email)
+
+	if lockout > 0 {
+		return lockedOut(w, lockout)
+	}
+
 	// Check match in DB
 	user, err := env.GORM.ReadUserFromEmail(credentials.Email)
 
@@ -42,93 +52,69 @@ func CreateSession(env *models.Env, w http.ResponseWriter, r *http.Request) (str
 	// user.Password represents the hashed pasword from DB
 	if auth.CheckPasswordHash(credentials.Password, user.Password) {
 
-		userStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisUserStoragePrefix, user.ID, models.RedisUserStorageSessionSuffix)
-		existingSession, err := env.Redis.Get(userStorageKey)
-		existingSessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, existingSession, models.RedisSessionStorageUserIDSuffix)
+		// Right password is not a failed login
+		forgetLoginAttempt(env, attempt)
 
-		if err != nil && !utils.CaseInsensitiveContains(err.Error(), "error getting key user") {
+		// Transparently upgrade the stored hash if its algorithm or parameters are outdated
+		if auth.NeedsRehash(user.Password) {
 
-			return customhttpresponse.CodeInternalError, err
-		}
+			newHashedPassword, err := auth.HashPassword(credentials.Password)
 
-		// If a session already exists for this user, revoke it
-		if string(existingSession) != "" {
-			env.Redis.Delete(existingSessionStorageKey)
-		}
+			if err == nil {
+				err = env.GORM.UpdateUserPassword(user, newHashedPassword)
+			}
 
-		// Generate Session Token
-		randomBytes, err := utils.GenerateCryptoRandomBytes(16)
-
-		if err != nil {
-			return customhttpresponse.CodeInternalError, err
+			// Login must not fail because of the upgrade, old hash is still valid
+			if err != nil {
+				log.Printf("Could not rehash password of user %s : %v", user.ID, err)
+			}
 		}
 
-		sessionToken := strings.ToUpper(hex.EncodeToString(randomBytes))
-		sessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, sessionToken, models.RedisSessionStorageUserIDSuffix)
-
-		// Init Redis transaction to add datas to User and Session storage
-		transactionCommands := []models.RedisCommand{
-			models.RedisCommand{
-				Command: "SETEX",
-				Args:    []interface{}{sessionStorageKey, models.TokenExpirationInMinutes * 60, []byte(user.ID)},
-			},
-			models.RedisCommand{
-				Command: "SET",
-				Args:    []interface{}{userStorageKey, []byte(sessionToken)},
-			},
+		// Checked once the password is verified, not to disclose account status
+		if user.Disabled {
+			return models.CodeForbidden, errors.New("Account disabled")
 		}
 
-		_, err = env.Redis.Multi(transactionCommands)
+		// Password is only the first factor : session is created by CreateMFASession
+		if user.MFAEnabled {
 
-		if err != nil {
-			return customhttpresponse.CodeInternalError, err
-		}
-
-		// Cookie expiration fixed to 30 minutes
-		maxCookieAge := (time.Duration(models.TokenExpirationInMinutes) * time.Minute) / time.Second
+			mfaToken, err := createMFAChallenge(env, user.ID)
 
-		tokenCookie := http.Cookie{
+			if err != nil {
+				return customhttpresponse.CodeInternalError, err
+			}
 
-			// __Host cookie prefix signals to the browser that both the Path=/
-			// and Secure attributes are required, and at the same time
-			// + that the Domain attribute must not be present.
-			// see https://resources.infosecinstitute.com/cookies-httponly-flag-problem-browsers
-			// TO DO : Change this to __Host-session
-			Name: "session",
+			responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
 
-			// Path set to root
-			Path: "/",
+			customhttpresponse.WriteResponse(
+				struct {
+					MFARequired bool   `json:"mfaRequired"`
+					MFAToken    string `json:"mfaToken"`
+				}{
+					true,
+					mfaToken,
+				}, responseDetails, w,
+			)
 
-			// TODO : Uncomment this
-			// Only transmit on encrypted connection
-			// Secure: true,
+			return customhttpresponse.CodeSuccess, nil
+		}
 
-			// Cannot be accessed by JavaScript
-			HttpOnly: true,
+		credentials, err := storeSession(env, w, r, user.ID)
 
-			// Prevents cookie from being attached to cross-origin requests
-			SameSite: http.SameSiteStrictMode,
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
 
-			// Actual value of cookie
-			Value: sessionToken,
+		err = resetLoginFailures(env, user.Email)
 
-			// Set Expiration cookie client side (IE Browser will treat this cookie as a session cookie [Expires when closing tab])
-			MaxAge: int(maxCookieAge),
+		if err != nil {
+			log.Printf("Could not reset failed logins of user %s : %v", user.ID, err)
 		}
 
-		// Set cookie to response
-		http.SetCookie(w, &tokenCookie)
-
 		// Return response
 		responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
 
-		customhttpresponse.WriteResponse(
-			struct {
-				Session string `json:"session"`
-			}{
-				sessionToken,
-			}, responseDetails, w,
-		)
+		customhttpresponse.WriteResponse(newSessionResponse(credentials), responseDetails, w)
 
 		return customhttpresponse.CodeSuccess, nil
 	}
@@ -136,101 +122,139 @@ func CreateSession(env *models.Env, w http.ResponseWriter, r *http.Request) (str
 	return customhttpresponse.CodeBadLogin, errors.New("Invalid credentials")
 }
 
-// UpdateSession : Refresh session
-func UpdateSession(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+// CreateMFASession : Complete a pending login with the second factor and generate session
+func CreateMFASession(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
 
-	userID := r.Context().Value(middlewares.ContextUserKey).(string)
-
-	// Get token from cookies
-	c, err := r.Cookie("session")
+	// Parse Request Body
+	var mfaSessionRequest models.MFASessionRequest
+	err := json.NewDecoder(r.Body).Decode(&mfaSessionRequest)
 
-	if err != nil && c.Value != "" {
-		return "", err
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
 	}
 
-	existingSessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, c.Value, models.RedisSessionStorageUserIDSuffix)
-	userStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisUserStoragePrefix, userID, models.RedisUserStorageSessionSuffix)
+	challengeStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisMFAStoragePrefix, mfaSessionRequest.MFAToken, models.RedisMFAStorageUserIDSuffix)
+	attemptsStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisMFAStoragePrefix, mfaSessionRequest.MFAToken, models.RedisMFAStorageAttemptsSuffix)
 
-	// Delete key pair from session storage
-	err = env.Redis.Delete(existingSessionStorageKey)
+	// Get user associated to the pending login
+	userID, err := env.Redis.Get(challengeStorageKey)
+
+	if err != nil || mfaSessionRequest.MFAToken == "" {
+		return customhttpresponse.CodeInvalidToken, errors.New("Invalid or expired MFA token")
+	}
+
+	user, err := env.GORM.ReadUserFromID(string(userID))
 
 	if err != nil {
-		return customhttpresponse.CodeInternalError, errors.New("Could not delete session in Redis")
+
+		if env.GORM.IsRecordNotFoundError(err) {
+			return customhttpresponse.CodeBadLogin, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
 	}
 
-	// Generate new session token
-	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+	// Account may have been disabled since the challenge was issued
+	if user.Disabled {
+		return models.CodeForbidden, errors.New("Account disabled")
+	}
+
+	// Wrong codes count as failed logins, so that issuing new challenges does not allow unlimited guesses
+	attempt, lockout := registerLoginAttempt(env, r, user.Email)
+
+	if lockout > 0 {
+		return lockedOut(w, lockout)
+	}
+
+	valid, err := verifySecondFactor(env, user, mfaSessionRequest.Code, mfaSessionRequest.RecoveryCode)
 
 	if err != nil {
 		return customhttpresponse.CodeInternalError, err
 	}
 
-	sessionToken := strings.ToUpper(hex.EncodeToString(randomBytes))
-	sessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, sessionToken, models.RedisSessionStorageUserIDSuffix)
+	if !valid {
 
-	// Init Redis transaction to add datas to User and Session storage
-	transactionCommands := []models.RedisCommand{
-		models.RedisCommand{
-			Command: "SETEX",
-			Args:    []interface{}{sessionStorageKey, models.TokenExpirationInMinutes * 60, []byte(userID)},
-		},
-		models.RedisCommand{
-			Command: "SET",
-			Args:    []interface{}{userStorageKey, []byte(sessionToken)},
-		},
+		// Revoke challenge once too many wrong codes were submitted
+		attempts, err := env.Redis.Incr(attemptsStorageKey)
+
+		if err != nil || attempts >= env.Config.MFA.MaxAttempts() {
+			env.Redis.Delete(challengeStorageKey)
+			env.Redis.Delete(attemptsStorageKey)
+		}
+
+		return customhttpresponse.CodeBadLogin, errors.New("Invalid MFA code")
 	}
 
-	_, err = env.Redis.Multi(transactionCommands)
+	forgetLoginAttempt(env, attempt)
+
+	// Challenge is single use
+	env.Redis.Delete(challengeStorageKey)
+	env.Redis.Delete(attemptsStorageKey)
+
+	credentials, err := storeSession(env, w, r, user.ID)
 
 	if err != nil {
 		return customhttpresponse.CodeInternalError, err
 	}
 
-	// Cookie expiration fixed to 30 minutes
-	maxCookieAge := (time.Duration(models.TokenExpirationInMinutes) * time.Minute) / time.Second
+	err = resetLoginFailures(env, user.Email)
 
-	tokenCookie := http.Cookie{
+	if err != nil {
+		log.Printf("Could not reset failed logins of user %s : %v", user.ID, err)
+	}
 
-		// __Host cookie prefix signals to the browser that both the Path=/
-		// and Secure attributes are required, and at the same time
-		// + that the Domain attribute must not be present.
-		// see https://resources.infosecinstitute.com/cookies-httponly-flag-problem-browsers
-		// TO DO : Change this to __Host-session
-		Name: "session",
+	// Return response
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
 
-		// Path set to root
-		Path: "/",
+	customhttpresponse.WriteResponse(newSessionResponse(credentials), responseDetails, w)
 
-		// TODO : Uncomment this
-		// Only transmit on encrypted connection
-		// Secure: true,
+	return customhttpresponse.CodeSuccess, nil
+}
 
-		// Cannot be accessed by JavaScript
-		HttpOnly: true,
+// UpdateSession : Refresh session, exchanging its refresh token for new credentials.
+// The refresh token is read from the body, or else from the refresh cookie, or else is the session token itself
+// for session stores issuing no refresh token
+func UpdateSession(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
 
-		// Prevents cookie from being attached to cross-origin requests
-		SameSite: http.SameSiteStrictMode,
+	var refreshRequest models.SessionRefreshRequest
 
-		// Actual value of cookie
-		Value: sessionToken,
+	err := json.NewDecoder(r.Body).Decode(&refreshRequest)
 
-		// Set Expiration cookie client side (IE Browser will treat this cookie as a session cookie [Expires when closing tab])
-		MaxAge: int(maxCookieAge),
+	if err != nil && err != io.EOF {
+		return customhttpresponse.CodeInvalidJSON, err
 	}
 
-	// Set cookie to response
-	http.SetCookie(w, &tokenCookie)
+	refreshToken := refreshRequest.RefreshToken
+
+	if refreshToken == "" {
+
+		if c, err := r.Cookie(middlewares.RefreshCookieName); err == nil {
+			refreshToken = c.Value
+		} else if token, err := middlewares.SessionToken(r); err == nil {
+			refreshToken = token
+		}
+	}
+
+	if refreshToken == "" {
+		return customhttpresponse.CodeInvalidToken, errors.New("Missing refresh token")
+	}
+
+	// Exchanged token is invalidated, it is replaced by the new credentials
+	credentials, err := env.Sessions.RotateSession(refreshToken, utils.GetRequestIP(r), r.UserAgent())
+
+	if err == models.ErrRefreshTokenReused {
+		log.Printf("Refresh token reused from %s, session revoked", utils.GetRequestIP(r))
+	}
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidToken, err
+	}
+
+	middlewares.SetSessionCookies(w, credentials)
 
 	// Return response
 	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
-
-	customhttpresponse.WriteResponse(
-		struct {
-			Session string `json:"session"`
-		}{
-			sessionToken,
-		}, responseDetails, w,
-	)
+	customhttpresponse.WriteResponse(newSessionResponse(credentials), responseDetails, w)
 
 	return customhttpresponse.CodeSuccess, nil
 }
@@ -240,29 +264,157 @@ func DeleteSession(env *models.Env, w http.ResponseWriter, r *http.Request) (str
 
 	userID := r.Context().Value(middlewares.ContextUserKey).(string)
 
-	// Get token from cookies
-	c, err := r.Cookie("session")
+	sessionID, err := currentSessionID(env, r)
 
-	if err != nil && c.Value != "" {
-		return "", err
+	if err != nil {
+		return customhttpresponse.CodeInvalidToken, err
 	}
 
-	existingSessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, c.Value, models.RedisSessionStorageUserIDSuffix)
-	userStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisUserStoragePrefix, userID, models.RedisUserStorageSessionSuffix)
-
-	// Delete key pair from session storage
-	err = env.Redis.Delete(existingSessionStorageKey)
+	// Delete session from storage
+	err = env.Sessions.DeleteUserSession(userID, sessionID)
 
 	if err != nil {
 		return customhttpresponse.CodeInternalError, errors.New("Could not delete session in Redis")
 	}
 
-	// Set session as nil in user storage
-	err = env.Redis.Set(userStorageKey, nil)
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ReadSessions : List user active sessions (devices)
+func ReadSessions(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+
+	sessions, err := env.Sessions.ListUserSessions(userID)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Flag the session used for this request
+	if sessionID, err := currentSessionID(env, r); err == nil {
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == sessionID
+		}
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(sessions, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// DeleteSessions : Log user out everywhere. Current session is kept if keepCurrent=true is passed in query
+func DeleteSessions(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+
+	keptSessionID := ""
+
+	if r.URL.Query().Get("keepCurrent") == "true" {
+		keptSessionID, _ = currentSessionID(env, r)
+	}
+
+	err := env.Sessions.DeleteUserSessions(userID, keptSessionID)
 
 	if err != nil {
 		return customhttpresponse.CodeInternalError, err
 	}
 
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// DeleteSessionFromID : Revoke one of the user sessions (device)
+func DeleteSessionFromID(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	sessionID := mux.Vars(r)["id"]
+
+	// Lookup is scoped to the user session set : other users sessions cannot be revoked
+	err := env.Sessions.DeleteUserSession(userID, sessionID)
+
+	if err != nil {
+		return customhttpresponse.CodeDoesNotExist, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
 	return customhttpresponse.CodeSuccess, nil
 }
+
+// storeSession : Create a session for user and set its cookies
+func storeSession(env *models.Env, w http.ResponseWriter, r *http.Request, userID string) (*models.SessionCredentials, error) {
+
+	credentials, err := env.Sessions.CreateSession(userID, utils.GetRequestIP(r), r.UserAgent())
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Cookies expire with the credentials, AuthMiddleware slides the session one on activity
+	middlewares.SetSessionCookies(w, credentials)
+
+	return credentials, nil
+}
+
+// newSessionResponse : Response body of session credentials
+func newSessionResponse(credentials *models.SessionCredentials) *models.SessionResponse {
+
+	return &models.SessionResponse{
+		Session:      credentials.Token,
+		CSRFToken:    auth.CSRFToken(credentials.Token),
+		RefreshToken: credentials.RefreshToken,
+		ExpiresIn:    int(credentials.TokenExpiration / time.Second),
+	}
+}
+
+// currentSessionID : ID of the session authenticating the request
+func currentSessionID(env *models.Env, r *http.Request) (string, error) {
+
+	token, err := middlewares.SessionToken(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	return env.Sessions.SessionID(token)
+}
+
+// createMFAChallenge : Store a short-lived "mfa pending" challenge for user and return its token
+func createMFAChallenge(env *models.Env, userID string) (string, error) {
+
+	randomBytes, err := utils.GenerateCryptoRandomBytes(16)
+
+	if err != nil {
+		return "", err
+	}
+
+	mfaToken := strings.ToUpper(hex.EncodeToString(randomBytes))
+	challengeStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisMFAStoragePrefix, mfaToken, models.RedisMFAStorageUserIDSuffix)
+	attemptsStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisMFAStoragePrefix, mfaToken, models.RedisMFAStorageAttemptsSuffix)
+
+	// Attempts counter shares the challenge expiration (INCR keeps the TTL)
+	transactionCommands := []models.RedisCommand{
+		models.RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{challengeStorageKey, env.Config.MFA.ChallengeExpiration(), []byte(userID)},
+		},
+		models.RedisCommand{
+			Command: "SETEX",
+			Args:    []interface{}{attemptsStorageKey, env.Config.MFA.ChallengeExpiration(), 0},
+		},
+	}
+
+	_, err = env.Redis.Multi(transactionCommands)
+
+	if err != nil {
+		return "", err
+	}
+
+	return mfaToken, nil
+}
@@ -0,0 +1,236 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+// CreateEmailVerification : Resend the verification email of user pending (or else unverified) email
+func CreateEmailVerification(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	email := user.PendingEmail
+
+	if email == "" {
+
+		if user.EmailVerified {
+			validationErrors := validation.Errors{}
+			validationErrors.Add("email", "unverified", "is already verified")
+			return customhttpresponse.CodeValidationFailed, validationErrors
+		}
+
+		email = user.Email
+	}
+
+	err = sendEmailVerificationEmail(env, user, email)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ConfirmEmailVerification : Mark email of a verification token as verified, swapping it in if it was pending
+func ConfirmEmailVerification(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Parse Request Body
+	var emailVerificationConfirmRequest models.EmailVerificationConfirmRequest
+	err := json.NewDecoder(r.Body).Decode(&emailVerificationConfirmRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&emailVerificationConfirmRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	verificationStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisEmailVerificationPrefix, auth.TokenDigest(emailVerificationConfirmRequest.Token), models.RedisEmailVerificationSuffix)
+
+	stored, err := env.Redis.Get(verificationStorageKey)
+
+	if err != nil || emailVerificationConfirmRequest.Token == "" {
+		return customhttpresponse.CodeInvalidToken, errors.New("Invalid or expired email verification token")
+	}
+
+	var verification models.EmailVerification
+	err = json.Unmarshal(stored, &verification)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	user, err := env.GORM.ReadUserFromID(verification.UserID)
+
+	if err != nil {
+
+		if env.GORM.IsRecordNotFoundError(err) {
+			return customhttpresponse.CodeInvalidToken, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Token must still match the current unverified email or the pending one, not a superseded address
+	alreadyVerified := verification.Email == user.Email && user.EmailVerified
+	stillRequested := (verification.Email == user.Email && !user.EmailVerified) || verification.Email == user.PendingEmail
+
+	if alreadyVerified || !stillRequested {
+		env.Redis.Delete(verificationStorageKey)
+		return customhttpresponse.CodeInvalidToken, errors.New("Email verification token no longer applies")
+	}
+
+	// Token is single use
+	err = env.Redis.Delete(verificationStorageKey)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	err = env.GORM.UpdateUserEmail(user, verification.Email)
+
+	if err != nil {
+
+		// Address was taken by another account in the meantime
+		if match := utils.CaseInsensitiveContains(err.Error(), "duplicate entry"); match {
+			return customhttpresponse.CodeAlreadyExists, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	user.Email, user.EmailVerified, user.PendingEmail = verification.Email, true, ""
+
+	if user.GrantsAdminRole() {
+
+		err = env.GORM.UpdateUserRole(user, models.ADMIN_ROLE)
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+
+		user.Role = models.ADMIN_ROLE
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(user, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// stageEmailChange : Move a requested email change to user pending email, so that the current email stays in use until the new one is verified.
+// Returns the email to verify, if any
+func stageEmailChange(env *models.Env, user *models.User, userUpdateRequest *models.UserUpdateRequestBody) (string, string, error) {
+
+	email := userUpdateRequest.Email
+	userUpdateRequest.Email = ""
+
+	if email == "" || email == user.PendingEmail {
+		return "", customhttpresponse.CodeSuccess, nil
+	}
+
+	// Back to the current email : cancel pending change
+	if email == user.Email {
+		user.PendingEmail = ""
+		return "", customhttpresponse.CodeSuccess, nil
+	}
+
+	_, err := env.GORM.ReadUserFromEmail(email)
+
+	if err == nil {
+		return "", customhttpresponse.CodeAlreadyExists, errors.New("Email already used")
+	}
+
+	if !env.GORM.IsRecordNotFoundError(err) {
+		return "", customhttpresponse.CodeInternalError, err
+	}
+
+	user.PendingEmail = email
+
+	return email, customhttpresponse.CodeSuccess, nil
+}
+
+// sendEmailVerificationEmailInBackground : Send verification email without delaying the response, logging failures
+func sendEmailVerificationEmailInBackground(env *models.Env, user *models.User, email string) {
+
+	go func() {
+
+		err := sendEmailVerificationEmail(env, user, email)
+
+		if err != nil {
+			log.Printf("Could not send email verification email to user %s : %v", user.ID, err)
+		}
+	}()
+}
+
+// sendEmailVerificationEmail : Store a single-use verification token for email and send the verification link to it
+func sendEmailVerificationEmail(env *models.Env, user *models.User, email string) error {
+
+	token, err := auth.GenerateToken()
+
+	if err != nil {
+		return err
+	}
+
+	verification, err := json.Marshal(&models.EmailVerification{
+		UserID: user.ID,
+		Email:  email,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	expiration := env.Config.EmailVerification.TokenExpiration()
+	verificationStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisEmailVerificationPrefix, auth.TokenDigest(token), models.RedisEmailVerificationSuffix)
+
+	err = env.Redis.SetWithExpiration(verificationStorageKey, verification, int(expiration.Seconds()))
+
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenURL(env.Config.EmailVerification.URL, token)
+
+	if err != nil {
+		return err
+	}
+
+	return env.Mailer.Send(&models.MailMessage{
+		To:       []string{email},
+		Subject:  "Verify your email address",
+		Template: "email-verification",
+		Data: map[string]interface{}{
+			"FirstName":           user.FirstName,
+			"Email":               email,
+			"Link":                link,
+			"ExpirationInMinutes": int(expiration.Minutes()),
+		},
+	})
+}
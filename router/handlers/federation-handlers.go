@@ -0,0 +1,433 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	mux "github.com/gorilla/mux"
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+const (
+	// federationCallbackPath : Redirect URI to register at providers, under the public URL of this API
+	federationCallbackPath = "/v1/auth/federation/callback"
+
+	// federationStateCookieName : Cookie binding the pending federated login to the user agent that started it
+	federationStateCookieName = "federation"
+)
+
+var (
+	errExternalIdentityNotFound = errors.New("External identity not found")
+)
+
+// ReadIdentityProviders : External providers users can log in with, for the login page
+func ReadIdentityProviders(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	providers := []models.IdentityProviderInfo{}
+
+	for _, provider := range env.Config.Federation.Providers {
+		providers = append(providers, models.IdentityProviderInfo{ID: provider.ID, Name: provider.Name})
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(providers, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// StartFederatedLogin : Send the user agent to the login page of the provider query parameter
+func StartFederatedLogin(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	provider, ok := env.Config.Federation.Provider(r.URL.Query().Get("provider"))
+
+	if !ok {
+		return customhttpresponse.CodeDoesNotExist, models.ErrUnknownIdentityProvider
+	}
+
+	authorizationURL, state, err := env.Federation.AuthorizationURL(provider, federationCallbackURL(env), "")
+
+	if err != nil {
+		log.Printf("Could not start federated login at provider %s : %v", provider.ID, err)
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorProviderError}})
+	}
+
+	setFederationStateCookie(env, w, state)
+
+	return redirectOAuth(w, r, authorizationURL)
+}
+
+// CompleteFederatedLogin : Callback of providers, logging the user in or linking the identity, and sending the user
+// agent back to the frontend
+func CompleteFederatedLogin(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	// State must come back to the user agent that started the login, not to one an attacker sent the callback to
+	c, err := r.Cookie(federationStateCookieName)
+
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorInvalidState}})
+	}
+
+	clearFederationStateCookie(w)
+
+	federationState, err := env.Federation.ConsumeState(state)
+
+	if err != nil {
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorInvalidState}})
+	}
+
+	provider, ok := env.Config.Federation.Provider(federationState.ProviderID)
+
+	if !ok {
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorInvalidState}})
+	}
+
+	// User canceled or was refused by the provider
+	if query.Get("error") != "" {
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorProviderError}})
+	}
+
+	claims, err := env.Federation.Exchange(provider, federationCallbackURL(env), query.Get("code"), federationState)
+
+	if err != nil {
+		log.Printf("Could not complete federated login at provider %s : %v", provider.ID, err)
+		return redirectFederation(env, w, r, url.Values{"error": {models.FederationErrorProviderError}})
+	}
+
+	if federationState.LinkUserID != "" {
+		return redirectFederation(env, w, r, linkExternalIdentity(env, provider, claims, federationState.LinkUserID))
+	}
+
+	return redirectFederation(env, w, r, loginExternalIdentity(env, w, r, provider, claims))
+}
+
+// ReadExternalIdentities : List external identities linked to user
+func ReadExternalIdentities(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	identities, err := env.GORM.ListUserExternalIdentities(user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(identities, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// LinkExternalIdentity : Start linking an identity at the requested provider to user.
+// Returns the URL to send the user agent to, which comes back to the frontend with "linked" or "error" query parameter
+func LinkExternalIdentity(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+
+	// Linked identities log in as the user : delegated credentials cannot add any
+	if middlewares.IsDelegated(r) {
+		return models.CodeForbidden, errors.New("Identities can only be linked from a session of the user")
+	}
+
+	// Parse Request Body
+	var linkRequest models.ExternalIdentityLinkRequest
+	err := json.NewDecoder(r.Body).Decode(&linkRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&linkRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	provider, ok := env.Config.Federation.Provider(linkRequest.Provider)
+
+	if !ok {
+		return customhttpresponse.CodeDoesNotExist, models.ErrUnknownIdentityProvider
+	}
+
+	authorizationURL, state, err := env.Federation.AuthorizationURL(provider, federationCallbackURL(env), userID)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	setFederationStateCookie(env, w, state)
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(&models.FederationAuthorizationRedirect{AuthorizationURL: authorizationURL}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// DeleteExternalIdentity : Unlink an external identity from user
+func DeleteExternalIdentity(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	deleted, err := env.GORM.DeleteUserExternalIdentity(user, mux.Vars(r)["id"])
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !deleted {
+		return customhttpresponse.CodeDoesNotExist, errExternalIdentityNotFound
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// loginExternalIdentity : Log in the user of the identity of claims, signing them up if allowed.
+// Returns the query parameters to send the user agent back to the frontend with
+func loginExternalIdentity(env *models.Env, w http.ResponseWriter, r *http.Request, provider *models.IdentityProviderConfig, claims *models.ExternalIDTokenClaims) url.Values {
+
+	var user *models.User
+
+	identity, err := env.GORM.ReadExternalIdentity(provider.ID, claims.Subject)
+
+	switch {
+	case err == nil:
+		user, err = env.GORM.ReadUserFromID(identity.UserID)
+
+		if err != nil {
+			log.Printf("Could not read user of external identity %s : %v", identity.ID, err)
+			return url.Values{"error": {models.FederationErrorServerError}}
+		}
+
+	case env.GORM.IsRecordNotFoundError(err):
+
+		if !provider.AllowSignup {
+			return url.Values{"error": {models.FederationErrorSignupDisabled}}
+		}
+
+		var errorCode string
+
+		user, errorCode = signUpExternalIdentity(env, provider, claims)
+
+		if errorCode != "" {
+			return url.Values{"error": {errorCode}}
+		}
+
+	default:
+		log.Printf("Could not read external identity at provider %s : %v", provider.ID, err)
+		return url.Values{"error": {models.FederationErrorServerError}}
+	}
+
+	if user.Disabled {
+		return url.Values{"error": {models.FederationErrorAccountDisabled}}
+	}
+
+	// Provider login is only the first factor : session is created by CreateMFASession
+	if user.MFAEnabled {
+
+		mfaToken, err := createMFAChallenge(env, user.ID)
+
+		if err != nil {
+			log.Printf("Could not create MFA challenge of user %s : %v", user.ID, err)
+			return url.Values{"error": {models.FederationErrorServerError}}
+		}
+
+		return url.Values{"mfaToken": {mfaToken}}
+	}
+
+	_, err = storeSession(env, w, r, user.ID)
+
+	if err != nil {
+		log.Printf("Could not create session of user %s : %v", user.ID, err)
+		return url.Values{"error": {models.FederationErrorServerError}}
+	}
+
+	return url.Values{}
+}
+
+// signUpExternalIdentity : Create a user for the identity of claims. Returns the federation error code on failure
+func signUpExternalIdentity(env *models.Env, provider *models.IdentityProviderConfig, claims *models.ExternalIDTokenClaims) (*models.User, string) {
+
+	if claims.Email == "" {
+		return nil, models.FederationErrorEmailRequired
+	}
+
+	// Accounts are never claimed under an email their owner did not prove : whoever verifies it later would share the
+	// account with the identity
+	if !provider.TrustEmailVerified || !claims.EmailVerified {
+		return nil, models.FederationErrorEmailUnverified
+	}
+
+	// Existing accounts are never taken over from an email address : their owner must link the identity
+	_, err := env.GORM.ReadUserFromEmail(claims.Email)
+
+	if err == nil {
+		return nil, models.FederationErrorAccountExists
+	}
+
+	if !env.GORM.IsRecordNotFoundError(err) {
+		log.Printf("Could not read user for federated signup : %v", err)
+		return nil, models.FederationErrorServerError
+	}
+
+	// Random password nobody knows, until the user resets it
+	password, err := auth.GenerateToken()
+
+	if err != nil {
+		return nil, models.FederationErrorServerError
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+
+	if err != nil {
+		return nil, models.FederationErrorServerError
+	}
+
+	user, err := env.GORM.CreateUser(&models.UserCreateRequestBody{
+		Email:     claims.Email,
+		Password:  hashedPassword,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+	})
+
+	if err != nil {
+
+		// Address was taken by another account in the meantime
+		if match := utils.CaseInsensitiveContains(err.Error(), "duplicate entry"); match {
+			return nil, models.FederationErrorAccountExists
+		}
+
+		log.Printf("Could not create user for federated signup : %v", err)
+		return nil, models.FederationErrorServerError
+	}
+
+	err = env.GORM.CreateExternalIdentity(&models.ExternalIdentity{
+		UserID:   user.ID,
+		Provider: provider.ID,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+
+	if err != nil {
+		log.Printf("Could not link external identity of user %s : %v", user.ID, err)
+		return nil, models.FederationErrorServerError
+	}
+
+	// Admin role is only granted by the email verification of this API
+	err = env.GORM.UpdateUserEmail(user, claims.Email)
+
+	if err != nil {
+		log.Printf("Could not verify email of user %s : %v", user.ID, err)
+	}
+
+	user.EmailVerified = err == nil
+
+	return user, ""
+}
+
+// linkExternalIdentity : Link the identity of claims to the user of userID.
+// Returns the query parameters to send the user agent back to the frontend with
+func linkExternalIdentity(env *models.Env, provider *models.IdentityProviderConfig, claims *models.ExternalIDTokenClaims, userID string) url.Values {
+
+	identity, err := env.GORM.ReadExternalIdentity(provider.ID, claims.Subject)
+
+	if err == nil {
+
+		if identity.UserID != userID {
+			return url.Values{"error": {models.FederationErrorAlreadyLinked}}
+		}
+
+		return url.Values{"linked": {provider.ID}}
+	}
+
+	if !env.GORM.IsRecordNotFoundError(err) {
+		log.Printf("Could not read external identity at provider %s : %v", provider.ID, err)
+		return url.Values{"error": {models.FederationErrorServerError}}
+	}
+
+	err = env.GORM.CreateExternalIdentity(&models.ExternalIdentity{
+		UserID:   userID,
+		Provider: provider.ID,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+
+	if err != nil {
+		log.Printf("Could not link external identity of user %s : %v", userID, err)
+		return url.Values{"error": {models.FederationErrorServerError}}
+	}
+
+	return url.Values{"linked": {provider.ID}}
+}
+
+// federationCallbackURL : Redirect URI of this API registered at providers
+func federationCallbackURL(env *models.Env) string {
+
+	return env.Config.OAuth.Issuer + federationCallbackPath
+}
+
+// redirectFederation : Send the user agent back to the frontend with params
+func redirectFederation(env *models.Env, w http.ResponseWriter, r *http.Request, params url.Values) (string, error) {
+
+	return redirectOAuth(w, r, withQuery(env.Config.Federation.RedirectURL, params))
+}
+
+// setFederationStateCookie : Bind the pending federated login of state to the user agent
+func setFederationStateCookie(env *models.Env, w http.ResponseWriter, state string) {
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookieName,
+		Path:     federationCallbackPath,
+		HttpOnly: true,
+
+		// Must be attached to the top-level navigation coming back from the provider
+		SameSite: http.SameSiteLaxMode,
+
+		Value:  state,
+		MaxAge: int(env.Config.Federation.StateExpiration() / time.Second),
+	})
+}
+
+// clearFederationStateCookie : Remove the state cookie, once its login is completed
+func clearFederationStateCookie(w http.ResponseWriter) {
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationStateCookieName,
+		Path:     federationCallbackPath,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	models "vulnlabs-rest-api/models"
 	middlewares "vulnlabs-rest-api/router/middlewares"
+	validation "vulnlabs-rest-api/validation"
 	http "net/http"
 	"reflect"
 	"runtime"
@@ -24,20 +25,41 @@ type Greeter struct {
 	Message string
 }
 
-// CustomHandle : Custom Handlers Wrapper for API
+// CustomHandle : Custom Handlers Wrapper for API. API keys & OAuth access tokens are rejected, see CustomHandleWithPermissions
 func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 
-	statusCode := ""
+	return customHandle(env, false, handlers)
+}
+
+// CustomHandleWithPermissions : Custom Handlers Wrapper for API routes requiring permissions. Only those routes are
+// reached by API keys & OAuth access tokens, whose scopes must grant the permissions
+func CustomHandleWithPermissions(env *models.Env, permissions []string, handlers ...Handler) http.Handler {
+
+	return customHandle(env, true, append([]Handler{middlewares.RequirePermissions(permissions...)}, handlers...))
+}
+
+// customHandle : Wrap handlers, delegable telling wether API keys & OAuth access tokens may reach them
+func customHandle(env *models.Env, delegable bool, handlers []Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		responseDetails := &customhttpresponse.ResponseDetails{}
 
+		// Apply global rate limit to the client IP, whether it authenticates or not
+		action := strings.Split(runtime.FuncForPC(reflect.ValueOf(middlewares.IPRateLimitMiddleware).Pointer()).Name(), ".")[1]
+		statusCode, err := middlewares.IPRateLimitMiddleware(env, w, r)
+
+		if err != nil {
+			responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, statusCode)
+			writeResponse(nil, responseDetails, statusCode, w)
+			return
+		}
+
 		// Retrieve AuthMiddleware method name for response details
-		action := strings.Split(runtime.FuncForPC(reflect.ValueOf(middlewares.AuthMiddleware).Pointer()).Name(), ".")[1]
+		action = strings.Split(runtime.FuncForPC(reflect.ValueOf(middlewares.AuthMiddleware).Pointer()).Name(), ".")[1]
 
-		// Get UserID through authentication middleware
-		userID, err := middlewares.AuthMiddleware(env, w, r)
+		// Get UserID (and API key scopes) through authentication middleware
+		userID, scopes, err := middlewares.AuthMiddleware(env, w, r)
 
 		if err != nil {
 			responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, customhttpresponse.CodeInvalidToken)
@@ -45,9 +67,39 @@ func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 			return
 		}
 
+		if scopes != nil && !delegable {
+			responseDetails = customhttpresponse.NewResponseDetailsWithDebug("Route not available to API keys nor OAuth access tokens", env.Config.Service, action, models.CodeForbidden)
+			writeResponse(nil, responseDetails, models.CodeForbidden, w)
+			return
+		}
+
+		// Apply global rate limit to the authenticated user
+		statusCode, err = middlewares.RateLimitMiddleware(env, w, r, userID)
+
+		if err != nil {
+			action = strings.Split(runtime.FuncForPC(reflect.ValueOf(middlewares.RateLimitMiddleware).Pointer()).Name(), ".")[1]
+			responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, statusCode)
+			writeResponse(nil, responseDetails, statusCode, w)
+			return
+		}
+
+		// Check CSRF token of cookie-authenticated mutations
+		statusCode, err = middlewares.CSRFMiddleware(env, w, r)
+
+		if err != nil {
+			action = strings.Split(runtime.FuncForPC(reflect.ValueOf(middlewares.CSRFMiddleware).Pointer()).Name(), ".")[1]
+			responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, statusCode)
+			writeResponse(nil, responseDetails, statusCode, w)
+			return
+		}
+
 		// Pass UserID to request context
 		ctx := context.WithValue(r.Context(), middlewares.ContextUserKey, userID)
 
+		if scopes != nil {
+			ctx = context.WithValue(ctx, middlewares.ContextAPIKeyScopesKey, scopes)
+		}
+
 		if err != nil {
 
 			if statusCode == customhttpresponse.CodeValidationFailed {
@@ -57,7 +109,7 @@ func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 				responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, statusCode)
 			}
 
-			customhttpresponse.WriteResponse(nil, responseDetails, w)
+			writeResponse(nil, responseDetails, statusCode, w)
 
 			// We can then log error somewhere here
 
@@ -73,6 +125,13 @@ func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 
 			if err != nil {
 
+				// Structured validation errors are detailed in response data
+				if validationErrors, ok := err.(validation.Errors); ok && statusCode == customhttpresponse.CodeValidationFailed {
+					responseDetails = customhttpresponse.NewResponseDetailsWithFields(validationErrors.Fields(), env.Config.Service, action, statusCode)
+					customhttpresponse.WriteResponse(validationErrors, responseDetails, w)
+					return
+				}
+
 				if statusCode == customhttpresponse.CodeValidationFailed {
 					responseDetails = customhttpresponse.NewResponseDetailsWithFields(strings.Split(err.Error(), "|"), env.Config.Service, runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name(), statusCode)
 				} else {
@@ -80,7 +139,7 @@ func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 					responseDetails = customhttpresponse.NewResponseDetailsWithDebug(err.Error(), env.Config.Service, action, statusCode)
 				}
 
-				customhttpresponse.WriteResponse(nil, responseDetails, w)
+				writeResponse(nil, responseDetails, statusCode, w)
 
 				// We can then log error somewhere here
 
@@ -91,3 +150,43 @@ func CustomHandle(env *models.Env, handlers ...Handler) http.Handler {
 		// We can then log success somewhere here
 	})
 }
+
+// customCodeStatuses : HTTP status of the response codes of models, unknown to customhttpresponse
+var customCodeStatuses = map[string]int{
+	models.CodeForbidden:        http.StatusForbidden,
+	models.CodeInvalidCSRFToken: http.StatusForbidden,
+	models.CodeLockedOut:        http.StatusTooManyRequests,
+	models.CodeRateLimited:      http.StatusTooManyRequests,
+}
+
+// writeResponse : Write response as customhttpresponse does, with the HTTP status of statusCode if it is a code of models
+func writeResponse(data interface{}, responseDetails *customhttpresponse.ResponseDetails, statusCode string, w http.ResponseWriter) {
+
+	if status, ok := customCodeStatuses[statusCode]; ok {
+		w = &statusResponseWriter{ResponseWriter: w, status: status}
+	}
+
+	customhttpresponse.WriteResponse(data, responseDetails, w)
+}
+
+// statusResponseWriter : Response writer sending status whatever the status it is given
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(int) {
+
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *statusResponseWriter) Write(data []byte) (int, error) {
+
+	w.WriteHeader(w.status)
+
+	return w.ResponseWriter.Write(data)
+}
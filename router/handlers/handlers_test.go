@@ -0,0 +1,50 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"vulnlabs-rest-api/models"
+)
+
+func TestStatusResponseWriter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		write  func(w http.ResponseWriter)
+		status int
+	}{
+		{"explicit status", func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK); w.Write([]byte("{}")) }, http.StatusTooManyRequests},
+		{"implicit status", func(w http.ResponseWriter) { w.Write([]byte("{}")) }, http.StatusTooManyRequests},
+		{"status written twice", func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadRequest); w.WriteHeader(http.StatusOK) }, http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+
+		recorder := httptest.NewRecorder()
+		test.write(&statusResponseWriter{ResponseWriter: recorder, status: http.StatusTooManyRequests})
+
+		if recorder.Code != test.status {
+			t.Errorf("%s : got status %d, want %d", test.name, recorder.Code, test.status)
+		}
+	}
+}
+
+func TestCustomCodeStatuses(t *testing.T) {
+
+	tests := []struct {
+		code   string
+		status int
+	}{
+		{models.CodeForbidden, http.StatusForbidden},
+		{models.CodeInvalidCSRFToken, http.StatusForbidden},
+		{models.CodeLockedOut, http.StatusTooManyRequests},
+		{models.CodeRateLimited, http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		if status := customCodeStatuses[test.code]; status != test.status {
+			t.Errorf("%s : got status %d, want %d", test.code, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	"vulnlabs-rest-api/utils"
+)
+
+// loginCounter : Failed logins counter of an account or an IP
+type loginCounter struct {
+	prefix       string
+	id           string
+	freeAttempts int
+}
+
+// failuresKey : Redis key of the failures count
+func (counter loginCounter) failuresKey() string {
+
+	return fmt.Sprintf("%s:%s:%s", counter.prefix, counter.id, models.RedisLoginFailuresSuffix)
+}
+
+// lockedUntilKey : Redis key of the lockout end, as Unix time
+func (counter loginCounter) lockedUntilKey() string {
+
+	return fmt.Sprintf("%s:%s:%s", counter.prefix, counter.id, models.RedisLoginLockedUntilSuffix)
+}
+
+// accountLoginCounter : Counter of the account identified by email, whether it exists or not not to disclose it
+func accountLoginCounter(env *models.Env, email string) loginCounter {
+
+	return loginCounter{
+		prefix:       models.RedisLoginAccountPrefix,
+		id:           auth.TokenDigest(strings.ToLower(strings.TrimSpace(email))),
+		freeAttempts: env.Config.LoginLockout.AccountAttempts(),
+	}
+}
+
+// loginCounters : Counters of the account & client IP of a login attempt
+func loginCounters(env *models.Env, r *http.Request, email string) []loginCounter {
+
+	return []loginCounter{
+		accountLoginCounter(env, email),
+		{
+			prefix:       models.RedisLoginIPPrefix,
+			id:           utils.GetRequestIP(r),
+			freeAttempts: env.Config.LoginLockout.IPAttempts(),
+		},
+	}
+}
+
+// loginAttempt : Login attempt being checked, with the counters it locked out
+type loginAttempt struct {
+	counters []loginCounter
+	locked   []loginCounter
+}
+
+// registerLoginAttempt : Count a login attempt of the account & client IP before the credentials are checked,
+// returning the remaining lockout of either of them, zero if the attempt is allowed. Counting first means concurrent
+// attempts each get their own count, so that they cannot all be let through by a single check
+func registerLoginAttempt(env *models.Env, r *http.Request, email string) (*loginAttempt, time.Duration) {
+
+	config := env.Config.LoginLockout
+	counters := loginCounters(env, r, email)
+
+	// Locked out attempts are refused before being counted, so that they extend no lockout
+	for _, counter := range counters {
+
+		if lockout := remainingLockout(env, counter); lockout > 0 {
+			return nil, lockout
+		}
+	}
+
+	attempt := &loginAttempt{}
+
+	for _, counter := range counters {
+
+		attempts, err := env.Redis.Incr(counter.failuresKey())
+
+		if err != nil {
+			log.Printf("Could not count login attempt : %v", err)
+			continue
+		}
+
+		attempt.counters = append(attempt.counters, counter)
+
+		// Failures are forgotten after a quiet period
+		env.Redis.Expire(counter.failuresKey(), int(config.FailuresExpiration().Seconds()))
+
+		delay := config.Delay(attempts, counter.freeAttempts)
+
+		if delay == 0 {
+			continue
+		}
+
+		// Past the free attempts, an attempt is allowed only once the lockout of the previous one ended,
+		// and locks the following ones out in turn
+		lockedUntil := strconv.FormatInt(time.Now().Add(delay).Unix(), 10)
+		locked, err := env.Redis.SetIfNotExists(counter.lockedUntilKey(), []byte(lockedUntil), int(delay.Seconds()))
+
+		if err != nil {
+			log.Printf("Could not lock out login : %v", err)
+			continue
+		}
+
+		if !locked {
+
+			// A concurrent attempt locked counter out first : refused attempts are not counted, by any counter
+			forgetLoginAttempt(env, attempt)
+
+			if lockout := remainingLockout(env, counter); lockout > time.Second {
+				return nil, lockout
+			}
+
+			return nil, time.Second
+		}
+
+		attempt.locked = append(attempt.locked, counter)
+	}
+
+	return attempt, 0
+}
+
+// remainingLockout : Time until the lockout of counter ends, zero if it is not locked out
+func remainingLockout(env *models.Env, counter loginCounter) time.Duration {
+
+	// No lock stored
+	lockedUntil, err := env.Redis.Get(counter.lockedUntilKey())
+
+	if err != nil {
+		return 0
+	}
+
+	until, err := strconv.ParseInt(string(lockedUntil), 10, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	if remaining := time.Until(time.Unix(until, 0)); remaining > 0 {
+		return remaining
+	}
+
+	return 0
+}
+
+// forgetLoginAttempt : Uncount attempt, refused or whose credentials were right, and lift the lockouts it set.
+// Otherwise the second factor of the login would be locked out by its own first factor
+func forgetLoginAttempt(env *models.Env, attempt *loginAttempt) {
+
+	for _, counter := range attempt.counters {
+
+		_, err := env.Redis.Decr(counter.failuresKey())
+
+		if err != nil {
+			log.Printf("Could not uncount login attempt : %v", err)
+		}
+	}
+
+	for _, counter := range attempt.locked {
+
+		err := env.Redis.Delete(counter.lockedUntilKey())
+
+		if err != nil {
+			log.Printf("Could not lift login lockout : %v", err)
+		}
+	}
+}
+
+// resetLoginFailures : Forget failed logins & lift lockout of the account identified by email
+func resetLoginFailures(env *models.Env, email string) error {
+
+	counter := accountLoginCounter(env, email)
+
+	err := env.Redis.Delete(counter.failuresKey())
+
+	if err != nil {
+		return err
+	}
+
+	return env.Redis.Delete(counter.lockedUntilKey())
+}
+
+// lockedOut : Tell the client when to retry a locked out login
+func lockedOut(w http.ResponseWriter, lockout time.Duration) (string, error) {
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+
+	return models.CodeLockedOut, errors.New("Too many failed logins, retry later")
+}
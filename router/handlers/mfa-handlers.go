@@ -0,0 +1,354 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+var errTOTPCodeReplayed = errors.New("TOTP code already used")
+
+// EnrollMFA : Generate a TOTP secret for user. MFA is enabled once a code is confirmed through ConfirmMFA
+func EnrollMFA(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get existing user from DB
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if user.MFAEnabled {
+		return customhttpresponse.CodeAlreadyExists, errors.New("MFA is already enabled")
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	encryptedSecret, err := auth.EncryptSecret(secret)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Store pending secret, replacing any unconfirmed one
+	err = env.GORM.UpdateUserMFA(user, encryptedSecret, false)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	issuer := env.Config.MFA.Issuer
+
+	if issuer == "" {
+		issuer = env.Config.Service
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(
+		models.MFAEnrollment{
+			Secret: secret,
+			URI:    auth.TOTPProvisioningURI(issuer, user.Email, secret),
+		}, responseDetails, w,
+	)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ConfirmMFA : Enable MFA once user proves the authenticator app is set up
+func ConfirmMFA(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get existing user from DB
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if user.MFAEnabled {
+		return customhttpresponse.CodeAlreadyExists, errors.New("MFA is already enabled")
+	}
+
+	if user.MFASecret == "" {
+		return customhttpresponse.CodeDoesNotExist, errors.New("No pending MFA enrollment")
+	}
+
+	// Parse Request Body
+	var mfaCodeRequest models.MFACodeRequest
+	err = json.NewDecoder(r.Body).Decode(&mfaCodeRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	valid, err := verifyTOTP(env, user, mfaCodeRequest.Code)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !valid {
+		return customhttpresponse.CodeBadLogin, errors.New("Invalid MFA code")
+	}
+
+	err = env.GORM.UpdateUserMFA(user, user.MFASecret, true)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	recoveryCodes, err := generateRecoveryCodes(env, user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(recoveryCodes, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// DisableMFA : Disable MFA and forget TOTP secret. Requires a valid TOTP or recovery code
+func DisableMFA(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get existing user from DB
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !user.MFAEnabled {
+		return customhttpresponse.CodeDoesNotExist, errors.New("MFA is not enabled")
+	}
+
+	// Parse Request Body
+	var mfaCodeRequest models.MFACodeRequest
+	err = json.NewDecoder(r.Body).Decode(&mfaCodeRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	valid, err := verifySecondFactor(env, user, mfaCodeRequest.Code, mfaCodeRequest.RecoveryCode)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !valid {
+		return customhttpresponse.CodeBadLogin, errors.New("Invalid MFA code")
+	}
+
+	err = env.GORM.UpdateUserMFA(user, "", false)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Remaining recovery codes are meaningless without MFA
+	err = env.GORM.ReplaceRecoveryCodes(user, nil)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// RegenerateRecoveryCodes : Invalidate user recovery codes and generate a new batch. Requires a valid TOTP or recovery code
+func RegenerateRecoveryCodes(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get existing user from DB
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !user.MFAEnabled {
+		return customhttpresponse.CodeDoesNotExist, errors.New("MFA is not enabled")
+	}
+
+	// Parse Request Body
+	var mfaCodeRequest models.MFACodeRequest
+	err = json.NewDecoder(r.Body).Decode(&mfaCodeRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	valid, err := verifySecondFactor(env, user, mfaCodeRequest.Code, mfaCodeRequest.RecoveryCode)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !valid {
+		return customhttpresponse.CodeBadLogin, errors.New("Invalid MFA code")
+	}
+
+	recoveryCodes, err := generateRecoveryCodes(env, user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(recoveryCodes, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ReadRecoveryCodes : Return the number of unused recovery codes
+func ReadRecoveryCodes(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get existing user from DB
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError((err)) {
+			return customhttpresponse.CodeDoesNotExist, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	remaining, err := env.GORM.CountRecoveryCodes(user)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(models.MFARecoveryCodesStatus{Remaining: remaining}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// verifySecondFactor : Check TOTP code, or consume recovery code if no TOTP code is given
+func verifySecondFactor(env *models.Env, user *models.User, code string, recoveryCode string) (bool, error) {
+
+	if code == "" && recoveryCode != "" {
+		return env.GORM.ConsumeRecoveryCode(user, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	return verifyTOTP(env, user, code)
+}
+
+// generateRecoveryCodes : Replace user recovery codes by a new batch, only hashes are stored
+func generateRecoveryCodes(env *models.Env, user *models.User) (*models.MFARecoveryCodes, error) {
+
+	codes, err := auth.GenerateRecoveryCodes(env.Config.MFA.RecoveryCodes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	codeHashes := make([]string, len(codes))
+
+	for i, code := range codes {
+		codeHashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	err = env.GORM.ReplaceRecoveryCodes(user, codeHashes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFARecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// verifyTOTP : Check code against user TOTP secret. A code cannot be used twice
+func verifyTOTP(env *models.Env, user *models.User, code string) (bool, error) {
+
+	secret, err := auth.DecryptSecret(user.MFASecret)
+
+	if err != nil {
+		return false, err
+	}
+
+	step, valid := auth.ValidateTOTPCode(secret, code, time.Now())
+
+	if !valid {
+		return false, nil
+	}
+
+	// Reject replays : last accepted time step is kept as long as its code could still be valid. It is checked & set
+	// in a watched transaction, so that concurrent requests cannot both use a code
+	stepStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisUserStoragePrefix, user.ID, models.RedisUserStorageMFAStepSuffix)
+	stepExpiration := (2*auth.TOTPAllowedSkew + 1) * auth.TOTPPeriodSeconds
+
+	for attempt := 1; attempt <= models.RedisTransactionMaxAttempts; attempt++ {
+
+		_, err = env.Redis.Watch([]string{stepStorageKey}, func() ([]models.RedisCommand, error) {
+
+			lastStep, err := env.Redis.Get(stepStorageKey)
+
+			if err == nil {
+				if last, err := strconv.ParseInt(string(lastStep), 10, 64); err == nil && step <= last {
+					return nil, errTOTPCodeReplayed
+				}
+			}
+
+			return []models.RedisCommand{
+				models.RedisCommand{
+					Command: "SETEX",
+					Args:    []interface{}{stepStorageKey, stepExpiration, []byte(strconv.FormatInt(step, 10))},
+				},
+			}, nil
+		})
+
+		if err != models.ErrRedisTransactionAborted {
+			break
+		}
+	}
+
+	if err == errTOTPCodeReplayed {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	mux "github.com/gorilla/mux"
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+// AdminCreateOAuthClient : Register an OAuth client. The secret of confidential clients is only returned in this response
+func AdminCreateOAuthClient(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Parse Request Body
+	var clientCreateRequest models.OAuthClientCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&clientCreateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&clientCreateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	validationErrors := validation.Errors{}
+
+	for _, redirectURI := range clientCreateRequest.RedirectURIs {
+
+		if !isValidRedirectURI(redirectURI) {
+			validationErrors.Add("redirectURIs", "redirectURI", "must be absolute https URLs without fragment (http allowed on loopback), "+redirectURI+" is not")
+			break
+		}
+	}
+
+	for _, scope := range clientCreateRequest.Scopes {
+
+		if !models.IsOAuthScope(scope) {
+			validationErrors.Add("scopes", "scope", "must be supported OAuth scopes, "+scope+" is not")
+			break
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return customhttpresponse.CodeValidationFailed, validationErrors
+	}
+
+	client := &models.OAuthClient{
+		Name:         clientCreateRequest.Name,
+		Public:       clientCreateRequest.Public,
+		FirstParty:   clientCreateRequest.FirstParty,
+		RedirectURIs: models.SpaceSeparatedList(clientCreateRequest.RedirectURIs),
+		Scopes:       models.SpaceSeparatedList(models.ParseOAuthScope(strings.Join(clientCreateRequest.Scopes, " "))),
+	}
+
+	secret := ""
+
+	// Public clients have no secret to authenticate with
+	if !client.Public {
+
+		secret, err = auth.GenerateToken()
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+
+		client.SecretHash = auth.TokenDigest(secret)
+	}
+
+	err = env.GORM.CreateOAuthClient(client)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(&models.CreatedOAuthClient{OAuthClient: *client, Secret: secret}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminListOAuthClients : List OAuth clients, without their secrets
+func AdminListOAuthClients(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	clients, err := env.GORM.ListOAuthClients()
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(clients, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// AdminDeleteOAuthClient : Unregister an OAuth client. Its refresh tokens stop working, its access tokens expire shortly
+func AdminDeleteOAuthClient(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	deleted, err := env.GORM.DeleteOAuthClient(mux.Vars(r)["id"])
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if !deleted {
+		return customhttpresponse.CodeDoesNotExist, errOAuthClientNotFound
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ReadOAuthClientInfo : Public infos of an OAuth client, for the consent page
+func ReadOAuthClientInfo(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	client, err := env.GORM.ReadOAuthClientFromID(mux.Vars(r)["id"])
+
+	if err != nil {
+		if env.GORM.IsRecordNotFoundError(err) {
+			return customhttpresponse.CodeDoesNotExist, errOAuthClientNotFound
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(&models.OAuthClientInfo{ID: client.ID, Name: client.Name}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// isValidRedirectURI : Absolute URL without fragment (RFC 6749 section 3.1.2), over https unless on loopback
+func isValidRedirectURI(redirectURI string) bool {
+
+	// Redirect URIs are stored space separated
+	if strings.ContainsAny(redirectURI, " \t\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(redirectURI)
+
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	if u.Scheme == "https" {
+		return true
+	}
+
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+
+	return u.Scheme == "http" && (host == "localhost" || (ip != nil && ip.IsLoopback()))
+}
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestIsValidRedirectURI(t *testing.T) {
+
+	tests := []struct {
+		redirectURI string
+		valid       bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"https://app.example.com/callback?client=1", true},
+		{"https://app.example.com:8443/callback", true},
+		{"http://localhost:3000/callback", true},
+		{"http://127.0.0.1:3000/callback", true},
+		{"http://[::1]:3000/callback", true},
+		{"http://app.example.com/callback", false},
+		{"http://localhost.example.com/callback", false},
+		{"https://app.example.com/callback#token", false},
+		{"https://app.example.com/call back", false},
+		{"https://app.example.com/callback\nhttps://evil.example.com", false},
+		{"/callback", false},
+		{"//app.example.com/callback", false},
+		{"https:///callback", false},
+		{"javascript:alert(1)", false},
+		{"com.example.app:/callback", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if valid := isValidRedirectURI(test.redirectURI); valid != test.valid {
+			t.Errorf("%q : got %t, want %t", test.redirectURI, valid, test.valid)
+		}
+	}
+}
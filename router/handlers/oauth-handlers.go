@@ -0,0 +1,657 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+var (
+	errOAuthClientNotFound = errors.New("OAuth client not found")
+	errInvalidOAuthClient  = errors.New("Invalid client credentials")
+)
+
+// authorizationRequest : Authorization request whose client & redirect URI are verified
+type authorizationRequest struct {
+	client              *models.OAuthClient
+	redirectURI         string
+	redirectURIProvided bool
+	responseType        string
+	scopes              []string
+	state               string
+	codeChallenge       string
+	codeChallengeMethod string
+	nonce               string
+}
+
+// Authorize : OAuth authorization endpoint (RFC 6749 section 3.1), navigated to by the user agent.
+// Users are sent to the frontend login page if they have no session, then to its consent page if they did not
+// consent to the requested scopes yet, and are finally redirected back to the client with an authorization code
+func Authorize(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	request, err := parseAuthorizationRequest(env, r.URL.Query())
+
+	// Client cannot be trusted with the error
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	if oauthError := request.validate(); oauthError != nil {
+		return redirectOAuth(w, r, request.errorRedirect(oauthError.Error, oauthError.ErrorDescription))
+	}
+
+	// Only the session cookie of the user agent can authorize clients
+	c, err := r.Cookie(middlewares.SessionCookieName)
+
+	userID := ""
+
+	if err == nil {
+		userID, err = env.Sessions.ReadSessionUserID(c.Value)
+	}
+
+	if err != nil {
+
+		if env.Config.OAuth.LoginURL == "" {
+			return redirectOAuth(w, r, request.errorRedirect(models.OAuthErrorLoginRequired, ""))
+		}
+
+		returnTo := env.Config.OAuth.Issuer + r.URL.RequestURI()
+
+		return redirectOAuth(w, r, withQuery(env.Config.OAuth.LoginURL, url.Values{"returnTo": {returnTo}}))
+	}
+
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil || user.Disabled {
+		return redirectOAuth(w, r, request.errorRedirect(models.OAuthErrorAccessDenied, ""))
+	}
+
+	// First-party clients need no consent
+	if !request.client.FirstParty && !isSubset(grantableScopes(env, user, request.scopes), env.OAuth.ConsentedScopes(user.ID, request.client.ID)) {
+
+		if env.Config.OAuth.ConsentURL == "" {
+			return redirectOAuth(w, r, request.errorRedirect(models.OAuthErrorConsentRequired, ""))
+		}
+
+		return redirectOAuth(w, r, withQuery(env.Config.OAuth.ConsentURL, r.URL.Query()))
+	}
+
+	redirectURI, err := approveAuthorizationRequest(env, request, user, sessionAuthTime(env, user.ID, c.Value))
+
+	if err != nil {
+		log.Printf("Could not approve authorization request of client %s : %v", request.client.ID, err)
+		return redirectOAuth(w, r, request.errorRedirect(models.OAuthErrorServerError, ""))
+	}
+
+	return redirectOAuth(w, r, redirectURI)
+}
+
+// ConsentOAuthAuthorization : Record the decision of the user on the consent page, posting the authorization request
+// parameters & consent=approve|deny as form. Returns where to redirect the user agent to
+func ConsentOAuthAuthorization(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	userID := r.Context().Value(middlewares.ContextUserKey).(string)
+
+	// Delegated credentials cannot consent on behalf of the user
+	c, err := r.Cookie(middlewares.SessionCookieName)
+
+	if err != nil || r.Header.Get("Authorization") != "" {
+		return models.CodeForbidden, errors.New("Clients can only be authorized from a session of the user")
+	}
+
+	err = r.ParseForm()
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	request, err := parseAuthorizationRequest(env, r.PostForm)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	user, err := env.GORM.ReadUserFromID(userID)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	redirectURI := ""
+
+	if oauthError := request.validate(); oauthError != nil {
+
+		redirectURI = request.errorRedirect(oauthError.Error, oauthError.ErrorDescription)
+
+	} else {
+
+		switch r.PostForm.Get("consent") {
+		case models.OAuthConsentApprove:
+
+			err = env.OAuth.AddConsent(user.ID, request.client.ID, grantableScopes(env, user, request.scopes))
+
+			if err != nil {
+				return customhttpresponse.CodeInternalError, err
+			}
+
+			redirectURI, err = approveAuthorizationRequest(env, request, user, sessionAuthTime(env, user.ID, c.Value))
+
+			if err != nil {
+				return customhttpresponse.CodeInternalError, err
+			}
+
+		case models.OAuthConsentDeny:
+			redirectURI = request.errorRedirect(models.OAuthErrorAccessDenied, "")
+
+		default:
+			return customhttpresponse.CodeValidationFailed, errors.New("consent must be approve or deny")
+		}
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(&models.OAuthAuthorizationRedirect{RedirectURI: redirectURI}, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// CreateOAuthToken : OAuth token endpoint (RFC 6749 section 3.2), for the authorization_code & refresh_token grants.
+// Responses follow the OAuth format rather than the API one
+func CreateOAuthToken(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	err := r.ParseForm()
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusBadRequest, models.OAuthErrorInvalidRequest, "Malformed form body")
+	}
+
+	client, err := authenticateOAuthClient(env, r)
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusUnauthorized, models.OAuthErrorInvalidClient, err.Error())
+	}
+
+	var tokens *models.OAuthTokens
+	var oauthError *models.OAuthErrorResponse
+
+	switch r.PostForm.Get("grant_type") {
+	case models.OAuthGrantTypeAuthorizationCode:
+		tokens, oauthError = exchangeAuthorizationCode(env, r, client)
+	case models.OAuthGrantTypeRefreshToken:
+		tokens, oauthError = refreshOAuthTokens(env, r, client)
+	default:
+		oauthError = &models.OAuthErrorResponse{Error: models.OAuthErrorUnsupportedGrantType}
+	}
+
+	if oauthError != nil {
+
+		status := http.StatusBadRequest
+
+		if oauthError.Error == models.OAuthErrorServerError {
+			status = http.StatusInternalServerError
+		}
+
+		return writeOAuthError(w, status, oauthError.Error, oauthError.ErrorDescription)
+	}
+
+	return writeRawJSON(w, newOAuthTokenResponse(tokens))
+}
+
+// IntrospectOAuthToken : Token introspection endpoint (RFC 7662), for confidential clients such as resource servers
+func IntrospectOAuthToken(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	err := r.ParseForm()
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusBadRequest, models.OAuthErrorInvalidRequest, "Malformed form body")
+	}
+
+	client, err := authenticateOAuthClient(env, r)
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusUnauthorized, models.OAuthErrorInvalidClient, err.Error())
+	}
+
+	if client.Public {
+		return writeOAuthError(w, http.StatusUnauthorized, models.OAuthErrorInvalidClient, "Public clients cannot introspect tokens")
+	}
+
+	return writeRawJSON(w, introspectOAuthToken(env, r.PostForm.Get("token")))
+}
+
+// RevokeOAuthToken : Token revocation endpoint (RFC 7009). Clients can only revoke their own tokens,
+// revoking a refresh token revokes the whole grant
+func RevokeOAuthToken(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	err := r.ParseForm()
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusBadRequest, models.OAuthErrorInvalidRequest, "Malformed form body")
+	}
+
+	client, err := authenticateOAuthClient(env, r)
+
+	if err != nil {
+		return writeOAuthError(w, http.StatusUnauthorized, models.OAuthErrorInvalidClient, err.Error())
+	}
+
+	token := r.PostForm.Get("token")
+
+	if claims, err := env.OAuth.ParseAccessToken(token); err == nil {
+
+		if claims.ClientID == client.ID {
+			err = env.OAuth.RevokeAccessToken(claims)
+		}
+
+		if err != nil {
+			return writeOAuthError(w, http.StatusServiceUnavailable, models.OAuthErrorServerError, "")
+		}
+
+	} else if grant, err := env.OAuth.ReadRefreshTokenGrant(token); err == nil && grant.ClientID == client.ID {
+
+		err = env.OAuth.RevokeGrant(grant.ID)
+
+		if err != nil {
+			return writeOAuthError(w, http.StatusServiceUnavailable, models.OAuthErrorServerError, "")
+		}
+	}
+
+	// Unknown tokens are not an error (RFC 7009 section 2.2)
+	w.WriteHeader(http.StatusOK)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// parseAuthorizationRequest : Authorization request of values, whose client & redirect URI must be verified
+// before any error can be redirected to the client
+func parseAuthorizationRequest(env *models.Env, values url.Values) (*authorizationRequest, error) {
+
+	client, err := env.GORM.ReadOAuthClientFromID(values.Get("client_id"))
+
+	if err != nil {
+		return nil, errOAuthClientNotFound
+	}
+
+	redirectURI := values.Get("redirect_uri")
+	redirectURIProvided := redirectURI != ""
+
+	// Redirect URI can be omitted when a single one is registered
+	if !redirectURIProvided && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+
+	if !utils.IsStringIn(redirectURI, client.RedirectURIs) {
+		return nil, errors.New("Unregistered redirect URI")
+	}
+
+	return &authorizationRequest{
+		client:              client,
+		redirectURI:         redirectURI,
+		redirectURIProvided: redirectURIProvided,
+		responseType:        values.Get("response_type"),
+		scopes:              models.ParseOAuthScope(values.Get("scope")),
+		state:               values.Get("state"),
+		codeChallenge:       values.Get("code_challenge"),
+		codeChallengeMethod: values.Get("code_challenge_method"),
+		nonce:               values.Get("nonce"),
+	}, nil
+}
+
+// validate : Check the authorization request parameters, returning the error to redirect to the client if any
+func (request *authorizationRequest) validate() *models.OAuthErrorResponse {
+
+	if request.responseType != models.OAuthResponseTypeCode {
+		return &models.OAuthErrorResponse{Error: models.OAuthErrorUnsupportedResponseType}
+	}
+
+	for _, scope := range request.scopes {
+
+		if !models.IsOAuthScope(scope) || !utils.IsStringIn(scope, request.client.Scopes) {
+			return &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidScope, ErrorDescription: "Scope " + scope + " cannot be requested"}
+		}
+	}
+
+	// Public clients cannot authenticate : PKCE binds the code to the client that requested it
+	if request.codeChallenge == "" {
+
+		if request.client.Public {
+			return &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidRequest, ErrorDescription: "PKCE is required for public clients"}
+		}
+
+	} else if request.codeChallengeMethod != models.OAuthCodeChallengeMethodS256 {
+		return &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidRequest, ErrorDescription: "Code challenge method must be S256"}
+	}
+
+	return nil
+}
+
+// errorRedirect : Redirect URI of the client, carrying an error
+func (request *authorizationRequest) errorRedirect(code string, description string) string {
+
+	params := url.Values{"error": {code}}
+
+	if description != "" {
+		params.Set("error_description", description)
+	}
+
+	return request.redirect(params)
+}
+
+// redirect : Redirect URI of the client, carrying params & the request state
+func (request *authorizationRequest) redirect(params url.Values) string {
+
+	if request.state != "" {
+		params.Set("state", request.state)
+	}
+
+	return withQuery(request.redirectURI, params)
+}
+
+// approveAuthorizationRequest : Issue an authorization code of request for user, returning the redirect URI carrying it
+func approveAuthorizationRequest(env *models.Env, request *authorizationRequest, user *models.User, authTime time.Time) (string, error) {
+
+	code, err := env.OAuth.CreateAuthorizationCode(&models.OAuthAuthorizationCode{
+		ClientID:            request.client.ID,
+		UserID:              user.ID,
+		Scopes:              grantableScopes(env, user, request.scopes),
+		RedirectURI:         request.redirectURI,
+		RedirectURIProvided: request.redirectURIProvided,
+		CodeChallenge:       request.codeChallenge,
+		CodeChallengeMethod: request.codeChallengeMethod,
+		AuthTime:            authTime,
+		Nonce:               request.nonce,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return request.redirect(url.Values{"code": {code}}), nil
+}
+
+// exchangeAuthorizationCode : Issue tokens for the authorization code grant
+func exchangeAuthorizationCode(env *models.Env, r *http.Request, client *models.OAuthClient) (*models.OAuthTokens, *models.OAuthErrorResponse) {
+
+	// Codes of other clients are left untouched, so that they cannot be burnt by presenting them
+	code, err := env.OAuth.ConsumeAuthorizationCode(r.PostForm.Get("code"), client.ID)
+
+	if err != nil {
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: "Invalid or expired authorization code"}
+	}
+
+	// Redirect URI must be repeated only if it was included in the authorization request (RFC 6749 section 4.1.3)
+	if code.RedirectURIProvided && code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: "Redirect URI does not match the authorization request"}
+	}
+
+	codeVerifier := r.PostForm.Get("code_verifier")
+
+	if (code.CodeChallenge == "" && codeVerifier != "") || (code.CodeChallenge != "" && !auth.CheckPKCECodeVerifier(codeVerifier, code.CodeChallenge)) {
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: "Invalid code verifier"}
+	}
+
+	user, err := env.GORM.ReadUserFromID(code.UserID)
+
+	if err != nil || user.Disabled {
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: "User cannot be authorized anymore"}
+	}
+
+	tokens, err := env.OAuth.IssueTokens(client.ID, user.ID, code.Scopes, code.AuthTime)
+
+	if err != nil {
+		log.Printf("Could not issue OAuth tokens to client %s : %v", client.ID, err)
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorServerError}
+	}
+
+	return issueIDToken(env, tokens, user, code.Nonce)
+}
+
+// refreshOAuthTokens : Issue tokens for the refresh token grant, rotating the refresh token
+func refreshOAuthTokens(env *models.Env, r *http.Request, client *models.OAuthClient) (*models.OAuthTokens, *models.OAuthErrorResponse) {
+
+	tokens, err := env.OAuth.RefreshTokens(client.ID, r.PostForm.Get("refresh_token"), models.ParseOAuthScope(r.PostForm.Get("scope")))
+
+	switch err {
+	case nil:
+	case models.ErrOAuthInvalidScope:
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidScope, ErrorDescription: err.Error()}
+	case models.ErrOAuthRefreshTokenReused:
+		log.Printf("OAuth refresh token of client %s reused, grant revoked", client.ID)
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: err.Error()}
+	case models.ErrOAuthInvalidGrant:
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: err.Error()}
+	default:
+		log.Printf("Could not refresh OAuth tokens of client %s : %v", client.ID, err)
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorServerError}
+	}
+
+	// Grants of disabled or deleted users end on their next refresh
+	user, err := env.GORM.ReadUserFromID(tokens.Grant.UserID)
+
+	if err != nil || user.Disabled {
+
+		env.OAuth.RevokeGrant(tokens.Grant.ID)
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorInvalidGrant, ErrorDescription: "User cannot be authorized anymore"}
+	}
+
+	// Refreshed ID tokens carry no nonce (OpenID Connect Core section 12.2)
+	return issueIDToken(env, tokens, user, "")
+}
+
+// issueIDToken : Add an ID token for user to tokens, when the openid scope is granted
+func issueIDToken(env *models.Env, tokens *models.OAuthTokens, user *models.User, nonce string) (*models.OAuthTokens, *models.OAuthErrorResponse) {
+
+	if !utils.IsStringIn(models.OIDCScopeOpenID, tokens.Scopes) {
+		return tokens, nil
+	}
+
+	idToken, err := env.OAuth.SignIDToken(tokens, user, nonce)
+
+	if err != nil {
+		log.Printf("Could not sign ID token for client %s : %v", tokens.Grant.ClientID, err)
+		return nil, &models.OAuthErrorResponse{Error: models.OAuthErrorServerError}
+	}
+
+	tokens.IDToken = idToken
+
+	return tokens, nil
+}
+
+// introspectOAuthToken : Describe an active access or refresh token
+func introspectOAuthToken(env *models.Env, token string) *models.OAuthIntrospection {
+
+	if claims, err := env.OAuth.ParseAccessToken(token); err == nil {
+
+		if active, err := env.OAuth.AccessTokenActive(claims); err != nil || !active {
+			return &models.OAuthIntrospection{Active: false}
+		}
+
+		return &models.OAuthIntrospection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Subject:   claims.Subject,
+			TokenType: models.OAuthTokenTypeBearer,
+			ExpiresAt: claims.ExpiresAt,
+			IssuedAt:  claims.IssuedAt,
+			Issuer:    claims.Issuer,
+			Audience:  claims.Audience,
+			ID:        claims.ID,
+		}
+	}
+
+	if grant, err := env.OAuth.ReadRefreshTokenGrant(token); err == nil {
+
+		return &models.OAuthIntrospection{
+			Active:    true,
+			Scope:     strings.Join(grant.Scopes, " "),
+			ClientID:  grant.ClientID,
+			Subject:   grant.UserID,
+			TokenType: models.OAuthTokenTypeRefreshToken,
+			Issuer:    env.Config.OAuth.Issuer,
+		}
+	}
+
+	return &models.OAuthIntrospection{Active: false}
+}
+
+// authenticateOAuthClient : Authenticate client from HTTP Basic credentials (RFC 6749 section 2.3.1), or else
+// from the client_id & client_secret form parameters. Public clients only give their ID
+func authenticateOAuthClient(env *models.Env, r *http.Request) (*models.OAuthClient, error) {
+
+	clientID, clientSecret, basic := r.BasicAuth()
+
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	client, err := env.GORM.ReadOAuthClientFromID(clientID)
+
+	if err != nil {
+		return nil, errInvalidOAuthClient
+	}
+
+	if client.Public {
+
+		if clientSecret != "" {
+			return nil, errInvalidOAuthClient
+		}
+
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.TokenDigest(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, errInvalidOAuthClient
+	}
+
+	return client, nil
+}
+
+// newOAuthTokenResponse : Token endpoint response of tokens
+func newOAuthTokenResponse(tokens *models.OAuthTokens) *models.OAuthTokenResponse {
+
+	return &models.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    models.OAuthTokenTypeBearer,
+		ExpiresIn:    int(tokens.AccessTokenExpiration / time.Second),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        strings.Join(tokens.Scopes, " "),
+		IDToken:      tokens.IDToken,
+	}
+}
+
+// grantableScopes : Scopes user can grant, permissions being limited to the ones of the user role
+func grantableScopes(env *models.Env, user *models.User, scopes []string) []string {
+
+	grantable := []string{}
+
+	for _, scope := range scopes {
+
+		if !utils.IsStringIn(scope, models.Permissions) || env.Config.HasPermission(string(user.Role), scope) {
+			grantable = append(grantable, scope)
+		}
+	}
+
+	return grantable
+}
+
+// sessionAuthTime : When the user logged in the session of token, now if it cannot be told
+func sessionAuthTime(env *models.Env, userID string, token string) time.Time {
+
+	sessionID, err := env.Sessions.SessionID(token)
+
+	if err != nil {
+		return time.Now().UTC()
+	}
+
+	sessions, err := env.Sessions.ListUserSessions(userID)
+
+	if err != nil {
+		return time.Now().UTC()
+	}
+
+	for _, session := range sessions {
+
+		if session.ID == sessionID {
+			return session.CreatedAt
+		}
+	}
+
+	return time.Now().UTC()
+}
+
+// isSubset : Check wether all strings of subset are in set
+func isSubset(subset []string, set []string) bool {
+
+	for _, s := range subset {
+
+		if !utils.IsStringIn(s, set) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withQuery : URL with params added to its query
+func withQuery(rawURL string, params url.Values) string {
+
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+
+	for key, values := range params {
+		query[key] = values
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// redirectOAuth : Redirect the user agent to location
+func redirectOAuth(w http.ResponseWriter, r *http.Request, location string) (string, error) {
+
+	http.Redirect(w, r, location, http.StatusFound)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// writeOAuthError : Write an OAuth error response (RFC 6749 section 5.2)
+func writeOAuthError(w http.ResponseWriter, status int, code string, description string) (string, error) {
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(&models.OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+
+	return code, nil
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"vulnlabs-rest-api/models"
+	middlewares "vulnlabs-rest-api/router/middlewares"
+	"vulnlabs-rest-api/utils"
+)
+
+// ReadUserInfo : OpenID Connect userinfo endpoint (OpenID Connect Core section 5.3), authenticated by an OAuth access
+// token granted the openid scope. Released claims depend on the token scopes
+func ReadUserInfo(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	authorization := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(authorization, middlewares.BearerAuthorizationPrefix) {
+		return writeBearerError(w, http.StatusUnauthorized, "", "")
+	}
+
+	claims, err := env.OAuth.ParseAccessToken(strings.TrimSpace(strings.TrimPrefix(authorization, middlewares.BearerAuthorizationPrefix)))
+
+	if err != nil {
+		return writeBearerError(w, http.StatusUnauthorized, "invalid_token", "Invalid or expired access token")
+	}
+
+	active, err := env.OAuth.AccessTokenActive(claims)
+
+	if err != nil || !active {
+		return writeBearerError(w, http.StatusUnauthorized, "invalid_token", "Revoked access token")
+	}
+
+	scopes := claims.Scopes()
+
+	if !utils.IsStringIn(models.OIDCScopeOpenID, scopes) {
+		return writeBearerError(w, http.StatusForbidden, "insufficient_scope", "openid scope required")
+	}
+
+	user, err := env.GORM.ReadUserFromID(claims.Subject)
+
+	if err != nil || user.Disabled {
+		return writeBearerError(w, http.StatusUnauthorized, "invalid_token", "User cannot be authorized anymore")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	return writeRawJSON(w, &models.OIDCUserInfo{
+		Subject:        user.ID,
+		OIDCUserClaims: models.NewOIDCUserClaims(user, scopes),
+	})
+}
+
+// writeBearerError : Reject a request for its bearer token (RFC 6750 section 3)
+func writeBearerError(w http.ResponseWriter, status int, code string, description string) (string, error) {
+
+	challenge := `Bearer realm="oauth"`
+
+	if code != "" {
+		challenge += `, error="` + code + `", error_description=` + strconv.Quote(description)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(status)
+
+	return code, nil
+}
@@ -0,0 +1,215 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"vulnlabs-rest-api/auth"
+	"vulnlabs-rest-api/models"
+	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
+
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+// CreatePasswordReset : Email a password reset link to user.
+// Response is always successful not to disclose wether the email is registered
+func CreatePasswordReset(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Parse Request Body
+	var passwordResetRequest models.PasswordResetRequest
+	err := json.NewDecoder(r.Body).Decode(&passwordResetRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&passwordResetRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+
+	user, err := env.GORM.ReadUserFromEmail(passwordResetRequest.Email)
+
+	if err != nil {
+
+		if !env.GORM.IsRecordNotFoundError(err) {
+			log.Printf("Could not read user for password reset : %v", err)
+		}
+
+		customhttpresponse.WriteResponse(nil, responseDetails, w)
+		return customhttpresponse.CodeSuccess, nil
+	}
+
+	// Send email in background, so response time does not tell wether the user exists
+	go func() {
+
+		err := sendPasswordResetEmail(env, user)
+
+		if err != nil {
+			log.Printf("Could not send password reset email to user %s : %v", user.ID, err)
+		}
+	}()
+
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// ConfirmPasswordReset : Set new password from a password reset token, and revoke all user sessions
+func ConfirmPasswordReset(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Parse Request Body
+	var passwordResetConfirmRequest models.PasswordResetConfirmRequest
+	err := json.NewDecoder(r.Body).Decode(&passwordResetConfirmRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeInvalidJSON, err
+	}
+
+	err = validation.Validate(&passwordResetConfirmRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	resetStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisPasswordResetStoragePrefix, auth.TokenDigest(passwordResetConfirmRequest.Token), models.RedisPasswordResetUserIDSuffix)
+
+	userID, err := env.Redis.Get(resetStorageKey)
+
+	if err != nil || passwordResetConfirmRequest.Token == "" {
+		return customhttpresponse.CodeInvalidToken, errors.New("Invalid or expired password reset token")
+	}
+
+	user, err := env.GORM.ReadUserFromID(string(userID))
+
+	if err != nil {
+
+		if env.GORM.IsRecordNotFoundError(err) {
+			return customhttpresponse.CodeInvalidToken, err
+		}
+
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	err = auth.CheckPasswordPolicy("newPassword", passwordResetConfirmRequest.NewPassword, user.Email, user.FirstName, user.LastName)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	// Token is single use : read & deleted atomically, so that concurrent confirmations cannot both reset the password.
+	// It is only consumed once the new password is accepted, to be retried with another one otherwise
+	results, err := env.Redis.Multi([]models.RedisCommand{
+		models.RedisCommand{
+			Command: "GET",
+			Args:    []interface{}{resetStorageKey},
+		},
+		models.RedisCommand{
+			Command: "DEL",
+			Args:    []interface{}{resetStorageKey},
+		},
+	})
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	if consumedUserID, ok := results[0].([]byte); !ok || string(consumedUserID) != user.ID {
+		return customhttpresponse.CodeInvalidToken, errors.New("Invalid or expired password reset token")
+	}
+
+	// Hash new password
+	newHashedPassword, err := auth.HashPassword(passwordResetConfirmRequest.NewPassword)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Update password in DB
+	err = env.GORM.UpdateUserPassword(user, newHashedPassword)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Whoever knew the old password must be logged out
+	err = env.Sessions.DeleteUserSessions(user.ID, "")
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	// Identities linked while the email was unverified may belong to whoever claimed the address before its owner
+	if !user.EmailVerified {
+
+		err = env.GORM.DeleteUserExternalIdentities(user)
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+	}
+
+	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
+	customhttpresponse.WriteResponse(nil, responseDetails, w)
+
+	return customhttpresponse.CodeSuccess, nil
+}
+
+// sendPasswordResetEmail : Store a single-use reset token for user and email the reset link
+func sendPasswordResetEmail(env *models.Env, user *models.User) error {
+
+	token, err := auth.GenerateToken()
+
+	if err != nil {
+		return err
+	}
+
+	expiration := env.Config.PasswordReset.TokenExpiration()
+	resetStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisPasswordResetStoragePrefix, auth.TokenDigest(token), models.RedisPasswordResetUserIDSuffix)
+
+	err = env.Redis.SetWithExpiration(resetStorageKey, []byte(user.ID), int(expiration.Seconds()))
+
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenURL(env.Config.PasswordReset.URL, token)
+
+	if err != nil {
+		return err
+	}
+
+	return env.Mailer.Send(&models.MailMessage{
+		To:       []string{user.Email},
+		Subject:  "Reset your password",
+		Template: "password-reset",
+		Data: map[string]interface{}{
+			"FirstName":           user.FirstName,
+			"Link":                link,
+			"ExpirationInMinutes": int(expiration.Minutes()),
+		},
+	})
+}
+
+// tokenURL : Add token as "token" query parameter of the frontend page URL
+func tokenURL(pageURL string, token string) (string, error) {
+
+	u, err := url.Parse(pageURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
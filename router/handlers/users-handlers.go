@@ -8,6 +8,7 @@ import (
 	"vulnlabs-rest-api/models"
 	middlewares "vulnlabs-rest-api/router/middlewares"
 	"vulnlabs-rest-api/utils"
+	"vulnlabs-rest-api/validation"
 
 	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
 )
@@ -23,6 +24,18 @@ func CreateUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 		return customhttpresponse.CodeInvalidJSON, err
 	}
 
+	err = validation.Validate(&userCreateRequestBody)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	err = auth.CheckPasswordPolicy("password", userCreateRequestBody.Password, userCreateRequestBody.Email, userCreateRequestBody.FirstName, userCreateRequestBody.LastName)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
 	hashedPassword, err := auth.HashPassword(userCreateRequestBody.Password)
 
 	if err != nil {
@@ -44,6 +57,8 @@ func CreateUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 		return customhttpresponse.CodeInternalError, err
 	}
 
+	sendEmailVerificationEmailInBackground(env, user, user.Email)
+
 	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
 	customhttpresponse.WriteResponse(user.ID, responseDetails, w)
 
@@ -94,6 +109,24 @@ func UpdateUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 		return customhttpresponse.CodeInvalidJSON, err
 	}
 
+	err = validation.Validate(&userUpdateRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
+	// Email is a login & recovery credential : only changed from a session
+	if middlewares.IsDelegated(r) && userUpdateRequest.Email != "" && userUpdateRequest.Email != user.Email && userUpdateRequest.Email != user.PendingEmail {
+		return models.CodeForbidden, errors.New("Email can only be changed from a session of the user")
+	}
+
+	// New email only replaces the current one once verified
+	pendingEmail, statusCode, err := stageEmailChange(env, user, &userUpdateRequest)
+
+	if err != nil {
+		return statusCode, err
+	}
+
 	// Update user in DB
 	err = env.GORM.UpdateUserInfos(user, &userUpdateRequest)
 
@@ -101,6 +134,10 @@ func UpdateUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 		return customhttpresponse.CodeInternalError, err
 	}
 
+	if pendingEmail != "" {
+		sendEmailVerificationEmailInBackground(env, user, pendingEmail)
+	}
+
 	responseDetails := customhttpresponse.NewResponseDetails(env.Config.Service, utils.GetCurrentFuncName(), customhttpresponse.CodeSuccess)
 	customhttpresponse.WriteResponse(user, responseDetails, w)
 
@@ -120,6 +157,12 @@ func UpdateUserPassword(env *models.Env, w http.ResponseWriter, r *http.Request)
 		return customhttpresponse.CodeInvalidJSON, err
 	}
 
+	err = validation.Validate(&changePasswordRequest)
+
+	if err != nil {
+		return customhttpresponse.CodeValidationFailed, err
+	}
+
 	// Check current password
 	user, err := env.GORM.ReadUserFromID(userID)
 
@@ -135,6 +178,12 @@ func UpdateUserPassword(env *models.Env, w http.ResponseWriter, r *http.Request)
 	// user.Password represents the hashed pasword from DB
 	if auth.CheckPasswordHash(changePasswordRequest.OldPassword, user.Password) {
 
+		err = auth.CheckPasswordPolicy("newPassword", changePasswordRequest.NewPassword, user.Email, user.FirstName, user.LastName)
+
+		if err != nil {
+			return customhttpresponse.CodeValidationFailed, err
+		}
+
 		// Hash new password
 		newHashedPassword, err := auth.HashPassword(changePasswordRequest.NewPassword)
 
@@ -143,7 +192,20 @@ func UpdateUserPassword(env *models.Env, w http.ResponseWriter, r *http.Request)
 		}
 
 		// Update password in DB
-		err = env.GORM.UpdateUserPassword(newHashedPassword)
+		err = env.GORM.UpdateUserPassword(user, newHashedPassword)
+
+		if err != nil {
+			return customhttpresponse.CodeInternalError, err
+		}
+
+		// Sessions opened with the old password must not survive its rotation
+		keptSessionID := ""
+
+		if !changePasswordRequest.RevokeCurrentSession {
+			keptSessionID, _ = currentSessionID(env, r)
+		}
+
+		err = env.Sessions.DeleteUserSessions(user.ID, keptSessionID)
 
 		if err != nil {
 			return customhttpresponse.CodeInternalError, err
@@ -176,7 +238,7 @@ func DeleteUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 	}
 
 	// Delete user from DB
-	err = env.GORM.DeleteUser(user)
+	err = deleteUserAccount(env, user)
 
 	if err != nil {
 		return customhttpresponse.CodeInternalError, err
@@ -187,3 +249,33 @@ func DeleteUser(env *models.Env, w http.ResponseWriter, r *http.Request) (string
 
 	return customhttpresponse.CodeSuccess, nil
 }
+
+// deleteUserAccount : Revoke user sessions, then delete user, its recovery codes, API keys & external identities from DB
+func deleteUserAccount(env *models.Env, user *models.User) error {
+
+	err := env.Sessions.DeleteUserSessions(user.ID, "")
+
+	if err != nil {
+		return err
+	}
+
+	err = env.GORM.ReplaceRecoveryCodes(user, nil)
+
+	if err != nil {
+		return err
+	}
+
+	err = env.GORM.DeleteUserAPIKeys(user)
+
+	if err != nil {
+		return err
+	}
+
+	err = env.GORM.DeleteUserExternalIdentities(user)
+
+	if err != nil {
+		return err
+	}
+
+	return env.GORM.DeleteUser(user)
+}
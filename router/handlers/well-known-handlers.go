@@ -0,0 +1,51 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"vulnlabs-rest-api/models"
+
+	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
+)
+
+const (
+	// Verifiers refetch the key set at this interval : new keys must be published this long before being activated
+	jwksCacheMaxAgeInSeconds = 300
+)
+
+// ReadJWKS : Publish the public keys verifying issued tokens, as a standard JWK set (not wrapped in response details)
+func ReadJWKS(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(jwksCacheMaxAgeInSeconds))
+
+	return writeRawJSON(w, env.KeyRing.JWKS())
+}
+
+// ReadOpenIDConfiguration : Publish the OpenID provider metadata (not wrapped in response details)
+func ReadOpenIDConfiguration(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	signingKey, err := env.KeyRing.SigningKey()
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(jwksCacheMaxAgeInSeconds))
+
+	return writeRawJSON(w, models.NewOpenIDConfiguration(env.Config.OAuth, signingKey.Algorithm))
+}
+
+// writeRawJSON : Write body as is, for standard documents whose format is imposed to clients
+func writeRawJSON(w http.ResponseWriter, body interface{}) (string, error) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(body)
+
+	if err != nil {
+		return customhttpresponse.CodeInternalError, err
+	}
+
+	return customhttpresponse.CodeSuccess, nil
+}
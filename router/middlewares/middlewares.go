@@ -1,9 +1,14 @@
 package router
 
 import (
+	subtle "crypto/subtle"
 	errors "errors"
-	"fmt"
+	fmt "fmt"
+	log "log"
 	http "net/http"
+	strings "strings"
+	time "time"
+	auth "vulnlabs-rest-api/auth"
 	models "vulnlabs-rest-api/models"
 
 	customhttpresponse "github.com/terryvogelsang/go-custom-http-response"
@@ -15,12 +20,47 @@ type (
 
 const (
 	ContextUserKey ContextKey = "userID"
+
+	// ContextAPIKeyScopesKey : Scopes (models.APIKeyScopes) of the API key or OAuth access token authenticating the request, unset for sessions
+	ContextAPIKeyScopesKey ContextKey = "apiKeyScopes"
+
+	// BearerAuthorizationPrefix : Prefix of the Authorization header carrying an API key or a session token
+	BearerAuthorizationPrefix = "Bearer "
+
+	// SessionCookieName : Cookie carrying the session token
+	SessionCookieName = "session"
+
+	// RefreshCookieName : Cookie carrying the refresh token of session stores issuing one, only sent to the session route
+	RefreshCookieName = "refresh"
+
+	// CSRFHeaderName : Header carrying the CSRF token, whose value is also readable from the CSRFCookieName cookie
+	CSRFHeaderName = "X-CSRF-Token"
+	CSRFCookieName = "csrf"
 )
 
 var (
 	serviceVersion   = "/v1"
 	userRoute        = serviceVersion + "/user"
 	authSessionRoute = serviceVersion + "/auth/session"
+	authMFARoute     = authSessionRoute + "/mfa"
+
+	authFederationRoute         = serviceVersion + "/auth/federation"
+	authFederationLoginRoute    = authFederationRoute + "/login"
+	authFederationCallbackRoute = authFederationRoute + "/callback"
+
+	authPasswordResetRoute        = serviceVersion + "/auth/password-reset"
+	authPasswordResetConfirmRoute = authPasswordResetRoute + "/confirm"
+
+	userEmailVerificationConfirmRoute = userRoute + "/email/verification/confirm"
+
+	wellKnownJWKSRoute                = "/.well-known/jwks.json"
+	wellKnownOpenIDConfigurationRoute = "/.well-known/openid-configuration"
+
+	oauthAuthorizeRoute  = "/oauth/authorize"
+	oauthTokenRoute      = "/oauth/token"
+	oauthIntrospectRoute = "/oauth/introspect"
+	oauthRevokeRoute     = "/oauth/revoke"
+	oauthUserInfoRoute   = "/oauth/userinfo"
 
 	// These routes are publicly accessible without authentication
 	unauthenticatedRoutes = map[string]map[string]bool{
@@ -31,14 +71,111 @@ var (
 		},
 
 		// POST /v1/auth/session (Create session - Login)
+		// PUT /v1/auth/session (Refresh session, authenticated by its refresh token)
 		authSessionRoute: map[string]bool{
 			http.MethodPost: true, // Create session (LOGIN)
+			http.MethodPut:  true,
+		},
+
+		// POST /v1/auth/session/mfa (Complete login with second factor)
+		authMFARoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// GET /v1/auth/federation (External identity providers)
+		authFederationRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// GET /v1/auth/federation/login (Redirect to an external identity provider)
+		authFederationLoginRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// GET /v1/auth/federation/callback (Redirect back from an external identity provider)
+		authFederationCallbackRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// POST /v1/auth/password-reset (Request password reset email)
+		authPasswordResetRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// POST /v1/auth/password-reset/confirm (Set new password from reset token)
+		authPasswordResetConfirmRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// POST /v1/user/email/verification/confirm (Verify email from emailed token)
+		userEmailVerificationConfirmRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// GET /.well-known/jwks.json (Public keys verifying issued tokens)
+		wellKnownJWKSRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// GET /.well-known/openid-configuration (OpenID provider metadata)
+		wellKnownOpenIDConfigurationRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// GET /oauth/authorize (Authorization endpoint, redirecting to login when there is no session)
+		oauthAuthorizeRoute: map[string]bool{
+			http.MethodGet: true,
+		},
+
+		// POST /oauth/token, /oauth/introspect & /oauth/revoke (Authenticated by client credentials)
+		oauthTokenRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+		oauthIntrospectRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+		oauthRevokeRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// GET & POST /oauth/userinfo (Authenticated by an OAuth access token only)
+		oauthUserInfoRoute: map[string]bool{
+			http.MethodGet:  true,
+			http.MethodPost: true,
+		},
+	}
+
+	// These routes accept mutations without CSRF token
+	csrfExemptRoutes = map[string]map[string]bool{
+
+		// OAuth client endpoints, authenticated by client credentials
+		oauthTokenRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+		oauthIntrospectRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+		oauthRevokeRoute: map[string]bool{
+			http.MethodPost: true,
+		},
+
+		// Userinfo ignores cookies
+		oauthUserInfoRoute: map[string]bool{
+			http.MethodPost: true,
 		},
 	}
+
+	// Methods that never mutate state and are not CSRF checked
+	csrfSafeMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+	}
 )
 
-// AuthMiddleware : Check session token
-func AuthMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+// AuthMiddleware : Check API key, OAuth access token or session token of the Authorization header, or else session cookie.
+// Returns the authenticated user ID, and the granted scopes for API key & OAuth authenticated requests
+func AuthMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request) (string, models.APIKeyScopes, error) {
 
 	// Get request path and request method
 	reqPath := r.URL.Path
@@ -47,49 +184,280 @@ func AuthMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request) (st
 	// If route is whitelisted, check method. If it matches, don't do the authentication check and immediately forward the request
 	if unauthenticatedRoutes[reqPath] != nil {
 		if unauthenticatedRoutes[reqPath][reqMethod] {
-			return "", nil
+			return "", nil, nil
 		}
 	}
 
-	// Get token from cookies
-	c, err := r.Cookie("session")
+	// Machine-to-machine requests
+	if isBearerAuthenticated(r) {
+
+		if _, ok := auth.APIKeyPrefixOf(bearerToken(r)); ok {
+			return apiKeyAuthentication(env, r)
+		}
+
+		if claims, err := env.OAuth.ParseAccessToken(bearerToken(r)); err == nil {
+			return oauthAuthentication(env, claims)
+		}
+	}
+
+	t, err := SessionToken(r)
 
 	// If no token, but authentication is needed, don't forward the request
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	t := c.Value
+	// Get associated UserID
+	userID, err := env.Sessions.ReadSessionUserID(t)
 
-	if t == "" {
-		return "", errors.New("Empty session string")
+	if err != nil {
+		return "", nil, err
 	}
 
-	sessionStorageKey := fmt.Sprintf("%s:%s:%s", models.RedisSessionStoragePrefix, t, models.RedisSessionStorageUserIDSuffix)
+	// Slide idle expiration & record activity for the session listing
+	expiration, refreshed, err := env.Sessions.RefreshSession(userID, t)
 
-	// Get associated UserID
-	userID, err := env.Redis.Get(sessionStorageKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Keep cookie expiration in sync with the session one
+	if refreshed && !isBearerAuthenticated(r) {
+		SetSessionCookie(w, t, expiration)
+	}
+
+	return userID, nil, nil
+}
+
+// isBearerAuthenticated : Check wether request carries an Authorization: Bearer header
+func isBearerAuthenticated(r *http.Request) bool {
+
+	return strings.HasPrefix(r.Header.Get("Authorization"), BearerAuthorizationPrefix)
+}
+
+// bearerToken : Token of the Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), BearerAuthorizationPrefix))
+}
+
+// SessionToken : Session token of the Authorization: Bearer header, or else of the session cookie
+func SessionToken(r *http.Request) (string, error) {
+
+	if isBearerAuthenticated(r) {
+
+		if token := bearerToken(r); token != "" {
+			return token, nil
+		}
+
+		return "", errors.New("Empty bearer token")
+	}
+
+	c, err := r.Cookie(SessionCookieName)
 
 	if err != nil {
 		return "", err
 	}
 
-	return string(userID), nil
+	if c.Value == "" {
+		return "", errors.New("Empty session string")
+	}
+
+	return c.Value, nil
 }
 
-// SessionExistsInStorage : Check if session exists in Redis
+// apiKeyAuthentication : Authenticate request from the API key of its Authorization header
+func apiKeyAuthentication(env *models.Env, r *http.Request) (string, models.APIKeyScopes, error) {
+
+	key := bearerToken(r)
+	prefix, ok := auth.APIKeyPrefixOf(key)
+
+	if !ok {
+		return "", nil, errors.New("Malformed API key")
+	}
+
+	apiKey, err := env.GORM.ReadAPIKeyFromPrefix(prefix)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(auth.TokenDigest(key))) != 1 {
+		return "", nil, errors.New("Invalid API key")
+	}
+
+	now := time.Now()
+
+	if apiKey.Expired(now) {
+		return "", nil, errors.New("Expired API key")
+	}
+
+	// Keys of disabled users must stop working too
+	user, err := env.GORM.ReadUserFromID(apiKey.UserID)
+
+	if err != nil || user.Disabled {
+		return "", nil, errors.New("Invalid API key")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= models.APIKeyLastUsedThrottle {
+
+		err = env.GORM.UpdateAPIKeyLastUsed(apiKey, now)
+
+		if err != nil {
+			log.Printf("Could not record last use of API key %s : %v", apiKey.ID, err)
+		}
+	}
+
+	// Non nil scopes tell the request is API key authenticated, even without scope
+	scopes := apiKey.Scopes
+
+	if scopes == nil {
+		scopes = models.APIKeyScopes{}
+	}
+
+	return apiKey.UserID, scopes, nil
+}
+
+// oauthAuthentication : Authenticate request from the OAuth access token of claims
+func oauthAuthentication(env *models.Env, claims *models.OAuthAccessTokenClaims) (string, models.APIKeyScopes, error) {
+
+	active, err := env.OAuth.AccessTokenActive(claims)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !active {
+		return "", nil, errors.New("Revoked access token")
+	}
+
+	// Tokens of disabled users must stop working too
+	user, err := env.GORM.ReadUserFromID(claims.Subject)
+
+	if err != nil || user.Disabled {
+		return "", nil, errors.New("Invalid access token")
+	}
+
+	// Scopes are never nil, telling the request is OAuth authenticated even without scope
+	return user.ID, models.APIKeyScopes(claims.Scopes()), nil
+}
+
+// SetSessionCookie : Set session & CSRF cookies to response, expiring after expiration
+func SetSessionCookie(w http.ResponseWriter, sessionToken string, expiration time.Duration) {
+
+	tokenCookie := http.Cookie{
+
+		// __Host cookie prefix signals to the browser that both the Path=/
+		// and Secure attributes are required, and at the same time
+		// + that the Domain attribute must not be present.
+		// see https://resources.infosecinstitute.com/cookies-httponly-flag-problem-browsers
+		// TO DO : Change this to __Host-session
+		Name: SessionCookieName,
+
+		// Path set to root
+		Path: "/",
+
+		// TODO : Uncomment this
+		// Only transmit on encrypted connection
+		// Secure: true,
+
+		// Cannot be accessed by JavaScript
+		HttpOnly: true,
+
+		// Prevents cookie from being attached to cross-origin requests
+		SameSite: http.SameSiteStrictMode,
+
+		// Actual value of cookie
+		Value: sessionToken,
+
+		// Set Expiration cookie client side (IE Browser will treat this cookie as a session cookie [Expires when closing tab])
+		MaxAge: int(expiration / time.Second),
+	}
+
+	// Set cookie to response
+	http.SetCookie(w, &tokenCookie)
+
+	// Double-submit CSRF cookie : readable by the frontend to fill the CSRF header
+	csrfCookie := http.Cookie{
+		Name:     CSRFCookieName,
+		Path:     "/",
+		HttpOnly: false,
+		SameSite: http.SameSiteStrictMode,
+		Value:    auth.CSRFToken(sessionToken),
+		MaxAge:   int(expiration / time.Second),
+	}
+
+	http.SetCookie(w, &csrfCookie)
+}
+
+// SetSessionCookies : Set session, CSRF & refresh cookies of credentials to response
+func SetSessionCookies(w http.ResponseWriter, credentials *models.SessionCredentials) {
+
+	SetSessionCookie(w, credentials.Token, credentials.TokenExpiration)
+
+	if credentials.RefreshToken == "" {
+		return
+	}
+
+	refreshCookie := http.Cookie{
+		Name: RefreshCookieName,
+
+		// Only attached to session refresh & logout requests
+		Path: authSessionRoute,
+
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Value:    credentials.RefreshToken,
+		MaxAge:   int(credentials.RefreshTokenExpiration / time.Second),
+	}
+
+	http.SetCookie(w, &refreshCookie)
+}
+
+// CSRFMiddleware : Check CSRF token header of state changing requests authenticated by the session cookie
+func CSRFMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	// Get request path and request method
+	reqPath := r.URL.Path
+	reqMethod := r.Method
+
+	if csrfSafeMethods[reqMethod] {
+		return "", nil
+	}
+
+	if csrfExemptRoutes[reqPath] != nil {
+		if csrfExemptRoutes[reqPath][reqMethod] {
+			return "", nil
+		}
+	}
+
+	// Bearer authenticated requests cannot be forged cross-site : browsers do not attach the Authorization header
+	if isBearerAuthenticated(r) {
+		return "", nil
+	}
+
+	// Only cookie-authenticated requests can be forged cross-site
+	c, err := r.Cookie(SessionCookieName)
+
+	if err != nil || c.Value == "" {
+		return "", nil
+	}
+
+	if !auth.CheckCSRFToken(c.Value, r.Header.Get(CSRFHeaderName)) {
+		return models.CodeInvalidCSRFToken, errors.New("Missing or invalid CSRF token")
+	}
+
+	return "", nil
+}
+
+// SessionExistsInStorage : Check if session exists in session store
 func SessionExistsInStorage(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
 
-	// Get token from cookies
-	c, err := r.Cookie("session")
+	token, err := SessionToken(r)
 
 	// If no token, but authentication is needed, don't forward the request
 	if err != nil {
 		return "", err
 	}
 
-	// Check if key exists in Redis
-	_, err = env.Redis.Exists(c.Value)
+	// Check if session exists in store
+	_, err = env.Sessions.ReadSessionUserID(token)
 
 	if err != nil {
 		return customhttpresponse.CodeDoesNotExist, err
@@ -97,3 +465,60 @@ func SessionExistsInStorage(env *models.Env, w http.ResponseWriter, r *http.Requ
 
 	return "", nil
 }
+
+// IsDelegated : Check wether request is authenticated by an API key or an OAuth access token rather than a session
+func IsDelegated(r *http.Request) bool {
+
+	_, scoped := r.Context().Value(ContextAPIKeyScopesKey).(models.APIKeyScopes)
+
+	return scoped
+}
+
+// RequireSession : Reject requests authenticated by an API key or an OAuth access token.
+// Declared on routes managing credentials, which delegated credentials must never reach whatever their scopes
+func RequireSession(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	if IsDelegated(r) {
+		return models.CodeForbidden, errors.New("Only available to sessions, not to API keys nor OAuth access tokens")
+	}
+
+	return "", nil
+}
+
+// RequirePermissions : Return a middleware rejecting requests of users whose role lacks one of permissions.
+// Declared through handlers.CustomHandleWithPermissions, outside of which API keys & OAuth access tokens are rejected
+func RequirePermissions(permissions ...string) func(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	return func(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+		userID, _ := r.Context().Value(ContextUserKey).(string)
+
+		// Load caller role
+		user, err := env.GORM.ReadUserFromID(userID)
+
+		if err != nil {
+
+			if env.GORM.IsRecordNotFoundError(err) {
+				return customhttpresponse.CodeInvalidToken, err
+			}
+
+			return customhttpresponse.CodeInternalError, err
+		}
+
+		// API keys & OAuth access tokens are restricted to their scopes
+		scopes, scoped := r.Context().Value(ContextAPIKeyScopesKey).(models.APIKeyScopes)
+
+		for _, permission := range permissions {
+
+			if !env.Config.HasPermission(string(user.Role), permission) {
+				return models.CodeForbidden, fmt.Errorf("Permission %s required", permission)
+			}
+
+			if scoped && !scopes.Allow(permission) {
+				return models.CodeForbidden, fmt.Errorf("Scope %s required", permission)
+			}
+		}
+
+		return "", nil
+	}
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	errors "errors"
+	log "log"
+	math "math"
+	http "net/http"
+	strconv "strconv"
+	models "vulnlabs-rest-api/models"
+	utils "vulnlabs-rest-api/utils"
+)
+
+const (
+	// Rate limit headers, as in the IETF RateLimit header fields draft
+	RateLimitLimitHeaderName     = "RateLimit-Limit"
+	RateLimitRemainingHeaderName = "RateLimit-Remaining"
+	RateLimitResetHeaderName     = "RateLimit-Reset"
+)
+
+// IPRateLimitMiddleware : Apply the global rate limit to requests of the client IP, before authentication so that
+// requests failing authentication are limited too
+func IPRateLimitMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	if env.Config.RateLimiting.Disabled {
+		return "", nil
+	}
+
+	return hitRateLimit(env, w, r, "", "global", env.Config.RateLimiting.GlobalLimit())
+}
+
+// RateLimitMiddleware : Apply the global rate limit to requests of the authenticated userID, unless limited per IP only
+func RateLimitMiddleware(env *models.Env, w http.ResponseWriter, r *http.Request, userID string) (string, error) {
+
+	limit := env.Config.RateLimiting.GlobalLimit()
+
+	if env.Config.RateLimiting.Disabled || userID == "" || limit.By == models.RateLimitByIP {
+		return "", nil
+	}
+
+	return hitRateLimit(env, w, r, userID, "global", limit)
+}
+
+// RateLimit : Return a middleware applying the route rate limit, declared limit being overridable in config.
+// To be declared first in the CustomHandle chain of the route
+func RateLimit(route string, limit models.RateLimit) func(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+	return func(env *models.Env, w http.ResponseWriter, r *http.Request) (string, error) {
+
+		if env.Config.RateLimiting.Disabled {
+			return "", nil
+		}
+
+		userID, _ := r.Context().Value(ContextUserKey).(string)
+
+		return hitRateLimit(env, w, r, userID, "route:"+route, env.Config.RateLimiting.RouteLimit(route, limit))
+	}
+}
+
+// hitRateLimit : Count request against limit, in the name counter of the client
+func hitRateLimit(env *models.Env, w http.ResponseWriter, r *http.Request, userID string, name string, limit models.RateLimit) (string, error) {
+
+	if !limit.Enabled() {
+		return "", nil
+	}
+
+	key := name + ":ip:" + utils.GetRequestIP(r)
+
+	if limit.By != models.RateLimitByIP && userID != "" {
+		key = name + ":user:" + userID
+	}
+
+	result, err := env.RateLimiter.Hit(key, limit)
+
+	// Rate limiting must not take the API down
+	if err != nil {
+		log.Printf("Could not apply rate limit %s : %v", name, err)
+		return "", nil
+	}
+
+	setRateLimitHeaders(w, result)
+
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(resetSeconds(result)))
+		return models.CodeRateLimited, errors.New("Too many requests, retry later")
+	}
+
+	return "", nil
+}
+
+// setRateLimitHeaders : Describe the most restrictive of the limits applied to the request
+func setRateLimitHeaders(w http.ResponseWriter, result *models.RateLimitResult) {
+
+	if remaining := w.Header().Get(RateLimitRemainingHeaderName); remaining != "" {
+
+		if current, err := strconv.Atoi(remaining); err == nil && current <= result.Remaining {
+			return
+		}
+	}
+
+	w.Header().Set(RateLimitLimitHeaderName, strconv.Itoa(result.Limit))
+	w.Header().Set(RateLimitRemainingHeaderName, strconv.Itoa(result.Remaining))
+	w.Header().Set(RateLimitResetHeaderName, strconv.Itoa(resetSeconds(result)))
+}
+
+// resetSeconds : Whole seconds until the limit window resets
+func resetSeconds(result *models.RateLimitResult) int {
+
+	return int(math.Ceil(result.Reset.Seconds()))
+}
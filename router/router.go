@@ -24,30 +24,104 @@ func Listen(env *models.Env) {
 
 	r := mux.NewRouter().StrictSlash(false)
 
+	// Routes rate limits, overridable by name in config
+	signupRateLimit := models.RateLimit{Requests: 5, WindowInSeconds: 3600, By: models.RateLimitByIP}
+	loginRateLimit := models.RateLimit{Requests: 10, WindowInSeconds: 60, By: models.RateLimitByIP}
+	emailRateLimit := models.RateLimit{Requests: 5, WindowInSeconds: 3600, By: models.RateLimitByIP}
+	tokenRateLimit := models.RateLimit{Requests: 10, WindowInSeconds: 60, By: models.RateLimitByIP}
+	oauthTokenRateLimit := models.RateLimit{Requests: 60, WindowInSeconds: 60, By: models.RateLimitByIP}
+
+	// Well-known metadata, unversioned
+	wellKnown := r.PathPrefix("/.well-known").Subrouter()
+	wellKnown.Handle("/jwks.json", handlers.CustomHandle(env, handlers.ReadJWKS)).Methods("GET")
+	wellKnown.Handle("/openid-configuration", handlers.CustomHandle(env, handlers.ReadOpenIDConfiguration)).Methods("GET")
+
+	// OAuth authorization server, unversioned as its endpoints are registered by clients
+	oauth := r.PathPrefix("/oauth").Subrouter()
+	oauth.Handle("/authorize", handlers.CustomHandle(env, handlers.Authorize)).Methods("GET")
+	oauth.Handle("/authorize", handlers.CustomHandle(env, middlewares.RequireSession, handlers.ConsentOAuthAuthorization)).Methods("POST")
+	oauth.Handle("/token", handlers.CustomHandle(env, middlewares.RateLimit("createOAuthToken", oauthTokenRateLimit), handlers.CreateOAuthToken)).Methods("POST")
+	oauth.Handle("/introspect", handlers.CustomHandle(env, handlers.IntrospectOAuthToken)).Methods("POST")
+	oauth.Handle("/revoke", handlers.CustomHandle(env, handlers.RevokeOAuthToken)).Methods("POST")
+	oauth.Handle("/userinfo", handlers.CustomHandle(env, handlers.ReadUserInfo)).Methods("GET", "POST")
+	oauth.Handle("/clients/{id}", handlers.CustomHandle(env, handlers.ReadOAuthClientInfo)).Methods("GET")
+
 	v1 := r.PathPrefix("/v1").Subrouter()
 
-	// API Endpoints
+	// API Endpoints. API keys & OAuth access tokens only reach those requiring permissions granted by their scopes :
+	// self-service ones require account permissions, while those managing credentials require a session
 
 	// User
 	userV1 := v1.PathPrefix("/user").Subrouter()
-	userV1.Handle("", handlers.CustomHandle(env, handlers.CreateUser)).Methods("POST")
-	userV1.Handle("", handlers.CustomHandle(env, handlers.ReadUser)).Methods("GET")
-	userV1.Handle("", handlers.CustomHandle(env, handlers.UpdateUser)).Methods("PUT")
-	userV1.Handle("", handlers.CustomHandle(env, handlers.DeleteUser)).Methods("DELETE")
-	userV1.Handle("/password", handlers.CustomHandle(env, handlers.UpdateUserPassword)).Methods("PUT")
+	userV1.Handle("", handlers.CustomHandle(env, middlewares.RateLimit("createUser", signupRateLimit), handlers.CreateUser)).Methods("POST")
+	userV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountRead}, handlers.ReadUser)).Methods("GET")
+	userV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountWrite}, handlers.UpdateUser)).Methods("PUT")
+	userV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DeleteUser)).Methods("DELETE")
+	userV1.Handle("/password", handlers.CustomHandle(env, middlewares.RequireSession, handlers.UpdateUserPassword)).Methods("PUT")
+	userV1.Handle("/email/verification", handlers.CustomHandle(env, middlewares.RequireSession, middlewares.RateLimit("createEmailVerification", emailRateLimit), handlers.CreateEmailVerification)).Methods("POST")
+	userV1.Handle("/email/verification/confirm", handlers.CustomHandle(env, middlewares.RateLimit("confirmEmailVerification", tokenRateLimit), handlers.ConfirmEmailVerification)).Methods("POST")
+
+	// User API keys
+	userAPIKeysV1 := userV1.PathPrefix("/api-keys").Subrouter()
+	userAPIKeysV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountRead}, handlers.ReadAPIKeys)).Methods("GET")
+	userAPIKeysV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.CreateAPIKey)).Methods("POST")
+	userAPIKeysV1.Handle("/{id}", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DeleteAPIKey)).Methods("DELETE")
+
+	// User external identities
+	userIdentitiesV1 := userV1.PathPrefix("/identities").Subrouter()
+	userIdentitiesV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountRead}, handlers.ReadExternalIdentities)).Methods("GET")
+	userIdentitiesV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.LinkExternalIdentity)).Methods("POST")
+	userIdentitiesV1.Handle("/{id}", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DeleteExternalIdentity)).Methods("DELETE")
+
+	// User MFA
+	userMFAV1 := userV1.PathPrefix("/mfa").Subrouter()
+	userMFAV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.EnrollMFA)).Methods("POST")
+	userMFAV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DisableMFA)).Methods("DELETE")
+	userMFAV1.Handle("/confirm", handlers.CustomHandle(env, middlewares.RequireSession, handlers.ConfirmMFA)).Methods("POST")
+	userMFAV1.Handle("/recovery-codes", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountRead}, handlers.ReadRecoveryCodes)).Methods("GET")
+	userMFAV1.Handle("/recovery-codes", handlers.CustomHandle(env, middlewares.RequireSession, handlers.RegenerateRecoveryCodes)).Methods("POST")
 
 	// Auth
 	authV1 := v1.PathPrefix("/auth").Subrouter()
 	authSessionV1 := authV1.PathPrefix("/session").Subrouter()
-	authSessionV1.Handle("", handlers.CustomHandle(env, handlers.CreateSession)).Methods("POST")
+	authSessionV1.Handle("", handlers.CustomHandle(env, middlewares.RateLimit("createSession", loginRateLimit), handlers.CreateSession)).Methods("POST")
 	authSessionV1.Handle("", handlers.CustomHandle(env, handlers.UpdateSession)).Methods("PUT")
-	authSessionV1.Handle("", handlers.CustomHandle(env, middlewares.SessionExistsInStorage, handlers.DeleteSession)).Methods("DELETE")
+	authSessionV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, middlewares.SessionExistsInStorage, handlers.DeleteSession)).Methods("DELETE")
+	authSessionV1.Handle("/mfa", handlers.CustomHandle(env, middlewares.RateLimit("createMFASession", loginRateLimit), handlers.CreateMFASession)).Methods("POST")
+	authFederationV1 := authV1.PathPrefix("/federation").Subrouter()
+	authFederationV1.Handle("", handlers.CustomHandle(env, handlers.ReadIdentityProviders)).Methods("GET")
+	authFederationV1.Handle("/login", handlers.CustomHandle(env, middlewares.RateLimit("startFederatedLogin", loginRateLimit), handlers.StartFederatedLogin)).Methods("GET")
+	authFederationV1.Handle("/callback", handlers.CustomHandle(env, handlers.CompleteFederatedLogin)).Methods("GET")
+	authPasswordResetV1 := authV1.PathPrefix("/password-reset").Subrouter()
+	authPasswordResetV1.Handle("", handlers.CustomHandle(env, middlewares.RateLimit("createPasswordReset", emailRateLimit), handlers.CreatePasswordReset)).Methods("POST")
+	authPasswordResetV1.Handle("/confirm", handlers.CustomHandle(env, middlewares.RateLimit("confirmPasswordReset", tokenRateLimit), handlers.ConfirmPasswordReset)).Methods("POST")
+	authSessionsV1 := authV1.PathPrefix("/sessions").Subrouter()
+	authSessionsV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionAccountRead}, handlers.ReadSessions)).Methods("GET")
+	authSessionsV1.Handle("", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DeleteSessions)).Methods("DELETE")
+	authSessionsV1.Handle("/{id}", handlers.CustomHandle(env, middlewares.RequireSession, handlers.DeleteSessionFromID)).Methods("DELETE")
+
+	// Admin
+	adminV1 := v1.PathPrefix("/admin").Subrouter()
+	adminUsersV1 := adminV1.PathPrefix("/users").Subrouter()
+	adminUsersV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersRead}, handlers.AdminListUsers)).Methods("GET")
+	adminUsersV1.Handle("/{id}", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersRead}, handlers.AdminReadUser)).Methods("GET")
+	adminUsersV1.Handle("/{id}", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersWrite}, handlers.AdminUpdateUser)).Methods("PUT")
+	adminUsersV1.Handle("/{id}", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersDelete}, handlers.AdminDeleteUser)).Methods("DELETE")
+	adminUsersV1.Handle("/{id}/disable", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersWrite}, handlers.AdminDisableUser)).Methods("POST")
+	adminUsersV1.Handle("/{id}/enable", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersWrite}, handlers.AdminEnableUser)).Methods("POST")
+	adminUsersV1.Handle("/{id}/unlock", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersWrite}, handlers.AdminUnlockUser)).Methods("POST")
+	adminUsersV1.Handle("/{id}/sessions", handlers.CustomHandleWithPermissions(env, []string{models.PermissionUsersSessionsRevoke}, handlers.AdminDeleteUserSessions)).Methods("DELETE")
+	adminOAuthClientsV1 := adminV1.PathPrefix("/oauth-clients").Subrouter()
+	adminOAuthClientsV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionOAuthClientsRead}, handlers.AdminListOAuthClients)).Methods("GET")
+	adminOAuthClientsV1.Handle("", handlers.CustomHandleWithPermissions(env, []string{models.PermissionOAuthClientsWrite}, handlers.AdminCreateOAuthClient)).Methods("POST")
+	adminOAuthClientsV1.Handle("/{id}", handlers.CustomHandleWithPermissions(env, []string{models.PermissionOAuthClientsWrite}, handlers.AdminDeleteOAuthClient)).Methods("DELETE")
 
 	corsHandler := cors.New(cors.Options{
-		AllowedHeaders:   []string{"X-Requested-With"},
+		AllowedHeaders:   []string{"X-Requested-With", "Authorization", middlewares.CSRFHeaderName},
+		ExposedHeaders:   []string{"Retry-After", middlewares.RateLimitLimitHeaderName, middlewares.RateLimitRemainingHeaderName, middlewares.RateLimitResetHeaderName},
 		AllowedOrigins:   []string{"http://frontend.localhost"},
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"},
 	})
 
 	fmt.Println("Listening on port :" + fmt.Sprintf("%d", env.Config.ListeningPort))
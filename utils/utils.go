@@ -3,6 +3,8 @@ package utils
 import (
 	"crypto/rand"
 	"log"
+	"net"
+	"net/http"
 	"runtime"
 	"strings"
 )
@@ -49,3 +51,15 @@ func CaseInsensitiveContains(a string, b string) bool {
 		strings.ToLower(b),
 	)
 }
+
+// GetRequestIP : Return the client IP of the request (without port)
+func GetRequestIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,123 @@
+package validation
+
+import (
+	fmt "fmt"
+	mail "net/mail"
+	url "net/url"
+	reflect "reflect"
+	regexp "regexp"
+	strconv "strconv"
+	utf8 "unicode/utf8"
+)
+
+// Rule : Check value against rule parameter. Returns a message describing the failure
+type Rule func(value reflect.Value, param string) (string, bool)
+
+var (
+	// rules : Available rules, by tag name ("required" is handled by validateField)
+	rules = map[string]Rule{
+		"email": email,
+		"min":   minimum,
+		"max":   maximum,
+		"e164":  e164,
+		"url":   absoluteURL,
+	}
+
+	e164Regexp = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+)
+
+// email : Bare address, e.g. "user@example.com"
+func email(value reflect.Value, param string) (string, bool) {
+
+	address, err := mail.ParseAddress(value.String())
+
+	if err != nil || address.Address != value.String() || address.Name != "" {
+		return "must be a valid email address", false
+	}
+
+	return "", true
+}
+
+// minimum : Minimum length of strings, slices & maps, or minimum number
+func minimum(value reflect.Value, param string) (string, bool) {
+
+	limit, compared := compare(value, param)
+
+	if compared < limit {
+		return fmt.Sprintf("must be at least %s", describe(value, param)), false
+	}
+
+	return "", true
+}
+
+// maximum : Maximum length of strings, slices & maps, or maximum number
+func maximum(value reflect.Value, param string) (string, bool) {
+
+	limit, compared := compare(value, param)
+
+	if compared > limit {
+		return fmt.Sprintf("must be at most %s", describe(value, param)), false
+	}
+
+	return "", true
+}
+
+// e164 : International phone number, e.g. "+41791234567"
+func e164(value reflect.Value, param string) (string, bool) {
+
+	if !e164Regexp.MatchString(value.String()) {
+		return "must be an E.164 phone number", false
+	}
+
+	return "", true
+}
+
+// absoluteURL : Absolute http(s) URL
+func absoluteURL(value reflect.Value, param string) (string, bool) {
+
+	u, err := url.Parse(value.String())
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "must be an absolute http(s) URL", false
+	}
+
+	return "", true
+}
+
+// compare : Rule parameter & the value size it applies to (length in characters for strings)
+func compare(value reflect.Value, param string) (float64, float64) {
+
+	limit, err := strconv.ParseFloat(param, 64)
+
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid numeric parameter %s", param))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return limit, float64(utf8.RuneCountInString(value.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return limit, float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return limit, float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return limit, float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return limit, value.Float()
+	}
+
+	panic(fmt.Sprintf("validation: min/max not applicable to %s", value.Kind()))
+}
+
+// describe : Human readable limit
+func describe(value reflect.Value, param string) string {
+
+	switch value.Kind() {
+	case reflect.String:
+		return param + " characters long"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return param + " items long"
+	}
+
+	return param
+}
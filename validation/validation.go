@@ -0,0 +1,188 @@
+package validation
+
+import (
+	fmt "fmt"
+	reflect "reflect"
+	strings "strings"
+)
+
+// TagName : Struct tag holding the comma separated rules of a field, e.g. `validate:"required,email,max=254"`
+const TagName = "validate"
+
+// FieldError : Rule a request field does not comply with
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors : Validation errors of a request, at most one per field
+type Errors []FieldError
+
+// Error : Invalid fields, "|" separated
+func (errs Errors) Error() string {
+
+	return strings.Join(errs.Fields(), "|")
+}
+
+// Fields : Names of invalid fields
+func (errs Errors) Fields() []string {
+
+	fields := make([]string, 0, len(errs))
+
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+
+	return fields
+}
+
+// Add : Record field as invalid
+func (errs *Errors) Add(field string, rule string, message string) {
+
+	*errs = append(*errs, FieldError{
+		Field:   field,
+		Rule:    rule,
+		Message: message,
+	})
+}
+
+// ErrorOrNil : Errors as error, nil if there is none
+func (errs Errors) ErrorOrNil() error {
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// Validate : Check the fields of struct (or pointer to struct) v against their rules.
+// Fields are named after their json tag. Returns Errors if any field is invalid
+func Validate(v interface{}) error {
+
+	value := reflect.ValueOf(v)
+
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %T is not a struct", v))
+	}
+
+	errs := Errors{}
+	validateStruct(value, "", &errs)
+
+	return errs.ErrorOrNil()
+}
+
+// validateStruct : Validate fields of value, prefixing their names with path for nested structs
+func validateStruct(value reflect.Value, path string, errs *Errors) {
+
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+
+		// Unexported
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := fieldName(field)
+
+		if name == "-" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+
+		if err := validateField(fieldValue, field.Tag.Get(TagName)); err != nil {
+			err.Field = path + name
+			*errs = append(*errs, *err)
+			continue
+		}
+
+		// Nested requests
+		nested := reflect.Indirect(fieldValue)
+
+		if nested.Kind() == reflect.Struct && nested.Type().PkgPath() != "time" {
+			validateStruct(nested, path+name+".", errs)
+		}
+	}
+}
+
+// validateField : First rule of tag value does not comply with, if any.
+// Empty values only fail the "required" rule
+func validateField(value reflect.Value, tag string) *FieldError {
+
+	if tag == "" {
+		return nil
+	}
+
+	empty := isEmpty(value)
+
+	for _, rule := range strings.Split(tag, ",") {
+
+		name, param := rule, ""
+
+		if separator := strings.Index(rule, "="); separator >= 0 {
+			name, param = rule[:separator], rule[separator+1:]
+		}
+
+		if name == "required" {
+
+			if empty {
+				return &FieldError{Rule: name, Message: "is required"}
+			}
+
+			continue
+		}
+
+		if empty {
+			continue
+		}
+
+		check, ok := rules[name]
+
+		if !ok {
+			panic(fmt.Sprintf("validation: unknown rule %s", name))
+		}
+
+		if message, ok := check(reflect.Indirect(value), param); !ok {
+			return &FieldError{Rule: name, Param: param, Message: message}
+		}
+	}
+
+	return nil
+}
+
+// fieldName : Field name as found in request bodies
+func fieldName(field reflect.StructField) string {
+
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// isEmpty : Wether value is its type zero value (blank for strings)
+func isEmpty(value reflect.Value) bool {
+
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+
+	return reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
@@ -0,0 +1,136 @@
+package validation
+
+import (
+	reflect "reflect"
+	testing "testing"
+)
+
+type testAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"max=5"`
+}
+
+type testRequest struct {
+	Email    string       `json:"email" validate:"required,email"`
+	Name     *string      `json:"name" validate:"required,max=4"`
+	Phone    string       `json:"phone,omitempty" validate:"e164"`
+	Website  string       `json:"website" validate:"url"`
+	Nickname string       `json:"nickname" validate:"min=2,max=4"`
+	Count    int          `json:"count" validate:"max=10"`
+	Address  testAddress  `json:"address"`
+	Billing  *testAddress `json:"billing"`
+	Ignored  string       `json:"-" validate:"required"`
+}
+
+// validTestRequest : Request complying with every rule
+func validTestRequest() *testRequest {
+
+	name := "Ada"
+
+	return &testRequest{
+		Email:    "ada@vulnlabs.localhost",
+		Name:     &name,
+		Phone:    "+41791234567",
+		Website:  "https://vulnlabs.localhost/ada",
+		Nickname: "ada",
+		Count:    10,
+		Address:  testAddress{City: "Bern", Zip: "3000"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		mutate func(request *testRequest)
+		fields []string
+		rules  []string
+	}{
+		{"valid", func(request *testRequest) {}, nil, nil},
+		{"required empty", func(request *testRequest) { request.Email = "" }, []string{"email"}, []string{"required"}},
+		{"required blank", func(request *testRequest) { request.Email = "   " }, []string{"email"}, []string{"required"}},
+		{"optional empty", func(request *testRequest) { request.Phone, request.Website, request.Nickname = "", "", "" }, nil, nil},
+		{"email with display name", func(request *testRequest) { request.Email = "Ada <ada@vulnlabs.localhost>" }, []string{"email"}, []string{"email"}},
+		{"email without domain", func(request *testRequest) { request.Email = "ada" }, []string{"email"}, []string{"email"}},
+		{"nil pointer", func(request *testRequest) { request.Name = nil }, []string{"name"}, []string{"required"}},
+		{"pointer too long", func(request *testRequest) { name := "Adelaide"; request.Name = &name }, []string{"name"}, []string{"max"}},
+		{"e164 without plus", func(request *testRequest) { request.Phone = "0791234567" }, []string{"phone"}, []string{"e164"}},
+		{"e164 too long", func(request *testRequest) { request.Phone = "+4179123456789012" }, []string{"phone"}, []string{"e164"}},
+		{"relative URL", func(request *testRequest) { request.Website = "/ada" }, []string{"website"}, []string{"url"}},
+		{"scheme relative URL", func(request *testRequest) { request.Website = "//vulnlabs.localhost/ada" }, []string{"website"}, []string{"url"}},
+		{"non http URL", func(request *testRequest) { request.Website = "javascript:alert(1)" }, []string{"website"}, []string{"url"}},
+		{"max counts runes, not bytes", func(request *testRequest) { request.Nickname = "éèà" }, nil, nil},
+		{"max exceeded in runes", func(request *testRequest) { request.Nickname = "éèàùç" }, []string{"nickname"}, []string{"max"}},
+		{"min counts runes, not bytes", func(request *testRequest) { request.Nickname = "é" }, []string{"nickname"}, []string{"min"}},
+		{"max number", func(request *testRequest) { request.Count = 11 }, []string{"count"}, []string{"max"}},
+		{"nested struct", func(request *testRequest) { request.Address.City = "" }, []string{"address.city"}, []string{"required"}},
+		{"nil nested pointer", func(request *testRequest) { request.Billing = nil }, nil, nil},
+		{"nested pointer", func(request *testRequest) { request.Billing = &testAddress{Zip: "300000"} }, []string{"billing.city", "billing.zip"}, []string{"required", "max"}},
+		{"several fields", func(request *testRequest) { request.Email, request.Phone, request.Address.Zip = "", "+0", "300000" }, []string{"email", "phone", "address.zip"}, []string{"required", "e164", "max"}},
+	}
+
+	for _, test := range tests {
+
+		request := validTestRequest()
+		test.mutate(request)
+
+		err := Validate(request)
+
+		if test.fields == nil {
+
+			if err != nil {
+				t.Errorf("%s : got error %v, want none", test.name, err)
+			}
+
+			continue
+		}
+
+		errs, ok := err.(Errors)
+
+		if !ok {
+			t.Errorf("%s : got error %v, want Errors", test.name, err)
+			continue
+		}
+
+		rules := []string{}
+
+		for _, fieldError := range errs {
+			rules = append(rules, fieldError.Rule)
+		}
+
+		if !reflect.DeepEqual(errs.Fields(), test.fields) || !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("%s : got fields %v & rules %v, want %v & %v", test.name, errs.Fields(), rules, test.fields, test.rules)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+
+	if err := Validate(*validTestRequest()); err != nil {
+		t.Errorf("got error %v, want none", err)
+	}
+}
+
+func TestErrorsFormat(t *testing.T) {
+
+	errs := Errors{}
+	errs.Add("email", "required", "is required")
+	errs.Add("address.city", "required", "is required")
+
+	if fields := errs.Fields(); !reflect.DeepEqual(fields, []string{"email", "address.city"}) {
+		t.Errorf("got fields %v, want [email address.city]", fields)
+	}
+
+	// CustomHandle splits the error on "|" when it is not structured
+	if message := errs.Error(); message != "email|address.city" {
+		t.Errorf("got error %q, want %q", message, "email|address.city")
+	}
+
+	if (Errors{}).ErrorOrNil() != nil || errs.ErrorOrNil() == nil {
+		t.Errorf("ErrorOrNil : want nil for no errors only")
+	}
+
+	if fields := (Errors{}).Fields(); fields == nil || len(fields) != 0 {
+		t.Errorf("got fields %v, want an empty list", fields)
+	}
+}